@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/datasources"
+	"client-nodes-reporter/forks"
+	"client-nodes-reporter/notifier"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type ForkReadinessCmdFlags struct {
+	// Fork config file
+	ForkConfig string
+}
+
+func newForkReadinessCmd(rootFlags *RootCmdFlags) *cobra.Command {
+	flags := new(ForkReadinessCmdFlags)
+
+	forkReadinessCmd := &cobra.Command{
+		Use:   "fork-readiness",
+		Short: "Report the share of nodes running a fork-ready client version",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			// Validate flags
+			if flags.ForkConfig == "" {
+				flags.ForkConfig = viper.GetString("fork_config")
+				if flags.ForkConfig == "" {
+					return fmt.Errorf("fork config is required")
+				}
+			}
+			if err := rootFlags.validateFetch(); err != nil {
+				return err
+			}
+			if err := rootFlags.validateNetwork(); err != nil {
+				return err
+			}
+			if err := rootFlags.validateSlack(); err != nil {
+				return err
+			}
+
+			// Configure source
+			ctx, err := configureSource(ctx, rootFlags)
+			if err != nil {
+				return err
+			}
+
+			// Configure slack notifier
+			ctx, err = configureSlackNotifier(ctx, rootFlags)
+			if err != nil {
+				return err
+			}
+
+			// Update context
+			cmd.SetContext(ctx)
+
+			return nil
+		},
+		RunE: withDiagnostics(rootFlags, func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			logger := ctx.Value(configs.ContextKeyLogger).(*slog.Logger)
+			source, ok := ctx.Value(configs.ContextKeySource).(datasources.VersionSource)
+			if !ok {
+				return fmt.Errorf("source %s does not publish client versions", rootFlags.Source)
+			}
+
+			forkConfig, err := forks.LoadConfig(flags.ForkConfig)
+			if err != nil {
+				return err
+			}
+			logger.Info("Loaded fork config", "fork", forkConfig.Name, "date", forkConfig.Date, "clients", len(forkConfig.MinimumVersions))
+
+			var distributions []datasources.Distribution
+			for _, layer := range forkConfig.Layers() {
+				logger.Info("Scanning client versions", "layer", layer)
+				distribution, err := source.GetVersionDistribution(ctx, layer, forkConfig.Clients(layer))
+				if err != nil {
+					return alertOnBlock(ctx, ctx.Value(configs.ContextKeySource).(datasources.DataSource), err)
+				}
+				distributions = append(distributions, distribution)
+			}
+
+			readiness := forks.Compute(forkConfig, distributions)
+			for _, layer := range readiness.Layers {
+				for _, client := range layer.Clients {
+					logger.Info(
+						"Client readiness",
+						"client", client.ClientName,
+						"minimumVersion", client.MinimumVersion,
+						"ready", client.Ready,
+						"total", client.Total,
+						"percentage", fmt.Sprintf("%.2f%%", client.Percentage()),
+					)
+				}
+				logger.Info(
+					"Network readiness",
+					"layer", layer.Layer,
+					"ready", layer.Ready,
+					"total", layer.Total,
+					"percentage", fmt.Sprintf("%.2f%%", layer.Percentage()),
+				)
+			}
+
+			logger.Info("Sending fork readiness report to Slack")
+			slackNotifier := ctx.Value(configs.ContextKeyNotifier).(*notifier.SlackNotifier)
+			sourceName := ctx.Value(configs.ContextKeySource).(datasources.DataSource).SourceName()
+			if err := slackNotifier.SendForkReadinessReport(ctx, sourceName, readiness); err != nil {
+				return fmt.Errorf("failed to send report: %w", err)
+			}
+			logger.Info("Report sent successfully")
+
+			return nil
+		}),
+	}
+
+	// Fork config
+	viper.BindEnv("fork_config")
+	forkReadinessCmd.Flags().StringVar(&flags.ForkConfig, "fork-config", "", "YAML file with the fork name, date and minimum fork-ready version per client. environment variable: REPORTER_FORK_CONFIG")
+
+	return forkReadinessCmd
+}
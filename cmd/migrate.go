@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/database"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd(rootFlags *RootCmdFlags) *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Add the properties the reporter needs to the Notion databases",
+		Long: `Add the properties the reporter needs to the Notion databases.
+
+Runs never change the schema of the databases: they fail when a property is
+missing. This command adds the missing ones to --notion-db, and to
+--notion-breakdown-db when --breakdowns is set, which needs the integration
+to have update access. Existing properties and pages are left as they are.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// Validate flags
+			return rootFlags.validateNotion()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			logger := ctx.Value(configs.ContextKeyLogger).(*slog.Logger)
+
+			added, err := database.MigrateNotionDB(ctx, database.NotionDBOptions{
+				DatabaseID: rootFlags.NotionDB,
+				Token:      rootFlags.NotionToken,
+				HTTPClient: httpClient(ctx),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to migrate notion db: %w", err)
+			}
+			logger.Info("Migrated notion db", "added", added)
+
+			if len(rootFlags.Breakdowns) > 0 {
+				added, err := database.MigrateNotionBreakdownDB(ctx, database.NotionDBOptions{
+					DatabaseID: rootFlags.NotionBreakdownDB,
+					Token:      rootFlags.NotionToken,
+					HTTPClient: httpClient(ctx),
+				})
+				if err != nil {
+					return fmt.Errorf("failed to migrate notion breakdown db: %w", err)
+				}
+				logger.Info("Migrated notion breakdown db", "added", added)
+			}
+
+			return nil
+		},
+	}
+
+	return migrateCmd
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/datasources"
+
+	"github.com/spf13/cobra"
+)
+
+type ReparseCmdFlags struct {
+	// Only reparse runs started on or after this date (YYYY-MM-DD)
+	Since string
+	// Only reparse runs started on or before this date (YYYY-MM-DD)
+	Until string
+	// Only reparse this run
+	Run string
+	// File the recomputed client data is written to, one JSON object per line
+	Output string
+}
+
+// reparseDateLayout is the layout of --since and --until.
+const reparseDateLayout = "2006-01-02"
+
+func newReparseCmd(rootFlags *RootCmdFlags) *cobra.Command {
+	flags := new(ReparseCmdFlags)
+
+	reparseCmd := &cobra.Command{
+		Use:   "reparse",
+		Short: "Recompute client data from the pages of past runs kept in --archive",
+		Long: `Recompute client data from the pages of past runs kept in --archive.
+
+Every archived run is parsed again with the current parsers, as if its pages
+had just been fetched, so the numbers of days lost to a parser bug can be
+recovered once it is fixed. Nothing is fetched, and nothing is written to
+Notion, whose "Created time" cannot be backdated; the recomputed client data
+is logged and written to --output instead.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// Validate flags
+			if err := rootFlags.validateArchive(); err != nil {
+				return err
+			}
+			if err := rootFlags.validateNetwork(); err != nil {
+				return err
+			}
+			if configs.ClientTypeFromString(rootFlags.Client) == configs.ClientTypeUnknown {
+				return fmt.Errorf("invalid client: %s", rootFlags.Client)
+			}
+			if _, _, err := flags.window(); err != nil {
+				return err
+			}
+			return rootFlags.validateReplayableSource()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			logger := ctx.Value(configs.ContextKeyLogger).(*slog.Logger)
+			clientType := configs.ClientTypeFromString(rootFlags.Client)
+			since, until, _ := flags.window()
+
+			archive, err := datasources.OpenPageArchive(rootFlags.Archive)
+			if err != nil {
+				return err
+			}
+			runs, err := archive.Runs()
+			if err != nil {
+				return err
+			}
+
+			output := io.Discard
+			if flags.Output != "" {
+				file, err := os.Create(flags.Output)
+				if err != nil {
+					return fmt.Errorf("failed to create output file: %w", err)
+				}
+				defer file.Close()
+				output = file
+			}
+			encoder := json.NewEncoder(output)
+
+			var reparsed, failed int
+			for _, run := range runs {
+				if flags.Run != "" && run.ID != flags.Run {
+					continue
+				}
+				if (!since.IsZero() && run.Started.Before(since)) || (!until.IsZero() && !run.Started.Before(until)) {
+					continue
+				}
+
+				source, err := newSource(rootFlags, sourceOptions{
+					Fetcher: &datasources.ReplayFetcher{Archive: archive, Pages: run.Pages},
+				})
+				if err != nil {
+					return err
+				}
+
+				var clientData []datasources.ClientData
+				if rootFlags.RecordAll {
+					var distribution datasources.Distribution
+					distribution, err = source.GetDistribution(ctx, clientType.Layer())
+					clientData = distribution.ClientData()
+				} else {
+					var data datasources.ClientData
+					data, err = source.GetClientData(ctx, clientType)
+					clientData = []datasources.ClientData{data}
+				}
+				if err != nil {
+					// A run archived before a page was scraped, or whose pages
+					// were blocked, cannot be reparsed; the others still can.
+					logger.Warn("Failed to reparse run", "run", run.ID, "started", run.Started, "error", err)
+					failed++
+					continue
+				}
+
+				for _, data := range clientData {
+					data.CreatedAt = run.Started
+					logger.Info(
+						"Reparsed client data",
+						"run", run.ID,
+						"createdAt", data.CreatedAt,
+						"client", data.ClientName,
+						"total", data.Total,
+						"clientTotal", data.ClientTotal,
+						"totalSynced", data.TotalSynced,
+						"clientSynced", data.ClientSynced,
+					)
+					if err := encoder.Encode(data); err != nil {
+						return fmt.Errorf("failed to write client data: %w", err)
+					}
+				}
+				reparsed++
+			}
+
+			logger.Info("Reparse finished", "runs", reparsed, "failed", failed)
+			if reparsed == 0 && failed > 0 {
+				return fmt.Errorf("none of the %d archived runs could be reparsed", failed)
+			}
+			return nil
+		},
+	}
+
+	reparseCmd.Flags().StringVar(&flags.Since, "since", "", "only reparse runs started on or after this date (YYYY-MM-DD, UTC)")
+	reparseCmd.Flags().StringVar(&flags.Until, "until", "", "only reparse runs started on or before this date (YYYY-MM-DD, UTC)")
+	reparseCmd.Flags().StringVar(&flags.Run, "run", "", "only reparse the archived run with this id")
+	reparseCmd.Flags().StringVarP(&flags.Output, "output", "o", "", "file to write the recomputed client data to, one JSON object per line")
+
+	return reparseCmd
+}
+
+// window returns the parsed --since and --until, the latter moved to the end
+// of its day. Unset bounds are zero.
+func (f *ReparseCmdFlags) window() (since, until time.Time, err error) {
+	if f.Since != "" {
+		since, err = time.Parse(reparseDateLayout, f.Since)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid since date: %w", err)
+		}
+	}
+	if f.Until != "" {
+		until, err = time.Parse(reparseDateLayout, f.Until)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid until date: %w", err)
+		}
+		until = until.AddDate(0, 0, 1)
+	}
+	return since, until, nil
+}
+
+// replayableSources are the sources reading every response through the
+// fetcher they are given, so they can be fed an archived run. The rpc source
+// calls the nodes itself and the file source reads its own files.
+var replayableSources = []datasources.DataSourceType{
+	datasources.DataSourceTypeEthernodes,
+	datasources.DataSourceTypeEthernets,
+	datasources.DataSourceTypeAPI,
+	datasources.DataSourceTypeBeacon,
+}
+
+// validateReplayableSource fails when --source, or a source it aggregates,
+// cannot be reparsed from the archive, rather than letting it read live data.
+func (f *RootCmdFlags) validateReplayableSource() error {
+	sources := []string{f.Source}
+	if datasources.DataSourceType(f.Source) == datasources.DataSourceTypeAggregate {
+		sources = f.aggregateSources()
+	}
+	for _, source := range sources {
+		if !slices.Contains(replayableSources, datasources.DataSourceType(source)) {
+			return fmt.Errorf("source %s cannot be reparsed from the archive", source)
+		}
+	}
+	return nil
+}
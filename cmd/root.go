@@ -3,13 +3,20 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"client-nodes-reporter/configs"
 	"client-nodes-reporter/database"
 	"client-nodes-reporter/datasources"
 	"client-nodes-reporter/notifier"
+	"client-nodes-reporter/recording"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -22,11 +29,18 @@ type RootCmdFlags struct {
 	// Logs
 	LogsFormat string
 
+	// Timeout bounding the whole run; 0 means no limit
+	Timeout time.Duration
+
 	// Skip Update
 	SkipUpdate bool
+	// Record every client of the source's distribution, not only Client
+	RecordAll bool
 
 	// Source
 	Source string
+	// Network the source reports on
+	Network string
 	// Client
 	Client string
 
@@ -34,15 +48,84 @@ type RootCmdFlags struct {
 	NotionDB string
 	// Notion Token
 	NotionToken string
+	// Notion DB for breakdowns
+	NotionBreakdownDB string
+
+	// Breakdown dimensions to collect and report on
+	Breakdowns []string
 
 	// Slack App Token
 	SlackAppToken string
 	// Slack Channel
 	SlackChannel string
 
-	// FlareSolverr v1 endpoint. When non-empty, ethernodes fetches are proxied
-	// through it (real headless Chromium) instead of going direct.
-	FlareSolverrURL string
+	// FlareSolverr v1 endpoints. When non-empty, ethernodes fetches are proxied
+	// through them (real headless Chromium) instead of going direct.
+	FlareSolverrURLs []string
+	// How long to wait at startup for the FlareSolverr endpoints to be ready
+	FlareSolverrWait time.Duration
+
+	// Where to write the diagnostics bundle of a failed run: a directory, or
+	// a .tar.gz file
+	Diagnostics string
+
+	// HTTP or SOCKS5 proxies for the direct and FlareSolverr fetches, listed
+	// or read from a file with one per line
+	Proxies   []string
+	ProxyFile string
+
+	// Directory every fetched page is archived to, for reparse
+	Archive string
+
+	// Directory to record every HTTP exchange of the run to, or to replay
+	// them from instead of sending them
+	Record string
+	Replay string
+
+	// Sources the aggregate source reconciles, and the largest gap between
+	// their shares of a client, in percentage points, before it is flagged
+	AggregateSources []string
+	MaxSourceSpread  float64
+
+	// JSON API read by the api source, and where the figures are in its
+	// responses
+	APIURL     string
+	APIMapping string
+
+	// JSON-RPC endpoints of our execution nodes read by the rpc source
+	RPCURLs []string
+
+	// Beacon API URLs of our beacon nodes read by the beacon source, the
+	// path of their peers and where the agent string is in each peer
+	BeaconURLs       []string
+	BeaconPeersPath  string
+	BeaconAgentField string
+
+	// Saved pages read by the file source, and the site they come from
+	FilePaths  []string
+	FileFormat string
+
+	// How pages are fetched: one strategy or several tried in order
+	FetchStrategies []string
+
+	// YAML file of extraction rules replacing the built-in ones
+	ExtractionRules string
+
+	// Largest relative change of a count since the previous run before the
+	// row is held back, and the file it is then quarantined to rather than
+	// failing the run
+	MaxDailyChange float64
+	Quarantine     string
+
+	// File keeping the page structure of the last good run, compared with
+	// each run's; and whether to take this run's structure as is
+	LayoutFingerprints string
+	AcceptLayout       bool
+
+	// Ethernodes base URL and mirrors, e.g. a caching mirror. Empty uses the
+	// network's ethernodes site.
+	EthernodesURL     string
+	EthernodesMirrors []string
 
 	// Add new flags for MaxRetries and InitialRetryDelay
 	MaxRetries        int
@@ -58,39 +141,571 @@ func (f *RootCmdFlags) Validate() error {
 		return fmt.Errorf("client is required")
 	}
 
+	if err := f.validateNetwork(); err != nil {
+		return err
+	}
+
+	if err := f.validateNotion(); err != nil {
+		return err
+	}
+
+	if err := f.validateSlack(); err != nil {
+		return err
+	}
+
+	if err := f.validateFetch(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *RootCmdFlags) validateFetch() error {
+	if len(f.FlareSolverrURLs) == 0 {
+		f.FlareSolverrURLs = splitList(viper.GetString("flaresolverr_url"))
+	}
+
+	if len(f.Proxies) == 0 {
+		f.Proxies = splitList(viper.GetString("proxies"))
+	}
+	if f.ProxyFile == "" {
+		f.ProxyFile = viper.GetString("proxy_file")
+	}
+	if f.ProxyFile != "" {
+		proxies, err := datasources.LoadProxyList(f.ProxyFile)
+		if err != nil {
+			return err
+		}
+		f.Proxies = append(f.Proxies, proxies...)
+	}
+
+	if len(f.FetchStrategies) == 0 {
+		f.FetchStrategies = viper.GetStringSlice("fetch_strategy")
+	}
+	for _, strategy := range f.FetchStrategies {
+		parsed, err := datasources.FetchStrategyFromString(strategy)
+		if err != nil {
+			return err
+		}
+		if parsed == datasources.FetchStrategyFlareSolverr && len(f.FlareSolverrURLs) == 0 {
+			return fmt.Errorf("flaresolverr url is required by the flaresolverr fetch strategy")
+		}
+	}
+
+	return nil
+}
+
+func (f *RootCmdFlags) validateArchive() error {
+	if f.Archive == "" {
+		f.Archive = viper.GetString("archive")
+		if f.Archive == "" {
+			return fmt.Errorf("archive directory is required")
+		}
+	}
+
+	return nil
+}
+
+// replayPlaceholder stands in for the credentials and ids a replay is run
+// without. The recorded exchanges are matched regardless of them.
+const replayPlaceholder = "replay"
+
+// replayDefault returns value, or replayPlaceholder when it is empty and the
+// run is a replay.
+func (f *RootCmdFlags) replayDefault(value string) string {
+	if value == "" && f.Replay != "" {
+		return replayPlaceholder
+	}
+	return value
+}
+
+// splitList splits a comma-separated environment variable, which viper would
+// split on whitespace instead.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// aggregateSources returns --aggregate-sources, defaulting to ethernodes and
+// ethernets.
+func (f *RootCmdFlags) aggregateSources() []string {
+	if len(f.AggregateSources) == 0 {
+		f.AggregateSources = splitList(viper.GetString("aggregate_sources"))
+		if len(f.AggregateSources) == 0 {
+			f.AggregateSources = []string{string(datasources.DataSourceTypeEthernodes), string(datasources.DataSourceTypeEthernets)}
+		}
+	}
+	return f.AggregateSources
+}
+
+// fetchStrategies returns the parsed --fetch-strategy; validateFetch has
+// already checked it.
+func (f *RootCmdFlags) fetchStrategies() []datasources.FetchStrategy {
+	strategies := make([]datasources.FetchStrategy, 0, len(f.FetchStrategies))
+	for _, name := range f.FetchStrategies {
+		strategy, _ := datasources.FetchStrategyFromString(name)
+		strategies = append(strategies, strategy)
+	}
+	return strategies
+}
+
+// extractionRules loads the --extraction-rules file; nil keeps the built-in
+// rules.
+func (f *RootCmdFlags) extractionRules() (*datasources.ExtractionRules, error) {
+	if f.ExtractionRules == "" {
+		f.ExtractionRules = viper.GetString("extraction_rules")
+		if f.ExtractionRules == "" {
+			return nil, nil
+		}
+	}
+	return datasources.LoadExtractionRules(f.ExtractionRules)
+}
+
+func (f *RootCmdFlags) validateNotion() error {
 	if f.NotionDB == "" {
-		f.NotionDB = viper.GetString("notion_db")
+		f.NotionDB = f.replayDefault(viper.GetString("notion_db"))
 		if f.NotionDB == "" {
 			return fmt.Errorf("notion db id is required")
 		}
 	}
 
 	if f.NotionToken == "" {
-		f.NotionToken = viper.GetString("notion_token")
+		f.NotionToken = f.replayDefault(viper.GetString("notion_token"))
 		if f.NotionToken == "" {
 			return fmt.Errorf("notion token is required")
 		}
 	}
 
+	if len(f.Breakdowns) > 0 {
+		for _, dimension := range f.Breakdowns {
+			if _, err := datasources.DimensionFromString(dimension); err != nil {
+				return err
+			}
+		}
+		if f.NotionBreakdownDB == "" {
+			f.NotionBreakdownDB = f.replayDefault(viper.GetString("notion_breakdown_db"))
+			if f.NotionBreakdownDB == "" {
+				return fmt.Errorf("notion breakdown db id is required when breakdowns are enabled")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *RootCmdFlags) validateNetwork() error {
+	if f.Network == "" {
+		f.Network = viper.GetString("network")
+		if f.Network == "" {
+			f.Network = string(configs.NetworkMainnet)
+		}
+	}
+
+	if _, ok := configs.NetworkFromString(f.Network); !ok {
+		return fmt.Errorf("invalid network: %s", f.Network)
+	}
+
+	return nil
+}
+
+// network returns the parsed --network; validateNetwork has already checked it.
+func (f *RootCmdFlags) network() configs.Network {
+	network, _ := configs.NetworkFromString(f.Network)
+	return network
+}
+
+// dimensions returns the parsed --breakdowns; Validate has already checked them.
+func (f *RootCmdFlags) dimensions() []datasources.Dimension {
+	dimensions := make([]datasources.Dimension, 0, len(f.Breakdowns))
+	for _, name := range f.Breakdowns {
+		dimension, _ := datasources.DimensionFromString(name)
+		dimensions = append(dimensions, dimension)
+	}
+	return dimensions
+}
+
+func (f *RootCmdFlags) validateSlack() error {
 	if f.SlackAppToken == "" {
-		f.SlackAppToken = viper.GetString("slack_app_token")
+		f.SlackAppToken = f.replayDefault(viper.GetString("slack_app_token"))
 		if f.SlackAppToken == "" {
 			return fmt.Errorf("slack app token is required")
 		}
 	}
 
 	if f.SlackChannel == "" {
-		f.SlackChannel = viper.GetString("slack_channel")
+		f.SlackChannel = f.replayDefault(viper.GetString("slack_channel"))
 		if f.SlackChannel == "" {
 			return fmt.Errorf("slack channel is required")
 		}
 	}
 
-	if f.FlareSolverrURL == "" {
-		f.FlareSolverrURL = viper.GetString("flaresolverr_url")
+	return nil
+}
+
+// configureSource creates the data source selected by --source and stores it
+// in the context. Sources holding resources for the run, such as a
+// FlareSolverr session, are closed once the command finishes.
+func configureSource(ctx context.Context, flags *RootCmdFlags) (context.Context, error) {
+	// Only the FlareSolverr endpoints that come up are used, so one crashed
+	// sidecar does not fail the run. The file source fetches nothing.
+	fetches := datasources.DataSourceType(flags.Source) != datasources.DataSourceTypeFile
+	if fetches && len(flags.FlareSolverrURLs) > 0 && flags.FlareSolverrWait > 0 {
+		ready, err := datasources.WaitForFlareSolverr(ctx, transport(ctx, nil), flags.FlareSolverrURLs, flags.FlareSolverrWait)
+		if err != nil {
+			return nil, err
+		}
+		flags.FlareSolverrURLs = ready
 	}
 
-	return nil
+	options := sourceOptions{Transport: transport(ctx, nil)}
+	options.Recorder, _ = ctx.Value(configs.ContextKeyRecording).(*recording.Recorder)
+	if len(flags.Proxies) > 0 {
+		var err error
+		options.Proxies, err = datasources.NewProxyPool(flags.Proxies)
+		if err != nil {
+			return nil, err
+		}
+		if session, ok := ctx.Value(configs.ContextKeyRecording).(recording.Session); ok {
+			options.Proxies.WrapTransports(session.Wrap)
+		}
+		cobra.OnFinalize(options.Proxies.LogStats)
+	}
+
+	if flags.Archive == "" {
+		flags.Archive = viper.GetString("archive")
+	}
+	if flags.Archive != "" {
+		var err error
+		options.Archive, err = datasources.NewPageArchive(flags.Archive)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	source, err := newSource(flags, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := source.(io.Closer); ok {
+		cobra.OnFinalize(func() {
+			if err := closer.Close(); err != nil {
+				slog.Warn("Failed to close data source", "error", err)
+			}
+		})
+	}
+	return context.WithValue(ctx, configs.ContextKeySource, source), nil
+}
+
+// sourceOptions are the parts of a data source that are set up once per
+// command rather than read from the flags.
+type sourceOptions struct {
+	Proxies   *datasources.ProxyPool
+	Archive   *datasources.PageArchive
+	Transport http.RoundTripper
+	// Fetcher, when set, replaces the fetchers of the source, e.g. to replay
+	// archived pages.
+	Fetcher datasources.Fetcher
+	// Recorder, when the run is recorded, is told which headers carry the
+	// credentials of the source.
+	Recorder *recording.Recorder
+}
+
+// newSource creates the data source selected by --source.
+func newSource(flags *RootCmdFlags, options sourceOptions) (datasources.DataSource, error) {
+	rules, err := flags.extractionRules()
+	if err != nil {
+		return nil, err
+	}
+
+	switch datasources.DataSourceType(flags.Source) {
+	case datasources.DataSourceTypeEthernets:
+		ethernets, err := datasources.NewEthernetsDataSource(&datasources.EthernetsDataSourceOptions{
+			Network:           flags.network(),
+			MaxRetries:        flags.MaxRetries,
+			InitialRetryDelay: flags.InitialRetryDelay,
+			FlareSolverrURLs:  flags.FlareSolverrURLs,
+			Proxies:           options.Proxies,
+			Archive:           options.Archive,
+			Fetcher:           options.Fetcher,
+			Transport:         options.Transport,
+			FetchStrategies:   flags.fetchStrategies(),
+			Rules:             rules,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ethernets data source: %w", err)
+		}
+		return ethernets, nil
+	case datasources.DataSourceTypeFile:
+		if len(flags.FilePaths) == 0 {
+			flags.FilePaths = splitList(viper.GetString("file_path"))
+		}
+		if flags.FileFormat == "" {
+			flags.FileFormat = viper.GetString("file_format")
+		}
+		file, err := datasources.NewFileDataSource(&datasources.FileDataSourceOptions{
+			Paths:   flags.FilePaths,
+			Format:  datasources.DataSourceType(flags.FileFormat),
+			Network: flags.network(),
+			Rules:   rules,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file data source: %w", err)
+		}
+		return file, nil
+	case datasources.DataSourceTypeAggregate:
+		names := flags.aggregateSources()
+		sources := make([]datasources.DataSource, 0, len(names))
+		for _, name := range names {
+			if datasources.DataSourceType(name) == datasources.DataSourceTypeAggregate {
+				return nil, fmt.Errorf("an aggregate cannot hold another aggregate")
+			}
+			sourceFlags := *flags
+			sourceFlags.Source = name
+			source, err := newSource(&sourceFlags, options)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, source)
+		}
+		aggregate, err := datasources.NewAggregateDataSource(&datasources.AggregateDataSourceOptions{
+			Sources:   sources,
+			MaxSpread: flags.MaxSourceSpread,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create aggregate data source: %w", err)
+		}
+		return aggregate, nil
+	case datasources.DataSourceTypeAPI:
+		if flags.APIURL == "" {
+			flags.APIURL = viper.GetString("api_url")
+			if flags.APIURL == "" {
+				return nil, fmt.Errorf("api url is required by the api source")
+			}
+		}
+		if flags.APIMapping == "" {
+			flags.APIMapping = viper.GetString("api_mapping")
+			if flags.APIMapping == "" {
+				return nil, fmt.Errorf("api mapping is required by the api source")
+			}
+		}
+		mapping, err := datasources.LoadAPIMapping(flags.APIMapping)
+		if err != nil {
+			return nil, err
+		}
+		if options.Recorder != nil {
+			options.Recorder.RedactHeaders(slices.Collect(maps.Keys(mapping.Header))...)
+		}
+		api, err := datasources.NewAPIDataSource(&datasources.APIDataSourceOptions{
+			BaseURL:           flags.APIURL,
+			Mapping:           mapping,
+			Network:           flags.network(),
+			MaxRetries:        flags.MaxRetries,
+			InitialRetryDelay: flags.InitialRetryDelay,
+			Archive:           options.Archive,
+			Transport:         options.Transport,
+			Fetcher:           options.Fetcher,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create api data source: %w", err)
+		}
+		return api, nil
+	case datasources.DataSourceTypeRPC:
+		if len(flags.RPCURLs) == 0 {
+			flags.RPCURLs = splitList(viper.GetString("rpc_urls"))
+			if len(flags.RPCURLs) == 0 {
+				return nil, fmt.Errorf("rpc urls are required by the rpc source")
+			}
+		}
+		rpc, err := datasources.NewRPCDataSource(&datasources.RPCDataSourceOptions{
+			URLs:              flags.RPCURLs,
+			Network:           flags.network(),
+			MaxRetries:        flags.MaxRetries,
+			InitialRetryDelay: flags.InitialRetryDelay,
+			Transport:         options.Transport,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rpc data source: %w", err)
+		}
+		return rpc, nil
+	case datasources.DataSourceTypeBeacon:
+		if len(flags.BeaconURLs) == 0 {
+			flags.BeaconURLs = splitList(viper.GetString("beacon_urls"))
+			if len(flags.BeaconURLs) == 0 {
+				return nil, fmt.Errorf("beacon urls are required by the beacon source")
+			}
+		}
+		if flags.BeaconPeersPath == "" {
+			flags.BeaconPeersPath = viper.GetString("beacon_peers_path")
+		}
+		if flags.BeaconAgentField == "" {
+			flags.BeaconAgentField = viper.GetString("beacon_agent_field")
+		}
+		beacon, err := datasources.NewBeaconDataSource(&datasources.BeaconDataSourceOptions{
+			URLs:              flags.BeaconURLs,
+			PeersPath:         flags.BeaconPeersPath,
+			AgentField:        flags.BeaconAgentField,
+			Network:           flags.network(),
+			MaxRetries:        flags.MaxRetries,
+			InitialRetryDelay: flags.InitialRetryDelay,
+			Archive:           options.Archive,
+			Transport:         options.Transport,
+			Fetcher:           options.Fetcher,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create beacon data source: %w", err)
+		}
+		return beacon, nil
+	case datasources.DataSourceTypeEthernodes:
+		if flags.EthernodesURL == "" {
+			flags.EthernodesURL = viper.GetString("ethernodes_url")
+		}
+		ethernodes, err := datasources.NewEthernodesDataSource(&datasources.EthernodesDataSourceOptions{
+			BaseURL:           flags.EthernodesURL,
+			Mirrors:           flags.EthernodesMirrors,
+			Network:           flags.network(),
+			FlareSolverrURLs:  flags.FlareSolverrURLs,
+			Proxies:           options.Proxies,
+			Archive:           options.Archive,
+			Fetcher:           options.Fetcher,
+			Transport:         options.Transport,
+			MaxRetries:        flags.MaxRetries,
+			InitialRetryDelay: flags.InitialRetryDelay,
+			FetchStrategies:   flags.fetchStrategies(),
+			Rules:             rules,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ethernodes data source: %w", err)
+		}
+		return ethernodes, nil
+	default:
+		return nil, fmt.Errorf("invalid source: \"%s\"", flags.Source)
+	}
+}
+
+// configureSlackNotifier creates the Slack notifier and stores it in the
+// context.
+func configureSlackNotifier(ctx context.Context, flags *RootCmdFlags) (context.Context, error) {
+	slackNotifier, err := notifier.NewSlackNotifier(notifier.SlackNotifierOptions{
+		Token:      flags.SlackAppToken,
+		Channel:    flags.SlackChannel,
+		HTTPClient: httpClient(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slack notifier: %w", err)
+	}
+	return context.WithValue(ctx, configs.ContextKeyNotifier, slackNotifier), nil
+}
+
+// transport returns base, recorded or replayed when the run is.
+func transport(ctx context.Context, base http.RoundTripper) http.RoundTripper {
+	session, ok := ctx.Value(configs.ContextKeyRecording).(recording.Session)
+	if !ok {
+		return base
+	}
+	return session.Wrap(base)
+}
+
+// httpClient returns the client of the Notion and Slack APIs: nil, for their
+// default, unless the run is recorded or replayed.
+func httpClient(ctx context.Context) *http.Client {
+	if _, ok := ctx.Value(configs.ContextKeyRecording).(recording.Session); !ok {
+		return nil
+	}
+	return &http.Client{Transport: transport(ctx, nil)}
+}
+
+// withDiagnostics wraps run to write the diagnostics bundle of the run when
+// it fails.
+func withDiagnostics(flags *RootCmdFlags, run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if err == nil {
+			return nil
+		}
+		diagnostics, ok := cmd.Context().Value(configs.ContextKeyDiagnostics).(*datasources.Diagnostics)
+		if !ok {
+			return err
+		}
+		path, writeErr := diagnostics.Write(flags.Diagnostics, err)
+		if writeErr != nil {
+			slog.Warn("Failed to write diagnostics bundle", "error", writeErr)
+		} else {
+			slog.Info("Wrote diagnostics bundle", "path", path)
+		}
+		return err
+	}
+}
+
+// validationHistory is how many of a client's latest rows are read to judge
+// a change against the week before: more than a week of daily runs.
+const validationHistory = 35
+
+// validateClientData checks scraped rows against their invariants and the
+// client's stored rows of the week before, and returns the rows to write. Failing rows are
+// alerted on, then quarantined to --quarantine, or fail the run before
+// anything is written when it is not set.
+func validateClientData(ctx context.Context, flags *RootCmdFlags, source datasources.DataSource, db *database.NotionDB, rows []datasources.ClientData) ([]datasources.ClientData, error) {
+	options := datasources.ValidationOptions{MaxDailyChange: flags.MaxDailyChange, MinChangeBase: 100}
+
+	valid := make([]datasources.ClientData, 0, len(rows))
+	var invalid []*datasources.ValidationError
+	for _, row := range rows {
+		var history []datasources.ClientData
+		if options.MaxDailyChange > 0 {
+			var err error
+			history, err = db.GetLatestData(ctx, string(row.ClientName), validationHistory, source.SourceType(), flags.network())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get previous %s data: %w", row.ClientName, err)
+			}
+		}
+		if err := datasources.ValidateClientData(row, history, options); err != nil {
+			invalid = append(invalid, err)
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	slackNotifier, _ := ctx.Value(configs.ContextKeyNotifier).(*notifier.SlackNotifier)
+	for _, err := range invalid {
+		slog.Warn("Client data failed validation", "client", err.ClientData.ClientName, "problems", err.Problems, "quarantined", flags.Quarantine != "")
+		if flags.Quarantine != "" {
+			if quarantineErr := datasources.Quarantine(flags.Quarantine, err); quarantineErr != nil {
+				return nil, quarantineErr
+			}
+		}
+		if slackNotifier != nil {
+			if alertErr := slackNotifier.SendValidationAlert(ctx, source.SourceName(), err, flags.Quarantine != ""); alertErr != nil {
+				slog.Warn("Failed to send validation alert", "error", alertErr)
+			}
+		}
+	}
+	if len(invalid) > 0 && flags.Quarantine == "" {
+		return nil, invalid[0]
+	}
+	return valid, nil
+}
+
+// alertOnBlock posts a Slack alert when err is an anti-bot block that
+// retrying cannot get past, and returns err.
+func alertOnBlock(ctx context.Context, source datasources.DataSource, err error) error {
+	block, ok := datasources.BlockFrom(err)
+	if !ok || !block.Alert() {
+		return err
+	}
+	slackNotifier, ok := ctx.Value(configs.ContextKeyNotifier).(*notifier.SlackNotifier)
+	if !ok {
+		return err
+	}
+	if alertErr := slackNotifier.SendBlockAlert(ctx, source.SourceName(), block); alertErr != nil {
+		slog.Warn("Failed to send block alert", "error", alertErr)
+	}
+	return err
 }
 
 func NewRootCmd() (*cobra.Command, error) {
@@ -98,19 +713,76 @@ func NewRootCmd() (*cobra.Command, error) {
 
 	rootCmd := &cobra.Command{
 		Use: "reporter",
-		PreRunE: func(cmd *cobra.Command, args []string) error {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
 			// Configure debug mode
 			ctx = context.WithValue(ctx, configs.ContextKeyDebug, flags.Debug)
 
 			// Allow REPORTER_LOG_FORMAT to override when the flag was not set.
-			if !cmd.PersistentFlags().Changed("log-format") {
+			if !cmd.Flags().Changed("log-format") {
 				if v := viper.GetString("log_format"); v != "" {
 					flags.LogsFormat = v
 				}
 			}
 
+			// Bound the run, so a stuck fetch or backoff cannot outlive the
+			// schedule.
+			if !cmd.Flags().Changed("timeout") {
+				if v := viper.GetDuration("timeout"); v > 0 {
+					flags.Timeout = v
+				}
+			}
+			if flags.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+				cobra.OnFinalize(cancel)
+			}
+
+			// Allow REPORTER_FLARESOLVERR_WAIT, including 0, when the flag
+			// was not set.
+			if !cmd.Flags().Changed("flaresolverr-wait") {
+				if v := viper.GetString("flaresolverr_wait"); v != "" {
+					wait, err := time.ParseDuration(v)
+					if err != nil {
+						return fmt.Errorf("invalid flaresolverr wait: %w", err)
+					}
+					flags.FlareSolverrWait = wait
+				}
+			}
+
+			// Record or replay every HTTP exchange of the run
+			if flags.Record == "" {
+				flags.Record = viper.GetString("record")
+			}
+			if flags.Replay == "" {
+				flags.Replay = viper.GetString("replay")
+			}
+			switch {
+			case flags.Record != "" && flags.Replay != "":
+				return fmt.Errorf("record and replay cannot be used together")
+			case flags.Record != "":
+				recorder, err := recording.NewRecorder(flags.Record)
+				if err != nil {
+					return err
+				}
+				ctx = context.WithValue(ctx, configs.ContextKeyRecording, recording.Session(recorder))
+			case flags.Replay != "":
+				replayer, err := recording.NewReplayer(flags.Replay)
+				if err != nil {
+					return err
+				}
+				ctx = context.WithValue(ctx, configs.ContextKeyRecording, recording.Session(replayer))
+			}
+
+			// Collect what is fetched and parsed for the bundle of a failed run
+			if flags.Diagnostics == "" {
+				flags.Diagnostics = viper.GetString("diagnostics")
+			}
+			if flags.Diagnostics != "" {
+				ctx = context.WithValue(ctx, configs.ContextKeyDiagnostics, datasources.NewDiagnostics())
+			}
+
 			// Configure logger
 			loggerLevel := slog.LevelInfo
 			if flags.Debug {
@@ -135,40 +807,85 @@ func NewRootCmd() (*cobra.Command, error) {
 			slog.Debug("Configuring logger")
 			ctx = context.WithValue(ctx, configs.ContextKeyLogger, logger)
 
+			// Update context
+			cmd.SetContext(ctx)
+
+			return nil
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
 			// Validate flags
 			if err := flags.Validate(); err != nil {
 				return err
 			}
 
+			// Allow REPORTER_MAX_SOURCE_SPREAD when the flag was not set.
+			if !cmd.Flags().Changed("max-source-spread") {
+				if v := viper.GetString("max_source_spread"); v != "" {
+					spread, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						return fmt.Errorf("invalid max source spread: %w", err)
+					}
+					flags.MaxSourceSpread = spread
+				}
+			}
+
 			// Configure source
-			switch datasources.DataSourceType(flags.Source) {
-			case datasources.DataSourceTypeEthernets:
-				source, err := datasources.NewEthernetsDataSource(&datasources.EthernetsDataSourceOptions{
-					MaxRetries:        flags.MaxRetries,
-					InitialRetryDelay: flags.InitialRetryDelay,
-				})
+			ctx, err := configureSource(ctx, flags)
+			if err != nil {
+				return err
+			}
+
+			// Allow REPORTER_MAX_DAILY_CHANGE, including 0, when the flag was
+			// not set.
+			if !cmd.Flags().Changed("max-daily-change") {
+				if v := viper.GetString("max_daily_change"); v != "" {
+					change, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						return fmt.Errorf("invalid max daily change: %w", err)
+					}
+					flags.MaxDailyChange = change
+				}
+			}
+			if flags.MaxDailyChange < 0 {
+				return fmt.Errorf("invalid max daily change: %v", flags.MaxDailyChange)
+			}
+			if flags.Quarantine == "" {
+				flags.Quarantine = viper.GetString("quarantine")
+			}
+
+			// Compare the structure of the pages with the last good run
+			if flags.LayoutFingerprints == "" {
+				flags.LayoutFingerprints = viper.GetString("layout_fingerprints")
+			}
+			if flags.LayoutFingerprints != "" {
+				layout, err := datasources.LoadLayoutFingerprints(flags.LayoutFingerprints)
 				if err != nil {
-					return fmt.Errorf("failed to create ethernets data source: %w", err)
+					return err
 				}
-				ctx = context.WithValue(ctx, configs.ContextKeySource, source)
-			case datasources.DataSourceTypeEthernodes:
-				source, err := datasources.NewEthernodesDataSource(&datasources.EthernodesDataSourceOptions{
-					FlareSolverrURL:   flags.FlareSolverrURL,
-					MaxRetries:        flags.MaxRetries,
-					InitialRetryDelay: flags.InitialRetryDelay,
+				layout.Accept = flags.AcceptLayout
+				ctx = context.WithValue(ctx, configs.ContextKeyLayout, layout)
+			}
+
+			// Configure breakdown database
+			if len(flags.Breakdowns) > 0 {
+				breakdownDB, err := database.NewNotionBreakdownDB(ctx, database.NotionDBOptions{
+					DatabaseID: flags.NotionBreakdownDB,
+					Token:      flags.NotionToken,
+					HTTPClient: httpClient(ctx),
 				})
 				if err != nil {
-					return fmt.Errorf("failed to create ethernodes data source: %w", err)
+					return fmt.Errorf("failed to create notion breakdown db: %w", err)
 				}
-				ctx = context.WithValue(ctx, configs.ContextKeySource, source)
-			default:
-				return fmt.Errorf("invalid source: \"%s\"", flags.Source)
+				ctx = context.WithValue(ctx, configs.ContextKeyBreakdownDB, breakdownDB)
 			}
 
 			// Configure database
-			database, err := database.NewNotionDB(database.NotionDBOptions{
+			database, err := database.NewNotionDB(ctx, database.NotionDBOptions{
 				DatabaseID: flags.NotionDB,
 				Token:      flags.NotionToken,
+				HTTPClient: httpClient(ctx),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create notion db: %w", err)
@@ -176,24 +893,21 @@ func NewRootCmd() (*cobra.Command, error) {
 			ctx = context.WithValue(ctx, configs.ContextKeyDB, database)
 
 			// Configure slack notifier
-			slackNotifier, err := notifier.NewSlackNotifier(notifier.SlackNotifierOptions{
-				Token:   flags.SlackAppToken,
-				Channel: flags.SlackChannel,
-			})
+			ctx, err = configureSlackNotifier(ctx, flags)
 			if err != nil {
-				return fmt.Errorf("failed to create slack notifier: %w", err)
+				return err
 			}
-			ctx = context.WithValue(ctx, configs.ContextKeyNotifier, slackNotifier)
 
 			// Update context
 			cmd.SetContext(ctx)
 
 			return nil
 		},
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: withDiagnostics(flags, func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			source := ctx.Value(configs.ContextKeySource).(datasources.DataSource)
 			logger := ctx.Value(configs.ContextKeyLogger).(*slog.Logger)
+			breakdownDB, _ := ctx.Value(configs.ContextKeyBreakdownDB).(*database.NotionBreakdownDB)
 			database := ctx.Value(configs.ContextKeyDB).(*database.NotionDB)
 			clientType := configs.ClientTypeFromString(flags.Client)
 			if clientType == configs.ClientTypeUnknown {
@@ -201,12 +915,60 @@ func NewRootCmd() (*cobra.Command, error) {
 			}
 
 			// Updating data
-			if !flags.SkipUpdate {
-				logger.Info("Scanning client nodes")
-				clientData, err := source.GetClientData(clientType)
+			aggregate, _ := source.(*datasources.AggregateDataSource)
+			var reconciliation *datasources.Reconciliation
+			if !flags.SkipUpdate && flags.RecordAll {
+				logger.Info("Scanning client distribution", "layer", clientType.Layer())
+				var distribution datasources.Distribution
+				var err error
+				if aggregate != nil {
+					var reconciliations []datasources.Reconciliation
+					distribution, reconciliations, err = aggregate.ReconcileDistribution(ctx, clientType.Layer())
+					for i := range reconciliations {
+						if reconciliations[i].ClientName == clientType {
+							reconciliation = &reconciliations[i]
+						}
+					}
+				} else {
+					distribution, err = source.GetDistribution(ctx, clientType.Layer())
+				}
+				if err != nil {
+					return alertOnBlock(ctx, source, err)
+				}
+
+				rows, err := validateClientData(ctx, flags, source, database, distribution.ClientData())
 				if err != nil {
 					return err
 				}
+				for _, clientData := range rows {
+					logger.Info(
+						"Resulting client data",
+						"client", clientData.ClientName,
+						"clientTotal", clientData.ClientTotal,
+						"percentageOfNodes", fmt.Sprintf("%.2f%%", float64(clientData.ClientTotal)/float64(clientData.Total)*100),
+						"clientSynced", clientData.ClientSynced,
+					)
+
+					if err := database.AddClientData(ctx, clientData); err != nil {
+						return fmt.Errorf("failed to insert %s client data: %w", clientData.ClientName, err)
+					}
+				}
+
+				logger.Info("Client distribution added successfully", "clients", len(distribution.Clients), "total", distribution.Total, "totalSynced", distribution.TotalSynced)
+			} else if !flags.SkipUpdate {
+				logger.Info("Scanning client nodes")
+				var clientData datasources.ClientData
+				var err error
+				if aggregate != nil {
+					var clientReconciliation datasources.Reconciliation
+					clientData, clientReconciliation, err = aggregate.Reconcile(ctx, clientType)
+					reconciliation = &clientReconciliation
+				} else {
+					clientData, err = source.GetClientData(ctx, clientType)
+				}
+				if err != nil {
+					return alertOnBlock(ctx, source, err)
+				}
 
 				logger.Info(
 					"Resulting client data",
@@ -218,17 +980,86 @@ func NewRootCmd() (*cobra.Command, error) {
 					"percentageOfSynced", fmt.Sprintf("%.2f%%", float64(clientData.ClientSynced)/float64(clientData.TotalSynced)*100),
 					"syncedPercentage", fmt.Sprintf("%.2f%%", float64(clientData.ClientSynced)/float64(clientData.ClientTotal)*100),
 				)
+				if latest, ok := datasources.LatestVersion(clientData.Versions); ok {
+					logger.Info(
+						"Resulting version data",
+						"versions", len(clientData.Versions),
+						"latestVersion", latest.Version,
+						"latestTotal", latest.Total,
+						"latestSynced", latest.Synced,
+						"percentageOnLatest", fmt.Sprintf("%.2f%%", float64(latest.Total)/float64(clientData.ClientTotal)*100),
+					)
+				}
 
-				if err := database.AddClientData(clientData); err != nil {
-					return fmt.Errorf("failed to insert client data: %w", err)
+				rows, err := validateClientData(ctx, flags, source, database, []datasources.ClientData{clientData})
+				if err != nil {
+					return err
 				}
+				if len(rows) > 0 {
+					if err := database.AddClientData(ctx, clientData); err != nil {
+						return fmt.Errorf("failed to insert client data: %w", err)
+					}
+					logger.Info("Client data added successfully")
+				}
+			}
 
-				logger.Info("Client data added successfully")
+			// Updating breakdowns
+			var breakdowns []datasources.Breakdown
+			if breakdownDB != nil {
+				if !flags.SkipUpdate {
+					breakdownSource, ok := source.(datasources.BreakdownSource)
+					if !ok {
+						return fmt.Errorf("source %s does not publish breakdowns", flags.Source)
+					}
+
+					logger.Info("Scanning client breakdowns", "dimensions", flags.Breakdowns)
+					var err error
+					breakdowns, err = breakdownSource.GetBreakdowns(ctx, clientType, flags.dimensions())
+					if err != nil {
+						return alertOnBlock(ctx, source, fmt.Errorf("failed to get breakdowns: %w", err))
+					}
+					for _, breakdown := range breakdowns {
+						if err := breakdownDB.AddBreakdown(ctx, breakdown); err != nil {
+							return fmt.Errorf("failed to insert %s breakdown: %w", breakdown.Dimension, err)
+						}
+					}
+					logger.Info("Breakdowns added successfully", "count", len(breakdowns))
+				} else {
+					for _, dimension := range flags.dimensions() {
+						breakdown, ok, err := breakdownDB.GetLatestBreakdown(ctx, flags.Client, source.SourceType(), flags.network(), dimension)
+						if err != nil {
+							return fmt.Errorf("failed to get latest %s breakdown: %w", dimension, err)
+						}
+						if ok {
+							breakdowns = append(breakdowns, breakdown)
+						}
+					}
+				}
+
+				for _, breakdown := range breakdowns {
+					if top, ok := breakdown.Top(); ok {
+						logger.Info(
+							"Resulting breakdown",
+							"dimension", breakdown.Dimension,
+							"entries", len(breakdown.Entries),
+							"top", top.Label,
+							"topShare", fmt.Sprintf("%.2f%%", breakdown.Share(top)),
+						)
+					}
+				}
+			}
+
+			// The pages parsed, so their structure is the one the next run is
+			// compared with
+			if layout, ok := ctx.Value(configs.ContextKeyLayout).(*datasources.LayoutFingerprints); ok && !flags.SkipUpdate {
+				if err := layout.Save(); err != nil {
+					return err
+				}
 			}
 
 			// Reporting data
 			logger.Info("Getting historical data for reporting")
-			historicalData, err := database.GetLatestData(flags.Client, 35, datasources.DataSourceType(flags.Source))
+			historicalData, err := database.GetLatestData(ctx, flags.Client, 35, source.SourceType(), flags.network())
 			if err != nil {
 				return fmt.Errorf("failed to get historical data: %w", err)
 			}
@@ -237,9 +1068,12 @@ func NewRootCmd() (*cobra.Command, error) {
 			logger.Info("Sending report to Slack")
 			slackNotifier := ctx.Value(configs.ContextKeyNotifier).(*notifier.SlackNotifier)
 			if err := slackNotifier.SendReport(
+				ctx,
 				notifier.NotifierReport{
-					SourceName: source.SourceName(),
-					ClientData: historicalData,
+					SourceName:     source.SourceName(),
+					ClientData:     historicalData,
+					Breakdowns:     breakdowns,
+					Reconciliation: reconciliation,
 				},
 			); err != nil {
 				return fmt.Errorf("failed to send report: %w", err)
@@ -247,7 +1081,7 @@ func NewRootCmd() (*cobra.Command, error) {
 			logger.Info("Report sent successfully")
 
 			return nil
-		},
+		}),
 	}
 
 	viper.SetEnvPrefix("reporter")
@@ -259,13 +1093,22 @@ func NewRootCmd() (*cobra.Command, error) {
 	viper.BindEnv("log_format")
 	rootCmd.PersistentFlags().StringVarP(&flags.LogsFormat, "log-format", "f", "json", "logs format (json, text). environment variable: REPORTER_LOG_FORMAT")
 
+	// Timeout
+	viper.BindEnv("timeout")
+	rootCmd.PersistentFlags().DurationVar(&flags.Timeout, "timeout", 0, "abort the run after this long, e.g. 15m; 0 means no limit. environment variable: REPORTER_TIMEOUT")
+
 	// Source
-	rootCmd.PersistentFlags().StringVarP(&flags.Source, "source", "s", string(datasources.DataSourceTypeEthernodes), "source of the client nodes (ethernodes, ethernets)")
+	rootCmd.PersistentFlags().StringVarP(&flags.Source, "source", "s", string(datasources.DataSourceTypeEthernodes), "source of the client nodes (ethernodes, ethernets, file, aggregate, api, rpc, beacon)")
+	// Network
+	viper.BindEnv("network")
+	rootCmd.PersistentFlags().StringVarP(&flags.Network, "network", "n", "", "network to report on (mainnet, sepolia, holesky, hoodi). Only the mainnet sites are built in: on a testnet, ethernodes needs --ethernodes-url, api mappings read it as {network}, rpc and beacon nodes must run on it, and ethernets is not supported. environment variable: REPORTER_NETWORK")
 	// Client
 	rootCmd.PersistentFlags().StringVarP(&flags.Client, "client", "c", string(configs.ClientTypeNethermind), "client name")
 
 	// Skip Update
 	rootCmd.PersistentFlags().BoolVar(&flags.SkipUpdate, "skip-update", false, "skip updating data")
+	// Record All
+	rootCmd.PersistentFlags().BoolVar(&flags.RecordAll, "record-all", false, "record every client of the source's distribution for the layer of --client in one pass, including the long tail and \"Other\"")
 
 	// Notion DB
 	viper.BindEnv("notion_db")
@@ -274,6 +1117,12 @@ func NewRootCmd() (*cobra.Command, error) {
 	viper.BindEnv("notion_token")
 	rootCmd.PersistentFlags().StringVar(&flags.NotionToken, "notion-token", "", "notion token. environment variable: REPORTER_NOTION_TOKEN")
 
+	// Notion Breakdown DB
+	viper.BindEnv("notion_breakdown_db")
+	rootCmd.PersistentFlags().StringVar(&flags.NotionBreakdownDB, "notion-breakdown-db", "", "notion db for breakdowns, required with --breakdowns. environment variable: REPORTER_NOTION_BREAKDOWN_DB")
+	// Breakdowns
+	rootCmd.PersistentFlags().StringSliceVar(&flags.Breakdowns, "breakdowns", nil, "breakdowns of the client's nodes to record and report on (country, provider, os)")
+
 	// Slack App Token
 	viper.BindEnv("slack_app_token")
 	rootCmd.PersistentFlags().StringVar(&flags.SlackAppToken, "slack-app-token", "", "slack app token. environment variable: REPORTER_SLACK_APP_TOKEN")
@@ -282,13 +1131,94 @@ func NewRootCmd() (*cobra.Command, error) {
 	rootCmd.PersistentFlags().StringVar(&flags.SlackChannel, "slack-channel", "", "slack channel name or id. environment variable: REPORTER_SLACK_CHANNEL")
 
 	// FlareSolverr (optional). When set, all ethernodes.org fetches are routed
-	// through this v1 endpoint instead of going direct.
+	// through these v1 endpoints instead of going direct.
 	viper.BindEnv("flaresolverr_url")
-	rootCmd.PersistentFlags().StringVar(&flags.FlareSolverrURL, "flaresolverr-url", "", "FlareSolverr v1 endpoint (e.g. http://localhost:8191/v1). If set, ethernodes fetches go through it. environment variable: REPORTER_FLARESOLVERR_URL")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.FlareSolverrURLs, "flaresolverr-url", nil, "FlareSolverr v1 endpoints (e.g. http://localhost:8191/v1). If set, ethernodes fetches go through them, round-robin with failover. environment variable: REPORTER_FLARESOLVERR_URL")
+	viper.BindEnv("flaresolverr_wait")
+	rootCmd.PersistentFlags().DurationVar(&flags.FlareSolverrWait, "flaresolverr-wait", time.Minute, "how long to wait at startup for the FlareSolverr endpoints to report healthy; once one is, the others get 10s more, endpoints that are still not ready are skipped, and 0 skips the check. environment variable: REPORTER_FLARESOLVERR_WAIT")
+
+	// Diagnostics
+	viper.BindEnv("diagnostics")
+	rootCmd.PersistentFlags().StringVar(&flags.Diagnostics, "diagnostics", "", "on failure, write a diagnostics bundle (fetched pages, headers, fetch paths, timings and selector matches) to this directory, or to this file if it ends in .tar.gz. environment variable: REPORTER_DIAGNOSTICS")
+
+	// Proxies
+	viper.BindEnv("proxies")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.Proxies, "proxies", nil, "HTTP or SOCKS5 proxies (e.g. socks5://host:1080) rotated by the direct and FlareSolverr fetches, moving away from the ones Cloudflare blocks. environment variable: REPORTER_PROXIES")
+	viper.BindEnv("proxy_file")
+	rootCmd.PersistentFlags().StringVar(&flags.ProxyFile, "proxy-file", "", "file listing proxies, one per line, added to --proxies. environment variable: REPORTER_PROXY_FILE")
+
+	// Page archive
+	viper.BindEnv("archive")
+	rootCmd.PersistentFlags().StringVar(&flags.Archive, "archive", "", "directory to archive every fetched page to, keyed by URL, time and content hash, for the reparse command. environment variable: REPORTER_ARCHIVE")
+
+	// Record and replay
+	viper.BindEnv("record")
+	rootCmd.PersistentFlags().StringVar(&flags.Record, "record", "", "record every HTTP exchange of the run (sites, FlareSolverr, Notion, Slack) to this new directory, with credentials redacted. environment variable: REPORTER_RECORD")
+	viper.BindEnv("replay")
+	rootCmd.PersistentFlags().StringVar(&flags.Replay, "replay", "", "answer every HTTP request of the run from the recording in this directory instead of the network; credentials are then optional. environment variable: REPORTER_REPLAY")
+
+	// Aggregate
+	viper.BindEnv("aggregate_sources")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.AggregateSources, "aggregate-sources", nil, "sources the aggregate source scrapes and reconciles; defaults to ethernodes,ethernets. environment variable: REPORTER_AGGREGATE_SOURCES")
+	viper.BindEnv("max_source_spread")
+	rootCmd.PersistentFlags().Float64Var(&flags.MaxSourceSpread, "max-source-spread", 5, "largest gap, in percentage points, between the shares the aggregated sources give a client before the report warns that they diverge. environment variable: REPORTER_MAX_SOURCE_SPREAD")
+
+	// JSON API
+	viper.BindEnv("api_url")
+	rootCmd.PersistentFlags().StringVar(&flags.APIURL, "api-url", "", "base URL of the JSON API read by the api source, e.g. a public diversity API or a local stand-in. environment variable: REPORTER_API_URL")
+	viper.BindEnv("api_mapping")
+	rootCmd.PersistentFlags().StringVar(&flags.APIMapping, "api-mapping", "", "YAML file saying which endpoint the api source reads for each layer and where the figures are in its responses. environment variable: REPORTER_API_MAPPING")
+
+	// Our execution nodes
+	viper.BindEnv("rpc_urls")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.RPCURLs, "rpc-urls", nil, "JSON-RPC endpoints of our execution nodes, serving the admin and net namespaces, whose peers the rpc source counts. environment variable: REPORTER_RPC_URLS")
+
+	// Our beacon nodes
+	viper.BindEnv("beacon_urls")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.BeaconURLs, "beacon-urls", nil, "Beacon API URLs of our beacon nodes whose peers the beacon source counts. environment variable: REPORTER_BEACON_URLS")
+	viper.BindEnv("beacon_peers_path")
+	rootCmd.PersistentFlags().StringVar(&flags.BeaconPeersPath, "beacon-peers-path", "", "path of the peers endpoint of the beacon nodes; defaults to "+datasources.DefaultBeaconPeersPath+". environment variable: REPORTER_BEACON_PEERS_PATH")
+	viper.BindEnv("beacon_agent_field")
+	rootCmd.PersistentFlags().StringVar(&flags.BeaconAgentField, "beacon-agent-field", "", "dotted path of the agent string in each peer of the response; defaults to "+datasources.DefaultBeaconAgentField+". environment variable: REPORTER_BEACON_AGENT_FIELD")
+
+	// Saved pages
+	viper.BindEnv("file_path")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.FilePaths, "file-path", nil, "saved HTML pages, or directories of them, read by the file source. environment variable: REPORTER_FILE_PATH")
+	viper.BindEnv("file_format")
+	rootCmd.PersistentFlags().StringVar(&flags.FileFormat, "file-format", "", "site the pages read by the file source were saved from (ethernodes, ethernets); defaults to ethernodes. environment variable: REPORTER_FILE_FORMAT")
+
+	// Fetch strategy
+	viper.BindEnv("fetch_strategy")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.FetchStrategies, "fetch-strategy", nil, "how pages are fetched (auto, direct, flaresolverr, colly); several are tried in order. defaults to auto for ethernodes and colly for ethernets. environment variable: REPORTER_FETCH_STRATEGY")
+
+	// Extraction rules
+	viper.BindEnv("extraction_rules")
+	rootCmd.PersistentFlags().StringVar(&flags.ExtractionRules, "extraction-rules", "", "YAML file of extraction rules (selectors, labels, number parsing per page) replacing the built-in ones, to follow a change of the sites' markup without a release. environment variable: REPORTER_EXTRACTION_RULES")
+
+	// Validation
+	viper.BindEnv("max_daily_change")
+	rootCmd.PersistentFlags().Float64Var(&flags.MaxDailyChange, "max-daily-change", 0, "largest relative change of a count from its median over the client's rows of the week before, before the row is held back, e.g. 0.5 for 50%; 0, the default, only checks the invariants. environment variable: REPORTER_MAX_DAILY_CHANGE")
+	viper.BindEnv("quarantine")
+	rootCmd.PersistentFlags().StringVar(&flags.Quarantine, "quarantine", "", "file implausible rows are appended to, one JSON object per line, instead of failing the run. environment variable: REPORTER_QUARANTINE")
+
+	// Layout fingerprints
+	viper.BindEnv("layout_fingerprints")
+	rootCmd.PersistentFlags().StringVar(&flags.LayoutFingerprints, "layout-fingerprints", "", "file keeping the structure (headings, rows) and client labels of the pages of the last good run; a run whose pages lost some of the structure fails with \"upstream layout changed\", and missing client labels are warned about. environment variable: REPORTER_LAYOUT_FINGERPRINTS")
+	rootCmd.PersistentFlags().BoolVar(&flags.AcceptLayout, "accept-layout", false, "record the page structure of this run in --layout-fingerprints without comparing it, once a layout change has been checked")
+
+	// Ethernodes endpoints
+	viper.BindEnv("ethernodes_url")
+	rootCmd.PersistentFlags().StringVar(&flags.EthernodesURL, "ethernodes-url", "", "base URL to read the ethernodes pages from instead of the network's site, e.g. a caching mirror; required for testnets, whose sites are not built in. environment variable: REPORTER_ETHERNODES_URL")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.EthernodesMirrors, "ethernodes-mirrors", nil, "base URLs tried in order when a page cannot be read from the ethernodes site")
 
 	// Add these new flag bindings at the end of the flag configuration section
 	rootCmd.PersistentFlags().IntVar(&flags.MaxRetries, "max-retries", 3, "maximum number of retries for operations")
 	rootCmd.PersistentFlags().DurationVar(&flags.InitialRetryDelay, "retry-delay", time.Second, "initial delay between retry attempts")
 
+	// Subcommands
+	rootCmd.AddCommand(newForkReadinessCmd(flags))
+	rootCmd.AddCommand(newReparseCmd(flags))
+	rootCmd.AddCommand(newMigrateCmd(flags))
+
 	return rootCmd, nil
 }
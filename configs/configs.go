@@ -11,20 +11,134 @@ const (
 	ContextKeySource   ContextKey = "source"
 	ContextKeyDB       ContextKey = "database"
 	ContextKeyNotifier ContextKey = "notifier"
+	// Optional, only set when breakdowns are enabled
+	ContextKeyBreakdownDB ContextKey = "breakdown_database"
+	// Optional, only set when --diagnostics is
+	ContextKeyDiagnostics ContextKey = "diagnostics"
+	// Optional, only set when --record or --replay is
+	ContextKeyRecording ContextKey = "recording"
+	// Optional, only set when --layout-fingerprints is
+	ContextKeyLayout ContextKey = "layout"
 )
 
+// Networks
+type Network string
+
+const (
+	NetworkMainnet Network = "mainnet"
+	NetworkSepolia Network = "sepolia"
+	NetworkHolesky Network = "holesky"
+	NetworkHoodi   Network = "hoodi"
+)
+
+func NetworkFromString(s string) (Network, bool) {
+	switch strings.ToLower(s) {
+	case "mainnet":
+		return NetworkMainnet, true
+	case "sepolia":
+		return NetworkSepolia, true
+	case "holesky":
+		return NetworkHolesky, true
+	case "hoodi":
+		return NetworkHoodi, true
+	default:
+		return "", false
+	}
+}
+
+func (n Network) String() string {
+	switch n {
+	case NetworkSepolia:
+		return "Sepolia"
+	case NetworkHolesky:
+		return "Holesky"
+	case NetworkHoodi:
+		return "Hoodi"
+	default:
+		return "Mainnet"
+	}
+}
+
+// Layers
+type Layer string
+
+const (
+	LayerExecution Layer = "execution"
+	LayerConsensus Layer = "consensus"
+)
+
+func LayerFromString(s string) (Layer, bool) {
+	switch strings.ToLower(s) {
+	case "execution", "el":
+		return LayerExecution, true
+	case "consensus", "cl":
+		return LayerConsensus, true
+	default:
+		return "", false
+	}
+}
+
+// Short returns the abbreviation ethernodes uses in its URLs ("el", "cl").
+func (l Layer) Short() string {
+	if l == LayerConsensus {
+		return "cl"
+	}
+	return "el"
+}
+
+func (l Layer) String() string {
+	if l == LayerConsensus {
+		return "Consensus Layer"
+	}
+	return "Execution Layer"
+}
+
 // Clients
 type ClientType string
 
 const (
+	// Execution layer
 	ClientTypeNethermind ClientType = "nethermind"
 	ClientTypeGeth       ClientType = "geth"
 	ClientTypeBesu       ClientType = "besu"
 	ClientTypeErigon     ClientType = "erigon"
 	ClientTypeReth       ClientType = "reth"
+	// Consensus layer
+	ClientTypeLighthouse ClientType = "lighthouse"
+	ClientTypePrysm      ClientType = "prysm"
+	ClientTypeTeku       ClientType = "teku"
+	ClientTypeNimbus     ClientType = "nimbus"
+	ClientTypeLodestar   ClientType = "lodestar"
+	ClientTypeGrandine   ClientType = "grandine"
 	ClientTypeUnknown    ClientType = "unknown"
 )
 
+// ClientTypes lists every known client, in the order reports show them.
+var ClientTypes = []ClientType{
+	ClientTypeNethermind,
+	ClientTypeGeth,
+	ClientTypeBesu,
+	ClientTypeErigon,
+	ClientTypeReth,
+	ClientTypeLighthouse,
+	ClientTypePrysm,
+	ClientTypeTeku,
+	ClientTypeNimbus,
+	ClientTypeLodestar,
+	ClientTypeGrandine,
+}
+
+// ClientTypesOf returns the known clients of one layer.
+func ClientTypesOf(layer Layer) []ClientType {
+	var result []ClientType
+	for _, c := range ClientTypes {
+		if c.Layer() == layer {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
 func ClientTypeFromString(s string) ClientType {
 	switch strings.ToLower(s) {
 	case "nethermind":
@@ -37,11 +151,34 @@ func ClientTypeFromString(s string) ClientType {
 		return ClientTypeErigon
 	case "reth":
 		return ClientTypeReth
+	case "lighthouse":
+		return ClientTypeLighthouse
+	case "prysm":
+		return ClientTypePrysm
+	case "teku":
+		return ClientTypeTeku
+	case "nimbus":
+		return ClientTypeNimbus
+	case "lodestar":
+		return ClientTypeLodestar
+	case "grandine":
+		return ClientTypeGrandine
 	default:
 		return ClientTypeUnknown
 	}
 }
 
+// Layer returns the layer the client belongs to. Unknown clients default to
+// the execution layer, which is what every source tracked before layers.
+func (c ClientType) Layer() Layer {
+	switch c {
+	case ClientTypeLighthouse, ClientTypePrysm, ClientTypeTeku, ClientTypeNimbus, ClientTypeLodestar, ClientTypeGrandine:
+		return LayerConsensus
+	default:
+		return LayerExecution
+	}
+}
+
 func (c ClientType) String() string {
 	switch c {
 	case ClientTypeNethermind:
@@ -54,6 +191,18 @@ func (c ClientType) String() string {
 		return "Erigon"
 	case ClientTypeReth:
 		return "Reth"
+	case ClientTypeLighthouse:
+		return "Lighthouse"
+	case ClientTypePrysm:
+		return "Prysm"
+	case ClientTypeTeku:
+		return "Teku"
+	case ClientTypeNimbus:
+		return "Nimbus"
+	case ClientTypeLodestar:
+		return "Lodestar"
+	case ClientTypeGrandine:
+		return "Grandine"
 	default:
 		return "Unknown"
 	}
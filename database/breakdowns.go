@@ -0,0 +1,236 @@
+package database
+
+import (
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/datasources"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/jomei/notionapi"
+)
+
+const (
+	PropertyDimensionKey = "Dimension"
+	PropertyTopKey       = "Top"
+	PropertyTopShareKey  = "Top Share"
+	PropertyEntriesKey   = "Entries"
+)
+
+// NotionBreakdownDB stores Breakdowns in their own Notion database, one page
+// per client, dimension and run.
+type NotionBreakdownDB struct {
+	client   *notionapi.Client
+	database *notionapi.Database
+}
+
+// GetLatestBreakdown returns the most recent breakdown of a client by one
+// dimension, and false when none has been recorded yet.
+func (db *NotionBreakdownDB) GetLatestBreakdown(
+	ctx context.Context,
+	client string,
+	source datasources.DataSourceType,
+	network configs.Network,
+	dimension datasources.Dimension,
+) (datasources.Breakdown, bool, error) {
+	slog.Debug("Querying Notion breakdown database", "client", client, "source", source, "network", network, "dimension", dimension)
+
+	response, err := db.client.Database.Query(
+		ctx,
+		notionapi.DatabaseID(db.database.ID),
+		&notionapi.DatabaseQueryRequest{
+			Filter: notionapi.AndCompoundFilter{
+				&notionapi.PropertyFilter{
+					Property: PropertySourceKey,
+					Select: &notionapi.SelectFilterCondition{
+						Equals: string(source),
+					},
+				},
+				&notionapi.PropertyFilter{
+					Property: PropertyClientTypeKey,
+					Select: &notionapi.SelectFilterCondition{
+						Equals: client,
+					},
+				},
+				&notionapi.PropertyFilter{
+					Property: PropertyDimensionKey,
+					Select: &notionapi.SelectFilterCondition{
+						Equals: string(dimension),
+					},
+				},
+				networkFilter(network),
+			},
+			Sorts: []notionapi.SortObject{
+				{
+					Timestamp: notionapi.TimestampCreated,
+					Direction: notionapi.SortOrderDESC,
+				},
+			},
+			PageSize: 1,
+		},
+	)
+	if err != nil {
+		return datasources.Breakdown{}, false, err
+	}
+	if len(response.Results) == 0 {
+		return datasources.Breakdown{}, false, nil
+	}
+
+	breakdown, err := PageToBreakdown(&response.Results[0])
+	if err != nil {
+		return datasources.Breakdown{}, false, err
+	}
+	return breakdown, true, nil
+}
+
+func (db *NotionBreakdownDB) AddBreakdown(ctx context.Context, breakdown datasources.Breakdown) error {
+	pageProperties, err := BreakdownToPageProperties(breakdown)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.client.Page.Create(
+		ctx,
+		&notionapi.PageCreateRequest{
+			Parent: notionapi.Parent{
+				DatabaseID: notionapi.DatabaseID(db.database.ID.String()),
+			},
+			Properties: pageProperties,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// notionBreakdownDBProperties are the properties of a breakdown database
+// besides its title.
+var notionBreakdownDBProperties = func() notionapi.PropertyConfigs {
+	selectConfig := notionapi.SelectPropertyConfig{Type: notionapi.PropertyConfigTypeSelect}
+	numberConfig := notionapi.NumberPropertyConfig{Type: notionapi.PropertyConfigTypeNumber}
+	richTextConfig := notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+	return notionapi.PropertyConfigs{
+		PropertySourceKey:     selectConfig,
+		PropertyClientTypeKey: selectConfig,
+		PropertyLayerKey:      selectConfig,
+		PropertyNetworkKey:    selectConfig,
+		PropertyDimensionKey:  selectConfig,
+		PropertyTotalKey:      numberConfig,
+		PropertyTopKey:        richTextConfig,
+		PropertyTopShareKey:   numberConfig,
+		PropertyEntriesKey:    richTextConfig,
+	}
+}()
+
+// MigrateNotionBreakdownDB adds the properties of a breakdown database it
+// lacks, e.g. to a new database holding only its title.
+func MigrateNotionBreakdownDB(ctx context.Context, options NotionDBOptions) ([]string, error) {
+	return migrateProperties(ctx, options, notionBreakdownDBProperties)
+}
+
+func NewNotionBreakdownDB(ctx context.Context, options NotionDBOptions) (*NotionBreakdownDB, error) {
+	notionClient := newNotionClient(options)
+	database, err := notionClient.Database.Get(ctx, notionapi.DatabaseID(options.DatabaseID))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProperties(database, notionBreakdownDBProperties); err != nil {
+		return nil, err
+	}
+
+	return &NotionBreakdownDB{
+		notionClient,
+		database,
+	}, nil
+}
+
+func PageToBreakdown(page *notionapi.Page) (datasources.Breakdown, error) {
+	source, ok := GetSelectValue(page.Properties[PropertySourceKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse source property")
+	}
+
+	clientName, ok := GetSelectValue(page.Properties[PropertyClientTypeKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse client type property")
+	}
+
+	dimensionName, ok := GetSelectValue(page.Properties[PropertyDimensionKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse dimension property")
+	}
+	dimension, err := datasources.DimensionFromString(dimensionName)
+	if err != nil {
+		return datasources.Breakdown{}, err
+	}
+
+	total, ok := GetNumberValue(page.Properties[PropertyTotalKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse total property")
+	}
+
+	rawEntries, ok := GetRichTextValue(page.Properties[PropertyEntriesKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse entries property")
+	}
+	var entries []datasources.BreakdownEntry
+	if err := json.Unmarshal([]byte(rawEntries), &entries); err != nil {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse entries property: %w", err)
+	}
+
+	createdAt, ok := GetCreatedTimeValue(page.Properties[PropertyCreatedTimeKey])
+	if !ok {
+		return datasources.Breakdown{}, fmt.Errorf("failed to parse created time property")
+	}
+
+	network := configs.NetworkMainnet
+	if networkName, ok := GetSelectValue(page.Properties[PropertyNetworkKey]); ok && networkName != "" {
+		parsed, ok := configs.NetworkFromString(networkName)
+		if !ok {
+			return datasources.Breakdown{}, fmt.Errorf("failed to parse network property: %s", networkName)
+		}
+		network = parsed
+	}
+
+	clientType := configs.ClientTypeFromString(clientName)
+	return datasources.Breakdown{
+		Source:     source,
+		Network:    network,
+		Layer:      clientType.Layer(),
+		ClientName: clientType,
+		Dimension:  dimension,
+		Total:      total,
+		Entries:    entries,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+func BreakdownToPageProperties(breakdown datasources.Breakdown) (notionapi.Properties, error) {
+	pageProperties := make(notionapi.Properties, 10)
+
+	pageProperties[PropertyNameKey] = BuildTitleProperty(fmt.Sprintf("%s-%s-%s", breakdown.Source, breakdown.ClientName, breakdown.Dimension))
+	pageProperties[PropertySourceKey] = BuildSelectProperty(breakdown.Source)
+	pageProperties[PropertyClientTypeKey] = BuildSelectProperty(string(breakdown.ClientName))
+	pageProperties[PropertyLayerKey] = BuildSelectProperty(string(breakdown.Layer))
+	if breakdown.Network != "" {
+		pageProperties[PropertyNetworkKey] = BuildSelectProperty(string(breakdown.Network))
+	}
+	pageProperties[PropertyDimensionKey] = BuildSelectProperty(string(breakdown.Dimension))
+	pageProperties[PropertyTotalKey] = BuildNumberProperty(float64(breakdown.Total))
+
+	if top, ok := breakdown.Top(); ok {
+		pageProperties[PropertyTopKey] = BuildRichTextProperty(top.Label)
+		pageProperties[PropertyTopShareKey] = BuildNumberProperty(breakdown.Share(top))
+	}
+
+	entries, err := json.Marshal(breakdown.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entries: %w", err)
+	}
+	pageProperties[PropertyEntriesKey] = BuildRichTextProperty(string(entries))
+
+	return pageProperties, nil
+}
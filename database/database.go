@@ -1,9 +1,15 @@
 package database
 
 import (
+	"client-nodes-reporter/configs"
 	"client-nodes-reporter/datasources"
 	"context"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/jomei/notionapi"
 )
@@ -11,6 +17,17 @@ import (
 type NotionDBOptions struct {
 	DatabaseID string
 	Token      string
+	// HTTPClient of the Notion API requests; nil is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// newNotionClient creates the Notion API client of options.
+func newNotionClient(options NotionDBOptions) *notionapi.Client {
+	var clientOptions []notionapi.ClientOption
+	if options.HTTPClient != nil {
+		clientOptions = append(clientOptions, notionapi.WithHTTPClient(options.HTTPClient))
+	}
+	return notionapi.NewClient(notionapi.Token(options.Token), clientOptions...)
 }
 
 type NotionDB struct {
@@ -19,14 +36,17 @@ type NotionDB struct {
 }
 
 func (db *NotionDB) GetLatestData(
+	ctx context.Context,
 	client string,
 	pageSize int,
 	source datasources.DataSourceType,
+	network configs.Network,
 ) ([]datasources.ClientData, error) {
-	slog.Debug("Querying Notion database", "client", client, "pageSize", pageSize, "source", source)
-	
+	slog.Debug("Querying Notion database", "client", client, "pageSize", pageSize, "source", source, "network", network)
+
+
 	response, err := db.client.Database.Query(
-		context.Background(),
+		ctx,
 		notionapi.DatabaseID(db.database.ID),
 		&notionapi.DatabaseQueryRequest{
 			Filter: notionapi.AndCompoundFilter{
@@ -42,6 +62,7 @@ func (db *NotionDB) GetLatestData(
 						Equals: client,
 					},
 				},
+				networkFilter(network),
 			},
 			Sorts: []notionapi.SortObject{
 				{
@@ -72,14 +93,14 @@ func (db *NotionDB) GetLatestData(
 	return latestData, nil
 }
 
-func (db *NotionDB) AddClientData(clientData datasources.ClientData) error {
+func (db *NotionDB) AddClientData(ctx context.Context, clientData datasources.ClientData) error {
 	pageProperties, err := ClientDataToPageProperties(clientData)
 	if err != nil {
 		return err
 	}
 
 	_, err = db.client.Page.Create(
-		context.Background(),
+		ctx,
 		&notionapi.PageCreateRequest{
 			Parent: notionapi.Parent{
 				DatabaseID: notionapi.DatabaseID(db.database.ID.String()),
@@ -94,10 +115,102 @@ func (db *NotionDB) AddClientData(clientData datasources.ClientData) error {
 	return nil
 }
 
-func NewNotionDB(options NotionDBOptions) (*NotionDB, error) {
-	notionClient := notionapi.NewClient(notionapi.Token(options.Token))
-	database, err := notionClient.Database.Get(context.Background(), notionapi.DatabaseID(options.DatabaseID))
+// networkFilter matches rows of one network. Rows recorded before networks
+// were tracked have no network and are all mainnet.
+func networkFilter(network configs.Network) notionapi.Filter {
+	filter := &notionapi.PropertyFilter{
+		Property: PropertyNetworkKey,
+		Select: &notionapi.SelectFilterCondition{
+			Equals: string(network),
+		},
+	}
+	if network != configs.NetworkMainnet {
+		return filter
+	}
+	return notionapi.OrCompoundFilter{
+		filter,
+		&notionapi.PropertyFilter{
+			Property: PropertyNetworkKey,
+			Select: &notionapi.SelectFilterCondition{
+				IsEmpty: true,
+			},
+		},
+	}
+}
+
+// notionDBProperties are the properties added after the database was first
+// created.
+var notionDBProperties = notionapi.PropertyConfigs{
+	PropertyLayerKey: notionapi.SelectPropertyConfig{
+		Type: notionapi.PropertyConfigTypeSelect,
+	},
+	PropertyNetworkKey: notionapi.SelectPropertyConfig{
+		Type: notionapi.PropertyConfigTypeSelect,
+	},
+	PropertyVersionsKey: notionapi.RichTextPropertyConfig{
+		Type: notionapi.PropertyConfigTypeRichText,
+	},
+}
+
+// missingProperties returns the properties database does not have yet.
+func missingProperties(database *notionapi.Database, properties notionapi.PropertyConfigs) notionapi.PropertyConfigs {
+	missing := make(notionapi.PropertyConfigs)
+	for name, config := range properties {
+		if _, ok := database.Properties[name]; !ok {
+			missing[name] = config
+		}
+	}
+	return missing
+}
+
+// checkProperties fails when database lacks some of properties. The schema
+// is only changed by the migrate command, never as a side effect of a run.
+func checkProperties(database *notionapi.Database, properties notionapi.PropertyConfigs) error {
+	missing := missingProperties(database, properties)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("notion database lacks the properties %s; run the migrate command to add them", strings.Join(slices.Sorted(maps.Keys(missing)), ", "))
+}
+
+// migrateProperties adds the properties database lacks, and returns their
+// names.
+func migrateProperties(ctx context.Context, options NotionDBOptions, properties notionapi.PropertyConfigs) ([]string, error) {
+	client := newNotionClient(options)
+	database, err := client.Database.Get(ctx, notionapi.DatabaseID(options.DatabaseID))
+	if err != nil {
+		return nil, err
+	}
+
+	missing := missingProperties(database, properties)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	_, err = client.Database.Update(
+		ctx,
+		notionapi.DatabaseID(database.ID),
+		&notionapi.DatabaseUpdateRequest{Properties: missing},
+	)
 	if err != nil {
+		return nil, fmt.Errorf("failed to add properties to notion database: %w", err)
+	}
+	return slices.Sorted(maps.Keys(missing)), nil
+}
+
+// MigrateNotionDB adds the properties introduced after the database was
+// first created, so existing databases keep working. It needs the
+// integration to have update access.
+func MigrateNotionDB(ctx context.Context, options NotionDBOptions) ([]string, error) {
+	return migrateProperties(ctx, options, notionDBProperties)
+}
+
+func NewNotionDB(ctx context.Context, options NotionDBOptions) (*NotionDB, error) {
+	notionClient := newNotionClient(options)
+	database, err := notionClient.Database.Get(ctx, notionapi.DatabaseID(options.DatabaseID))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProperties(database, notionDBProperties); err != nil {
 		return nil, err
 	}
 
@@ -105,4 +218,4 @@ func NewNotionDB(options NotionDBOptions) (*NotionDB, error) {
 		notionClient,
 		database,
 	}, nil
-}
+}
\ No newline at end of file
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/jomei/notionapi"
 
@@ -18,6 +20,9 @@ const (
 	PropertyClientSyncedKey = "Client Synced"
 	PropertyClientTypeKey   = "Client"
 	PropertySourceKey       = "Source"
+	PropertyLayerKey        = "Layer"
+	PropertyNetworkKey      = "Network"
+	PropertyVersionsKey     = "Versions"
 	PropertyCreatedTimeKey  = "Created time"
 )
 
@@ -57,22 +62,59 @@ func PageToClientData(page *notionapi.Page) (datasources.ClientData, error) {
 		return datasources.ClientData{}, fmt.Errorf("failed to parse created time property")
 	}
 
+	// Rows recorded before layers were tracked are all execution layer.
+	layer := configs.LayerExecution
+	if layerName, ok := GetSelectValue(page.Properties[PropertyLayerKey]); ok && layerName != "" {
+		parsed, ok := configs.LayerFromString(layerName)
+		if !ok {
+			return datasources.ClientData{}, fmt.Errorf("failed to parse layer property: %s", layerName)
+		}
+		layer = parsed
+	}
+
+	// Rows recorded before networks were tracked are all mainnet.
+	network := configs.NetworkMainnet
+	if networkName, ok := GetSelectValue(page.Properties[PropertyNetworkKey]); ok && networkName != "" {
+		parsed, ok := configs.NetworkFromString(networkName)
+		if !ok {
+			return datasources.ClientData{}, fmt.Errorf("failed to parse network property: %s", networkName)
+		}
+		network = parsed
+	}
+
+	// Versions are stored as JSON; rows without it simply have none.
+	var versions []datasources.VersionCount
+	if raw, ok := GetRichTextValue(page.Properties[PropertyVersionsKey]); ok && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &versions); err != nil {
+			return datasources.ClientData{}, fmt.Errorf("failed to parse versions property: %w", err)
+		}
+	}
+
 	return datasources.ClientData{
 		Source:       source,
+		Network:      network,
+		Layer:        layer,
 		ClientName:   configs.ClientTypeFromString(clientName),
 		Total:        total,
 		ClientTotal:  clientTotal,
 		TotalSynced:  totalSynced,
 		ClientSynced: clientSynced,
+		Versions:     versions,
 		CreatedAt:    createdAt,
 	}, nil
 }
 
 func ClientDataToPageProperties(clientData datasources.ClientData) (notionapi.Properties, error) {
-	pageProperties := make(notionapi.Properties, 10)
+	pageProperties := make(notionapi.Properties, 11)
 
 	pageProperties[PropertyNameKey] = BuildTitleProperty(fmt.Sprintf("%s-%s", clientData.Source, clientData.ClientName))
 	pageProperties[PropertySourceKey] = BuildSelectProperty(clientData.Source)
+	if clientData.Layer != "" {
+		pageProperties[PropertyLayerKey] = BuildSelectProperty(string(clientData.Layer))
+	}
+	if clientData.Network != "" {
+		pageProperties[PropertyNetworkKey] = BuildSelectProperty(string(clientData.Network))
+	}
 
 	clientName := string(clientData.ClientName)
 	slog.Debug("Notion client name", "name", clientName)
@@ -83,5 +125,39 @@ func ClientDataToPageProperties(clientData datasources.ClientData) (notionapi.Pr
 	pageProperties[PropertyTotalSyncedKey] = BuildNumberProperty(float64(clientData.TotalSynced))
 	pageProperties[PropertyClientSyncedKey] = BuildNumberProperty(float64(clientData.ClientSynced))
 
+	if len(clientData.Versions) > 0 {
+		versions, err := encodeVersions(clientData.Versions)
+		if err != nil {
+			return nil, err
+		}
+		pageProperties[PropertyVersionsKey] = BuildRichTextProperty(versions)
+	}
+
 	return pageProperties, nil
 }
+
+// encodeVersions encodes versions as JSON that fits in a rich text property.
+// When a client runs so many versions that it would not, the versions with
+// the fewest nodes are left out.
+func encodeVersions(versions []datasources.VersionCount) (string, error) {
+	kept := slices.Clone(versions)
+	for {
+		encoded, err := json.Marshal(kept)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode versions: %w", err)
+		}
+		if len(encoded) <= RichTextMaxLength {
+			if dropped := len(versions) - len(kept); dropped > 0 {
+				slog.Warn("Left out the smallest versions to fit the versions property", "versions", len(versions), "dropped", dropped)
+			}
+			return string(encoded), nil
+		}
+		smallest := 0
+		for i, version := range kept {
+			if version.Total < kept[smallest].Total {
+				smallest = i
+			}
+		}
+		kept = slices.Delete(kept, smallest, smallest+1)
+	}
+}
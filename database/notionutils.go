@@ -1,7 +1,9 @@
 package database
 
 import (
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jomei/notionapi"
 )
@@ -21,6 +23,20 @@ func GetTitleValue(property notionapi.Property) (string, bool) {
 	return title.Title[0].PlainText, true
 }
 
+// GetRichTextValue joins the plain text of every rich text chunk.
+func GetRichTextValue(property notionapi.Property) (string, bool) {
+	richText, ok := property.(*notionapi.RichTextProperty)
+	if !ok {
+		return "", false
+	}
+
+	var text strings.Builder
+	for _, chunk := range richText.RichText {
+		text.WriteString(chunk.PlainText)
+	}
+	return text.String(), true
+}
+
 func GetCreatedTimeValue(property notionapi.Property) (time.Time, bool) {
 	createdTime, ok := property.(*notionapi.CreatedTimeProperty)
 	if !ok {
@@ -63,15 +79,41 @@ func BuildTitleProperty(title string) notionapi.Property {
 	}
 }
 
+// richTextChunkSize is the longest content Notion accepts in one rich text
+// object, and richTextMaxChunks the most objects it accepts in a property.
+const (
+	richTextChunkSize = 2000
+	richTextMaxChunks = 100
+)
+
+// RichTextMaxLength is the longest text BuildRichTextProperty can store.
+const RichTextMaxLength = richTextChunkSize * richTextMaxChunks
+
+// BuildRichTextProperty splits text into as many rich text objects as Notion
+// needs to store it, never within a character. Text longer than
+// RichTextMaxLength is rejected by Notion.
 func BuildRichTextProperty(text string) notionapi.Property {
+	chunks := make([]notionapi.RichText, 0, len(text)/richTextChunkSize+1)
+	for len(text) > richTextChunkSize {
+		cut := richTextChunkSize
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		chunks = append(chunks, buildRichText(text[:cut]))
+		text = text[cut:]
+	}
+	chunks = append(chunks, buildRichText(text))
+
 	return notionapi.RichTextProperty{
-		RichText: []notionapi.RichText{
-			{
-				Text: &notionapi.Text{
-					Content: text,
-					Link:    nil,
-				},
-			},
+		RichText: chunks,
+	}
+}
+
+func buildRichText(content string) notionapi.RichText {
+	return notionapi.RichText{
+		Text: &notionapi.Text{
+			Content: content,
+			Link:    nil,
 		},
 	}
 }
@@ -0,0 +1,287 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+// AggregateSourceName is how the aggregate of sources is named in reports.
+const AggregateSourceName = "Aggregate"
+
+// AggregateDataSourceOptions configure a data source reconciling the
+// distributions of several others.
+type AggregateDataSourceOptions struct {
+	// Sources are scraped in turn; each must publish the layer asked for.
+	Sources []DataSource
+	// MaxSpread is the largest gap, in percentage points, between the shares
+	// the sources give a client before the client is flagged as divergent.
+	MaxSpread float64
+}
+
+// AggregateDataSource scrapes several sources and reconciles what they
+// count, so a client has one share rather than one per source. Each source
+// counts a different set of nodes, so what is reconciled is the share of
+// each client: the reconciled counts are the mean of the sources' shares,
+// applied to the mean of their totals.
+type AggregateDataSource struct {
+	sources   []DataSource
+	maxSpread float64
+}
+
+// SourceShare is one source's view of a client in a Reconciliation.
+type SourceShare struct {
+	Source      string
+	Total       int64
+	ClientTotal int64
+	// Share is ClientTotal as a percentage of Total.
+	Share float64
+}
+
+// Reconciliation is how far the sources of an aggregate agree on a client.
+type Reconciliation struct {
+	ClientName configs.ClientType
+	Sources    []SourceShare
+	// Share is the mean of the sources' shares, the one the reconciled
+	// counts hold.
+	Share float64
+	// Spread is the gap between the highest and lowest share, in
+	// percentage points.
+	Spread float64
+	// Divergent is set when Spread is above the aggregate's MaxSpread.
+	Divergent bool
+}
+
+func NewAggregateDataSource(cfg *AggregateDataSourceOptions) (*AggregateDataSource, error) {
+	if len(cfg.Sources) < 2 {
+		return nil, fmt.Errorf("an aggregate needs at least two sources, got %d", len(cfg.Sources))
+	}
+	if cfg.MaxSpread < 0 {
+		return nil, fmt.Errorf("invalid max spread: %v", cfg.MaxSpread)
+	}
+	for _, source := range cfg.Sources {
+		if source.SourceType() == DataSourceTypeAggregate {
+			return nil, fmt.Errorf("an aggregate cannot hold another aggregate")
+		}
+	}
+	return &AggregateDataSource{sources: cfg.Sources, maxSpread: cfg.MaxSpread}, nil
+}
+
+// Close closes the sources holding resources for the run.
+func (a AggregateDataSource) Close() error {
+	var errs []error
+	for _, source := range a.sources {
+		if closer, ok := source.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a AggregateDataSource) SourceType() DataSourceType {
+	return DataSourceTypeAggregate
+}
+
+func (a AggregateDataSource) SourceName() string {
+	names := make([]string, 0, len(a.sources))
+	for _, source := range a.sources {
+		names = append(names, source.SourceName())
+	}
+	return fmt.Sprintf("%s (%s)", AggregateSourceName, strings.Join(names, ", "))
+}
+
+// normalisedClientName is the name rows of the same client are matched on
+// across sources: the known client type of the row, or its lowercased label.
+func normalisedClientName(row ClientCount) configs.ClientType {
+	if row.ClientName != configs.ClientTypeUnknown {
+		return row.ClientName
+	}
+	if clientName := configs.ClientTypeFromString(strings.TrimSpace(row.Name)); clientName != configs.ClientTypeUnknown {
+		return clientName
+	}
+	return configs.ClientType(strings.ToLower(strings.TrimSpace(row.Name)))
+}
+
+// sourceCounts sums the rows of a distribution by normalised client name.
+func sourceCounts(distribution Distribution) map[configs.ClientType]ClientCount {
+	counts := make(map[configs.ClientType]ClientCount)
+	for _, row := range distribution.Clients {
+		clientName := normalisedClientName(row)
+		count, ok := counts[clientName]
+		if !ok {
+			counts[clientName] = row
+			continue
+		}
+		count.Total += row.Total
+		if count.Synced < 0 || row.Synced < 0 {
+			count.Synced = -1
+		} else {
+			count.Synced += row.Synced
+		}
+		counts[clientName] = count
+	}
+	return counts
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// ReconcileDistribution scrapes the distribution of every source for a layer
+// and returns the reconciled one, with how far the sources agree on each of
+// its rows. A client a source does not list counts as none of its nodes.
+func (a AggregateDataSource) ReconcileDistribution(ctx context.Context, layer configs.Layer) (Distribution, []Reconciliation, error) {
+	distributions := make([]Distribution, 0, len(a.sources))
+	counts := make([]map[configs.ClientType]ClientCount, 0, len(a.sources))
+	var order []configs.ClientType
+	labels := make(map[configs.ClientType]string)
+	for _, source := range a.sources {
+		distribution, err := source.GetDistribution(ctx, layer)
+		if err != nil {
+			return Distribution{}, nil, fmt.Errorf("failed to get %s distribution: %w", source.SourceType(), err)
+		}
+		if distribution.Total <= 0 {
+			return Distribution{}, nil, fmt.Errorf("%s counted no %s nodes", source.SourceType(), layer)
+		}
+		distributions = append(distributions, distribution)
+		counts = append(counts, sourceCounts(distribution))
+		for _, row := range distribution.Clients {
+			clientName := normalisedClientName(row)
+			if _, ok := labels[clientName]; !ok {
+				labels[clientName] = row.Name
+				order = append(order, clientName)
+			}
+		}
+	}
+
+	var totals, totalsSynced []float64
+	for _, distribution := range distributions {
+		totals = append(totals, float64(distribution.Total))
+		if distribution.TotalSynced > 0 {
+			totalsSynced = append(totalsSynced, float64(distribution.TotalSynced))
+		}
+	}
+	total := int64(math.Round(mean(totals)))
+	totalSynced := int64(-1)
+	if len(totalsSynced) > 0 {
+		totalSynced = int64(math.Round(mean(totalsSynced)))
+	}
+
+	clients := make([]ClientCount, 0, len(order))
+	reconciliations := make([]Reconciliation, 0, len(order))
+	for _, clientName := range order {
+		reconciliation := Reconciliation{ClientName: clientName}
+		var shares, syncedShares []float64
+		for i, distribution := range distributions {
+			count := counts[i][clientName]
+			share := float64(count.Total) * 100 / float64(distribution.Total)
+			shares = append(shares, share)
+			reconciliation.Sources = append(reconciliation.Sources, SourceShare{
+				Source:      distribution.Source,
+				Total:       distribution.Total,
+				ClientTotal: count.Total,
+				Share:       share,
+			})
+			if distribution.TotalSynced > 0 && count.Synced >= 0 {
+				syncedShares = append(syncedShares, float64(count.Synced)/float64(distribution.TotalSynced))
+			}
+		}
+		reconciliation.Share = mean(shares)
+		reconciliation.Spread = slices.Max(shares) - slices.Min(shares)
+		reconciliation.Divergent = reconciliation.Spread > a.maxSpread
+		reconciliations = append(reconciliations, reconciliation)
+
+		row := ClientCount{
+			Name:       labels[clientName],
+			ClientName: configs.ClientTypeFromString(string(clientName)),
+			Total:      int64(math.Round(reconciliation.Share * float64(total) / 100)),
+			Synced:     -1,
+		}
+		if row.ClientName != configs.ClientTypeUnknown {
+			row.Name = row.ClientName.String()
+		}
+		if totalSynced >= 0 && len(syncedShares) > 0 {
+			row.Synced = int64(math.Round(mean(syncedShares) * float64(totalSynced)))
+		}
+		clients = append(clients, row)
+
+		if reconciliation.Divergent {
+			slog.Warn("Sources diverge on client share",
+				"client", string(clientName),
+				"share", fmt.Sprintf("%.2f%%", reconciliation.Share),
+				"spread", fmt.Sprintf("%.2fpp", reconciliation.Spread),
+				"maxSpread", fmt.Sprintf("%.2fpp", a.maxSpread),
+				"sources", reconciliation.Sources)
+		}
+	}
+
+	return Distribution{
+		Source:      string(a.SourceType()),
+		Network:     distributions[0].Network,
+		Layer:       layer,
+		Total:       total,
+		TotalSynced: totalSynced,
+		Clients:     clients,
+		CreatedAt:   time.Now(),
+	}, reconciliations, nil
+}
+
+// GetDistribution returns the reconciled distribution of the layer.
+func (a AggregateDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	distribution, _, err := a.ReconcileDistribution(ctx, layer)
+	return distribution, err
+}
+
+// Reconcile returns the reconciled counts of a client, with how far the
+// sources agree on them.
+func (a AggregateDataSource) Reconcile(ctx context.Context, clientName configs.ClientType) (ClientData, Reconciliation, error) {
+	distribution, reconciliations, err := a.ReconcileDistribution(ctx, clientName.Layer())
+	if err != nil {
+		return ClientData{}, Reconciliation{}, err
+	}
+
+	client, ok := distribution.Client(clientName)
+	if !ok {
+		return ClientData{}, Reconciliation{}, fmt.Errorf("client %s not listed by any of %s", clientName, a.SourceName())
+	}
+	i := slices.IndexFunc(reconciliations, func(r Reconciliation) bool { return r.ClientName == clientName })
+	reconciliation := reconciliations[i]
+
+	slog.Info("Successfully reconciled client data",
+		"client", clientName,
+		"clientTotal", client.Total,
+		"clientSynced", client.Synced,
+		"share", fmt.Sprintf("%.2f%%", reconciliation.Share),
+		"spread", fmt.Sprintf("%.2fpp", reconciliation.Spread),
+		"overallTotal", distribution.Total,
+		"overallSynced", distribution.TotalSynced)
+
+	return ClientData{
+		Source:       distribution.Source,
+		Network:      distribution.Network,
+		Layer:        distribution.Layer,
+		ClientName:   clientName,
+		Total:        distribution.Total,
+		ClientTotal:  client.Total,
+		TotalSynced:  distribution.TotalSynced,
+		ClientSynced: client.Synced,
+		CreatedAt:    distribution.CreatedAt,
+	}, reconciliation, nil
+}
+
+func (a AggregateDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	data, _, err := a.Reconcile(ctx, clientName)
+	return data, err
+}
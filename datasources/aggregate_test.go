@@ -0,0 +1,157 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+// staticSource returns a fixed distribution, or err.
+type staticSource struct {
+	distribution Distribution
+	err          error
+}
+
+func (s staticSource) SourceName() string {
+	return s.distribution.Source
+}
+
+func (s staticSource) SourceType() DataSourceType {
+	return DataSourceType(s.distribution.Source)
+}
+
+func (s staticSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	return ClientData{}, errors.New("not implemented")
+}
+
+func (s staticSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	return s.distribution, s.err
+}
+
+func TestReconcileDistribution(t *testing.T) {
+	ethernodes := Distribution{
+		Source:      "ethernodes",
+		Network:     configs.NetworkMainnet,
+		Total:       1000,
+		TotalSynced: 800,
+		Clients: []ClientCount{
+			{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 500, Synced: 400},
+			{Name: "go-ethereum", ClientName: configs.ClientTypeGeth, Total: 100, Synced: 80},
+			{Name: "nethermind", ClientName: configs.ClientTypeNethermind, Total: 300, Synced: 240},
+			{Name: "Other", ClientName: configs.ClientTypeUnknown, Total: 100, Synced: 80},
+		},
+	}
+	ethernets := Distribution{
+		Source:      "ethernets",
+		Network:     configs.NetworkMainnet,
+		Total:       2000,
+		TotalSynced: -1,
+		Clients: []ClientCount{
+			{Name: "Geth", ClientName: configs.ClientTypeGeth, Total: 1000, Synced: -1},
+			{Name: "Nethermind", ClientName: configs.ClientTypeNethermind, Total: 800, Synced: -1},
+			{Name: "Erigon", ClientName: configs.ClientTypeUnknown, Total: 200, Synced: -1},
+		},
+	}
+
+	aggregate, err := NewAggregateDataSource(&AggregateDataSourceOptions{
+		Sources:   []DataSource{staticSource{distribution: ethernodes}, staticSource{distribution: ethernets}},
+		MaxSpread: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	distribution, reconciliations, err := aggregate.ReconcileDistribution(context.Background(), configs.LayerExecution)
+	if err != nil {
+		t.Fatalf("ReconcileDistribution() error = %v", err)
+	}
+	if distribution.Total != 1500 || distribution.TotalSynced != 800 {
+		t.Errorf("totals = %d, %d; want the mean of the totals 1500 and of the known synced totals 800", distribution.Total, distribution.TotalSynced)
+	}
+
+	tests := []struct {
+		client     configs.ClientType
+		name       string
+		total      int64
+		synced     int64
+		share      float64
+		spread     float64
+		divergent  bool
+		clientName configs.ClientType
+	}{
+		// 60% and 50% of the nodes: 55% of 1500; synced 480 of 800.
+		{configs.ClientTypeGeth, "Geth", 825, 480, 55, 10, false, configs.ClientTypeGeth},
+		// 30% and 40%.
+		{configs.ClientTypeNethermind, "Nethermind", 525, 240, 35, 10, false, configs.ClientTypeNethermind},
+		// 10% and none.
+		{"other", "Other", 75, 80, 5, 10, false, configs.ClientTypeUnknown},
+		// None, so none synced, and 10%.
+		{configs.ClientTypeErigon, "Erigon", 75, 0, 5, 10, false, configs.ClientTypeErigon},
+	}
+	if len(distribution.Clients) != len(tests) || len(reconciliations) != len(tests) {
+		t.Fatalf("got %d rows and %d reconciliations, want %d", len(distribution.Clients), len(reconciliations), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(string(tt.client), func(t *testing.T) {
+			row := distribution.Clients[i]
+			if row.Name != tt.name || row.ClientName != tt.clientName || row.Total != tt.total || row.Synced != tt.synced {
+				t.Errorf("row = %+v, want %s (%q) with %d nodes, %d synced", row, tt.name, tt.clientName, tt.total, tt.synced)
+			}
+			reconciliation := reconciliations[i]
+			if reconciliation.ClientName != tt.client || math.Abs(reconciliation.Share-tt.share) > 1e-9 ||
+				math.Abs(reconciliation.Spread-tt.spread) > 1e-9 || reconciliation.Divergent != tt.divergent {
+				t.Errorf("reconciliation = %+v, want share %v, spread %v, divergent %v", reconciliation, tt.share, tt.spread, tt.divergent)
+			}
+		})
+	}
+}
+
+func TestReconcileDistributionDivergent(t *testing.T) {
+	a := Distribution{Source: "a", Total: 100, TotalSynced: -1, Clients: []ClientCount{{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 80, Synced: -1}}}
+	b := Distribution{Source: "b", Total: 100, TotalSynced: -1, Clients: []ClientCount{{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 40, Synced: -1}}}
+	aggregate, err := NewAggregateDataSource(&AggregateDataSourceOptions{
+		Sources:   []DataSource{staticSource{distribution: a}, staticSource{distribution: b}},
+		MaxSpread: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, reconciliation, err := aggregate.Reconcile(context.Background(), configs.ClientTypeGeth)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if !reconciliation.Divergent || reconciliation.Spread != 40 {
+		t.Errorf("reconciliation = %+v, want a divergent spread of 40", reconciliation)
+	}
+	if data.ClientTotal != 60 || data.TotalSynced != -1 || data.ClientSynced != -1 {
+		t.Errorf("client data = %+v, want 60 nodes and unknown synced counts", data)
+	}
+}
+
+func TestReconcileDistributionErrors(t *testing.T) {
+	valid := Distribution{Source: "a", Total: 100, Clients: []ClientCount{{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 100}}}
+	tests := []struct {
+		name   string
+		source staticSource
+	}{
+		{"source fails", staticSource{distribution: Distribution{Source: "b"}, err: errors.New("blocked")}},
+		{"source counts nothing", staticSource{distribution: Distribution{Source: "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregate, err := NewAggregateDataSource(&AggregateDataSourceOptions{Sources: []DataSource{staticSource{distribution: valid}, tt.source}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := aggregate.ReconcileDistribution(context.Background(), configs.LayerExecution); err == nil {
+				t.Error("ReconcileDistribution() error = nil, want one")
+			}
+		})
+	}
+
+	if _, err := NewAggregateDataSource(&AggregateDataSourceOptions{Sources: []DataSource{staticSource{distribution: valid}}}); err == nil {
+		t.Error("NewAggregateDataSource() with one source error = nil, want one")
+	}
+}
@@ -0,0 +1,396 @@
+package datasources
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"client-nodes-reporter/configs"
+)
+
+// APIMappingVersion is the version of the API mapping format this build
+// reads.
+const APIMappingVersion = 1
+
+// APISourceName is how an API source is named when its mapping has no name.
+const APISourceName = "API"
+
+// APIMapping says where the figures of a JSON client-diversity API are in
+// its responses.
+type APIMapping struct {
+	Version int `yaml:"version"`
+	// Name the source is reported under, e.g. "Miga Labs".
+	Name string `yaml:"name"`
+	// Header is sent with every request; ${VAR} is replaced by the
+	// environment variable VAR, so keys stay out of the file. Any other $,
+	// such as $VAR, is sent as is.
+	Header map[string]string `yaml:"header"`
+	// Clients lists, for each client, the names the API gives it besides its
+	// own.
+	Clients map[configs.ClientType][]string `yaml:"clients"`
+	// Layers maps each layer the API publishes, "execution" or "consensus",
+	// to its endpoint.
+	Layers map[string]*APIEndpoint `yaml:"layers"`
+
+	endpoints map[configs.Layer]*APIEndpoint
+}
+
+// APIEndpoint is the endpoint of one layer and where its figures are in the
+// response. Paths in the response are dotted, e.g. "data.clients" or
+// "result.0.count".
+type APIEndpoint struct {
+	// Path is appended to the base URL; {network} and {layer} are replaced.
+	Path string `yaml:"path"`
+	// Clients is where the clients are: an array of objects, or an object
+	// keyed by client name. Empty is the whole response.
+	Clients string `yaml:"clients"`
+	// Name is the client name in each object of an array.
+	Name string `yaml:"name"`
+	// Count is the node count in each client object; empty when the values
+	// of an object keyed by client name are the counts themselves.
+	Count string `yaml:"count"`
+	// Synced is the synced node count in each client object, if published.
+	Synced string `yaml:"synced"`
+	// Total and TotalSynced are the network totals; the sums of the clients
+	// when left out.
+	Total       string `yaml:"total"`
+	TotalSynced string `yaml:"totalSynced"`
+	// Scale multiplies every figure before it is rounded to a count, e.g.
+	// 100 for an API publishing percentages. 0 is 1.
+	Scale float64 `yaml:"scale"`
+}
+
+// LoadAPIMapping reads and validates an API mapping from a YAML file.
+func LoadAPIMapping(path string) (*APIMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api mapping: %w", err)
+	}
+	return ParseAPIMapping(data)
+}
+
+// ParseAPIMapping parses and validates a YAML API mapping.
+func ParseAPIMapping(data []byte) (*APIMapping, error) {
+	var mapping APIMapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse api mapping: %w", err)
+	}
+	if err := mapping.compile(); err != nil {
+		return nil, fmt.Errorf("invalid api mapping: %w", err)
+	}
+	return &mapping, nil
+}
+
+// compile validates the mapping and indexes its endpoints by layer.
+func (m *APIMapping) compile() error {
+	if m.Version != APIMappingVersion {
+		return fmt.Errorf("version %d is not supported, expected %d", m.Version, APIMappingVersion)
+	}
+	for client := range m.Clients {
+		if configs.ClientTypeFromString(string(client)) == configs.ClientTypeUnknown {
+			return fmt.Errorf("unknown client %q", string(client))
+		}
+	}
+	if len(m.Layers) == 0 {
+		return fmt.Errorf("no layers")
+	}
+	m.endpoints = make(map[configs.Layer]*APIEndpoint)
+	for name, endpoint := range m.Layers {
+		layer, ok := configs.LayerFromString(name)
+		if !ok {
+			return fmt.Errorf("unknown layer %q", name)
+		}
+		if endpoint == nil || endpoint.Path == "" {
+			return fmt.Errorf("%s: no path", name)
+		}
+		if endpoint.Scale < 0 {
+			return fmt.Errorf("%s: invalid scale %v", name, endpoint.Scale)
+		}
+		if endpoint.Scale == 0 {
+			endpoint.Scale = 1
+		}
+		m.endpoints[layer] = endpoint
+	}
+	return nil
+}
+
+// clientType returns the client the API names name, ClientTypeUnknown for
+// long-tail clients.
+func (m *APIMapping) clientType(name string, layer configs.Layer) configs.ClientType {
+	name = strings.TrimSpace(name)
+	for _, client := range configs.ClientTypesOf(layer) {
+		if strings.EqualFold(name, string(client)) || slices.ContainsFunc(m.Clients[client], func(alias string) bool {
+			return strings.EqualFold(name, alias)
+		}) {
+			return client
+		}
+	}
+	return configs.ClientTypeUnknown
+}
+
+// parse reads the client rows and totals out of a response of the
+// endpoint. A client listed twice, e.g. under two aliases, keeps both rows.
+func (e *APIEndpoint) parse(document any) (int64, int64, []ClientCount, error) {
+	list, ok := lookupJSON(document, e.Clients)
+	if !ok {
+		return -1, -1, nil, fmt.Errorf("no clients at %q", e.Clients)
+	}
+
+	var clients []ClientCount
+	row := func(name string, value any) error {
+		client := ClientCount{Name: name, Synced: -1}
+		count := value
+		if e.Count != "" {
+			var found bool
+			if count, found = lookupJSON(value, e.Count); !found {
+				return fmt.Errorf("client %s: no count at %q", name, e.Count)
+			}
+		}
+		var err error
+		if client.Total, err = jsonNumber(count, e.Scale); err != nil {
+			return fmt.Errorf("client %s: count: %w", name, err)
+		}
+		if e.Synced != "" {
+			synced, ok := lookupJSON(value, e.Synced)
+			if !ok {
+				return fmt.Errorf("client %s: no synced count at %q", name, e.Synced)
+			}
+			if client.Synced, err = jsonNumber(synced, e.Scale); err != nil {
+				return fmt.Errorf("client %s: synced count: %w", name, err)
+			}
+		}
+		clients = append(clients, client)
+		return nil
+	}
+
+	switch list := list.(type) {
+	case []any:
+		if e.Name == "" {
+			return -1, -1, nil, fmt.Errorf("clients at %q are an array, but the mapping has no name", e.Clients)
+		}
+		for i, item := range list {
+			name, ok := lookupJSON(item, e.Name)
+			if !ok {
+				return -1, -1, nil, fmt.Errorf("client %d: no name at %q", i, e.Name)
+			}
+			if err := row(fmt.Sprint(name), item); err != nil {
+				return -1, -1, nil, err
+			}
+		}
+	case map[string]any:
+		for _, name := range slices.Sorted(maps.Keys(list)) {
+			if err := row(name, list[name]); err != nil {
+				return -1, -1, nil, err
+			}
+		}
+	default:
+		return -1, -1, nil, fmt.Errorf("clients at %q are neither an array nor an object", e.Clients)
+	}
+	if len(clients) == 0 {
+		return -1, -1, nil, fmt.Errorf("no clients at %q", e.Clients)
+	}
+	slices.SortStableFunc(clients, func(a, b ClientCount) int { return cmp.Compare(b.Total, a.Total) })
+
+	total, err := e.total(document, e.Total, clients, func(c ClientCount) int64 { return c.Total })
+	if err != nil {
+		return -1, -1, nil, fmt.Errorf("total: %w", err)
+	}
+	totalSynced := int64(-1)
+	if e.TotalSynced != "" || e.Synced != "" {
+		if totalSynced, err = e.total(document, e.TotalSynced, clients, func(c ClientCount) int64 { return c.Synced }); err != nil {
+			return -1, -1, nil, fmt.Errorf("synced total: %w", err)
+		}
+	}
+	return total, totalSynced, clients, nil
+}
+
+// total reads the total at path, or sums the count of the clients when the
+// path is empty.
+func (e *APIEndpoint) total(document any, path string, clients []ClientCount, count func(ClientCount) int64) (int64, error) {
+	if path == "" {
+		var sum int64
+		for _, client := range clients {
+			sum += count(client)
+		}
+		return sum, nil
+	}
+	value, ok := lookupJSON(document, path)
+	if !ok {
+		return -1, fmt.Errorf("nothing at %q", path)
+	}
+	return jsonNumber(value, e.Scale)
+}
+
+// APIDataSourceOptions configure a data source reading a JSON API.
+type APIDataSourceOptions struct {
+	// BaseURL of the API, e.g. a public diversity API or a local stand-in.
+	BaseURL string
+	// Mapping says where the figures are in the responses.
+	Mapping           *APIMapping
+	Network           configs.Network
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+	// Archive, when set, keeps every response.
+	Archive *PageArchive
+	// Transport of the requests; nil is http.DefaultTransport.
+	Transport http.RoundTripper
+	// Fetcher, when set, replaces the API requests, e.g. to replay archived
+	// responses.
+	Fetcher Fetcher
+}
+
+// headerEnvPattern matches the ${VAR} references of a mapping header.
+var headerEnvPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandHeaderEnv replaces the ${VAR} references of a header value with the
+// environment. Unlike os.ExpandEnv, it leaves a bare $ or $VAR alone, as a
+// key may hold one.
+func expandHeaderEnv(value string) string {
+	return headerEnvPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		return os.Getenv(headerEnvPattern.FindStringSubmatch(reference)[1])
+	})
+}
+
+// APIDataSource reads client-diversity figures from a JSON API instead of
+// scraping pages, so there is no markup to break and no Cloudflare to get
+// past.
+type APIDataSource struct {
+	config  APIDataSourceOptions
+	fetcher Fetcher
+}
+
+func NewAPIDataSource(cfg *APIDataSourceOptions) (*APIDataSource, error) {
+	if cfg == nil || cfg.BaseURL == "" {
+		return nil, fmt.Errorf("api base url is required")
+	}
+	if cfg.Mapping == nil {
+		return nil, fmt.Errorf("api mapping is required")
+	}
+	config := *cfg
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	if config.Network == "" {
+		config.Network = configs.NetworkMainnet
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 3
+	}
+	if config.InitialRetryDelay < 0 {
+		config.InitialRetryDelay = 1 * time.Second
+	}
+
+	fetcher := config.Fetcher
+	if fetcher == nil {
+		header := make(http.Header)
+		for name, value := range config.Mapping.Header {
+			header.Set(name, expandHeaderEnv(value))
+		}
+		fetcher = &JSONFetcher{
+			Client:            &http.Client{Transport: config.Transport, Timeout: 30 * time.Second},
+			Header:            header,
+			MaxRetries:        config.MaxRetries,
+			InitialRetryDelay: config.InitialRetryDelay,
+		}
+		if config.Archive != nil {
+			fetcher = &ArchiveFetcher{Fetcher: fetcher, Archive: config.Archive}
+		}
+	}
+
+	return &APIDataSource{config: config, fetcher: fetcher}, nil
+}
+
+func (a APIDataSource) SourceType() DataSourceType {
+	return DataSourceTypeAPI
+}
+
+func (a APIDataSource) SourceName() string {
+	if a.config.Mapping.Name != "" {
+		return a.config.Mapping.Name
+	}
+	return APISourceName
+}
+
+// GetDistribution reads every client of the layer from its endpoint.
+func (a APIDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	endpoint, ok := a.config.Mapping.endpoints[layer]
+	if !ok {
+		return Distribution{}, fmt.Errorf("%s does not publish %s clients", a.SourceName(), layer)
+	}
+	url := a.config.BaseURL + strings.NewReplacer("{network}", string(a.config.Network), "{layer}", string(layer)).Replace(endpoint.Path)
+
+	body, err := a.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return Distribution{}, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return Distribution{}, fmt.Errorf("parse JSON from %s: %w", url, err)
+	}
+
+	total, totalSynced, clients, parseErr := endpoint.parse(document)
+	for i := range clients {
+		clients[i].ClientName = a.config.Mapping.clientType(clients[i].Name, layer)
+	}
+	recordMatches(ctx, url, "api", nil, map[string]any{"total": total, "totalSynced": totalSynced, "clients": clientRowLabels(clients)})
+	if parseErr != nil {
+		return Distribution{}, fmt.Errorf("failed to read %s: %w", url, parseErr)
+	}
+	if total <= 0 {
+		return Distribution{}, fmt.Errorf("could not extract total from %s", url)
+	}
+
+	slog.Info("Successfully retrieved API distribution",
+		"source", a.SourceName(),
+		"layer", layer,
+		"clients", len(clients),
+		"overallTotal", total,
+		"overallSynced", totalSynced)
+
+	return Distribution{
+		Source:      string(a.SourceType()),
+		Network:     a.config.Network,
+		Layer:       layer,
+		Total:       total,
+		TotalSynced: totalSynced,
+		Clients:     addOtherBucket(clients, total, totalSynced),
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (a APIDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	distribution, err := a.GetDistribution(ctx, clientName.Layer())
+	if err != nil {
+		return ClientData{}, err
+	}
+
+	client, ok := distribution.Client(clientName)
+	if !ok {
+		return ClientData{}, fmt.Errorf("client %s not listed by %s", clientName, a.SourceName())
+	}
+
+	// An API publishing no synced counts leaves them at -1.
+	return ClientData{
+		Source:       distribution.Source,
+		Network:      distribution.Network,
+		Layer:        distribution.Layer,
+		ClientName:   clientName,
+		Total:        distribution.Total,
+		ClientTotal:  client.Total,
+		TotalSynced:  distribution.TotalSynced,
+		ClientSynced: client.Synced,
+		CreatedAt:    distribution.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,285 @@
+package datasources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+func TestParseAPIMappingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		want    string
+	}{
+		{"version", "version: 2", "version 2 is not supported"},
+		{"unknown client", "version: 1\nclients: {parity: [openethereum]}\nlayers: {execution: {path: /x}}", `unknown client "parity"`},
+		{"no layers", "version: 1", "no layers"},
+		{"unknown layer", "version: 1\nlayers: {data: {path: /x}}", `unknown layer "data"`},
+		{"no path", "version: 1\nlayers: {execution: {clients: data}}", "execution: no path"},
+		{"negative scale", "version: 1\nlayers: {execution: {path: /x, scale: -1}}", "invalid scale -1"},
+		{"not yaml", "version: [", "failed to parse api mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAPIMapping([]byte(tt.mapping))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseAPIMapping() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIEndpointParse(t *testing.T) {
+	tests := []struct {
+		name            string
+		endpoint        APIEndpoint
+		response        string
+		wantTotal       int64
+		wantTotalSynced int64
+		wantClients     []ClientCount
+		wantErr         string
+	}{
+		{
+			name:            "array of objects",
+			endpoint:        APIEndpoint{Clients: "data.clients", Name: "client_name", Count: "node_count", Synced: "synced_count", Total: "data.total"},
+			response:        `{"data":{"total":1000,"clients":[{"client_name":"Teku","node_count":200,"synced_count":190},{"client_name":"Lighthouse","node_count":"400","synced_count":380}]}}`,
+			wantTotal:       1000,
+			wantTotalSynced: 570,
+			wantClients:     []ClientCount{{Name: "Lighthouse", Total: 400, Synced: 380}, {Name: "Teku", Total: 200, Synced: 190}},
+		},
+		{
+			name:            "object keyed by client name",
+			endpoint:        APIEndpoint{},
+			response:        `{"prysm":"1,024","lighthouse":2048}`,
+			wantTotal:       3072,
+			wantTotalSynced: -1,
+			wantClients:     []ClientCount{{Name: "lighthouse", Total: 2048, Synced: -1}, {Name: "prysm", Total: 1024, Synced: -1}},
+		},
+		{
+			name:            "percentages",
+			endpoint:        APIEndpoint{Clients: "result.0.shares", Scale: 100, Total: "result.0.total"},
+			response:        `{"result":[{"total":"100%","shares":{"teku":"12.5%","nimbus":7.46}}]}`,
+			wantTotal:       10000,
+			wantTotalSynced: -1,
+			wantClients:     []ClientCount{{Name: "teku", Total: 1250, Synced: -1}, {Name: "nimbus", Total: 746, Synced: -1}},
+		},
+		{
+			name:     "no clients",
+			endpoint: APIEndpoint{Clients: "data.clients"},
+			response: `{"data":{}}`,
+			wantErr:  `no clients at "data.clients"`,
+		},
+		{
+			name:     "array without name",
+			endpoint: APIEndpoint{Clients: "clients", Count: "count"},
+			response: `{"clients":[{"count":1}]}`,
+			wantErr:  "the mapping has no name",
+		},
+		{
+			name:     "missing count",
+			endpoint: APIEndpoint{Clients: "clients", Name: "name", Count: "count"},
+			response: `{"clients":[{"name":"teku"}]}`,
+			wantErr:  `client teku: no count at "count"`,
+		},
+		{
+			name:     "negative count",
+			endpoint: APIEndpoint{},
+			response: `{"teku":-1}`,
+			wantErr:  "invalid count -1",
+		},
+		{
+			name:     "missing total",
+			endpoint: APIEndpoint{Total: "total"},
+			response: `{"teku":1}`,
+			wantErr:  `total: nothing at "total"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.endpoint.Scale == 0 {
+				tt.endpoint.Scale = 1
+			}
+			decoder := json.NewDecoder(strings.NewReader(tt.response))
+			decoder.UseNumber()
+			var document any
+			if err := decoder.Decode(&document); err != nil {
+				t.Fatal(err)
+			}
+
+			total, totalSynced, clients, err := tt.endpoint.parse(document)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parse() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if total != tt.wantTotal || totalSynced != tt.wantTotalSynced {
+				t.Errorf("parse() totals = %d, %d; want %d, %d", total, totalSynced, tt.wantTotal, tt.wantTotalSynced)
+			}
+			if !slices.EqualFunc(clients, tt.wantClients, func(a, b ClientCount) bool {
+				return a.Name == b.Name && a.Total == b.Total && a.Synced == b.Synced
+			}) {
+				t.Errorf("parse() clients = %+v, want %+v", clients, tt.wantClients)
+			}
+		})
+	}
+}
+
+func TestExpandHeaderEnv(t *testing.T) {
+	t.Setenv("DIVERSITY_API_TOKEN", "secret")
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Bearer ${DIVERSITY_API_TOKEN}", "Bearer secret"},
+		{"${DIVERSITY_API_TOKEN}:${DIVERSITY_API_TOKEN}", "secret:secret"},
+		{"Bearer $DIVERSITY_API_TOKEN", "Bearer $DIVERSITY_API_TOKEN"},
+		{"pa$$word$", "pa$$word$"},
+		{"${UNSET_DIVERSITY_API_TOKEN}", ""},
+		{"${not a name}", "${not a name}"},
+		{"${DIVERSITY_API_TOKEN", "${DIVERSITY_API_TOKEN"},
+	}
+	for _, tt := range tests {
+		if got := expandHeaderEnv(tt.value); got != tt.want {
+			t.Errorf("expandHeaderEnv(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+const testAPIMapping = `
+version: 1
+name: Test API
+header:
+  Authorization: Bearer ${TEST_API_TOKEN}
+  X-Literal: key$1
+clients:
+  geth: [go-ethereum]
+layers:
+  execution:
+    path: /v1/{network}/{layer}
+    clients: data.clients
+    name: name
+    count: count
+    synced: synced
+    total: data.total
+`
+
+func TestAPIDataSource(t *testing.T) {
+	t.Setenv("TEST_API_TOKEN", "secret")
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Literal") != "key$1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/holesky/execution" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"total":1000,"clients":[
+			{"name":"go-ethereum","count":500,"synced":450},
+			{"name":"Nethermind","count":300,"synced":280},
+			{"name":"ethereumjs","count":50,"synced":10}
+		]}}`))
+	}))
+	defer server.Close()
+
+	mapping, err := ParseAPIMapping([]byte(testAPIMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewAPIDataSource(&APIDataSourceOptions{BaseURL: server.URL + "/", Mapping: mapping, Network: configs.NetworkHolesky})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.SourceName() != "Test API" {
+		t.Errorf("SourceName() = %q, want the name of the mapping", source.SourceName())
+	}
+
+	data, err := source.GetClientData(context.Background(), configs.ClientTypeNethermind)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	want := ClientData{Source: "api", Network: configs.NetworkHolesky, Layer: configs.LayerExecution, ClientName: configs.ClientTypeNethermind, Total: 1000, ClientTotal: 300, TotalSynced: 740, ClientSynced: 280}
+	data.CreatedAt, data.Versions = time.Time{}, nil
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("GetClientData() = %+v, want %+v", data, want)
+	}
+
+	distribution, err := source.GetDistribution(context.Background(), configs.LayerExecution)
+	if err != nil {
+		t.Fatalf("GetDistribution() error = %v", err)
+	}
+	var names []string
+	for _, client := range distribution.Clients {
+		names = append(names, client.Name+"/"+string(client.ClientName))
+	}
+	// The total holds 150 nodes beyond the listed clients.
+	if wantNames := []string{"go-ethereum/geth", "Nethermind/nethermind", "ethereumjs/unknown", "Other/unknown"}; !slices.Equal(names, wantNames) {
+		t.Errorf("GetDistribution() clients = %v, want %v", names, wantNames)
+	}
+
+	if _, err := source.GetDistribution(context.Background(), configs.LayerConsensus); err == nil {
+		t.Error("GetDistribution() of an unmapped layer error = nil, want one")
+	}
+	if len(requests) != 2 {
+		t.Errorf("sent %d requests, want 2: %v", len(requests), requests)
+	}
+}
+
+func TestAPIDataSourceWithoutSynced(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"lighthouse":"52.1%","prysm":"30%","teku":"17.9%"}`))
+	}))
+	defer server.Close()
+
+	mapping, err := ParseAPIMapping([]byte("version: 1\nlayers:\n  consensus:\n    path: /shares\n    scale: 100\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewAPIDataSource(&APIDataSourceOptions{BaseURL: server.URL, Mapping: mapping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := source.GetClientData(context.Background(), configs.ClientTypeLighthouse)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	if data.Total != 10000 || data.ClientTotal != 5210 || data.TotalSynced != -1 || data.ClientSynced != -1 {
+		t.Errorf("GetClientData() = %+v, want 5210 of 10000 and unknown synced counts", data)
+	}
+}
+
+func TestAPIDataSourceHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	mapping, err := ParseAPIMapping([]byte(testAPIMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewAPIDataSource(&APIDataSourceOptions{BaseURL: server.URL, Mapping: mapping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.GetClientData(context.Background(), configs.ClientTypeNethermind); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("GetClientData() error = %v, want the 401 of the API", err)
+	}
+}
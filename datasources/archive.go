@@ -0,0 +1,254 @@
+package datasources
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// archiveIndexFile lists every archived fetch, one JSON object per line.
+const archiveIndexFile = "index.jsonl"
+
+// PageArchive keeps every fetched page in a directory. Bodies are stored
+// once per content, under objects/<first two hash characters>/<sha256>.html,
+// and index.jsonl records which URL returned which body when, and in which
+// run.
+type PageArchive struct {
+	Dir string
+
+	run string
+	mu  sync.Mutex
+}
+
+// ArchivedPage is one fetch recorded in the archive.
+type ArchivedPage struct {
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Hash is the hex SHA-256 of the body.
+	Hash string `json:"hash"`
+	// Run identifies the reporter run that fetched the page.
+	Run string `json:"run"`
+}
+
+// ArchiveRun is the pages fetched by one reporter run.
+type ArchiveRun struct {
+	ID      string
+	Started time.Time
+	Pages   []ArchivedPage
+}
+
+// NewPageArchive opens the archive in dir, creating it when missing. Pages
+// stored through it are recorded under a new run.
+func NewPageArchive(dir string) (*PageArchive, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o755); err != nil {
+		return nil, fmt.Errorf("create page archive: %w", err)
+	}
+	return &PageArchive{Dir: dir, run: time.Now().UTC().Format("20060102T150405.000000000Z")}, nil
+}
+
+// OpenPageArchive opens an existing archive in dir to read it, failing when
+// dir holds none, e.g. because its path is mistyped.
+func OpenPageArchive(dir string) (*PageArchive, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open page archive: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("open page archive: %s is not a directory", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, archiveIndexFile)); err != nil {
+		return nil, fmt.Errorf("open page archive: %s is not an archive: %w", dir, err)
+	}
+	return &PageArchive{Dir: dir}, nil
+}
+
+func (a *PageArchive) objectPath(hash string) string {
+	return filepath.Join(a.Dir, "objects", hash[:2], hash+".html")
+}
+
+// Store archives the body fetched from url.
+func (a *PageArchive) Store(url string, body []byte) (ArchivedPage, error) {
+	sum := sha256.Sum256(body)
+	page := ArchivedPage{URL: url, FetchedAt: time.Now().UTC(), Hash: hex.EncodeToString(sum[:]), Run: a.run}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	path := a.objectPath(page.Hash)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return ArchivedPage{}, fmt.Errorf("create archive object directory: %w", err)
+		}
+		// Write then rename, so an interrupted run never leaves a truncated
+		// object under a valid hash.
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, body, 0o644); err != nil {
+			return ArchivedPage{}, fmt.Errorf("write archive object: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return ArchivedPage{}, fmt.Errorf("write archive object: %w", err)
+		}
+	}
+
+	line, err := json.Marshal(page)
+	if err != nil {
+		return ArchivedPage{}, fmt.Errorf("encode archive index entry: %w", err)
+	}
+	index, err := os.OpenFile(filepath.Join(a.Dir, archiveIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return ArchivedPage{}, fmt.Errorf("open archive index: %w", err)
+	}
+	defer index.Close()
+	if _, err := index.Write(append(line, '\n')); err != nil {
+		return ArchivedPage{}, fmt.Errorf("write archive index: %w", err)
+	}
+	return page, nil
+}
+
+// Pages returns every page of the archive in the order they were stored.
+func (a *PageArchive) Pages() ([]ArchivedPage, error) {
+	index, err := os.Open(filepath.Join(a.Dir, archiveIndexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open archive index: %w", err)
+	}
+	defer index.Close()
+
+	var pages []ArchivedPage
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var page ArchivedPage
+		if err := json.Unmarshal(scanner.Bytes(), &page); err != nil {
+			return nil, fmt.Errorf("decode archive index entry: %w", err)
+		}
+		pages = append(pages, page)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read archive index: %w", err)
+	}
+	return pages, nil
+}
+
+// Runs returns the pages of the archive grouped by run, oldest first.
+func (a *PageArchive) Runs() ([]ArchiveRun, error) {
+	pages, err := a.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []ArchiveRun
+	indexes := make(map[string]int)
+	for _, page := range pages {
+		i, ok := indexes[page.Run]
+		if !ok {
+			i = len(runs)
+			indexes[page.Run] = i
+			runs = append(runs, ArchiveRun{ID: page.Run, Started: page.FetchedAt})
+		}
+		if page.FetchedAt.Before(runs[i].Started) {
+			runs[i].Started = page.FetchedAt
+		}
+		runs[i].Pages = append(runs[i].Pages, page)
+	}
+	slices.SortStableFunc(runs, func(a, b ArchiveRun) int {
+		return a.Started.Compare(b.Started)
+	})
+	return runs, nil
+}
+
+// Read returns the body of an archived page, checking it against its hash.
+func (a *PageArchive) Read(page ArchivedPage) ([]byte, error) {
+	if len(page.Hash) < 2 {
+		return nil, fmt.Errorf("invalid archive hash: %q", page.Hash)
+	}
+	body, err := os.ReadFile(a.objectPath(page.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("read archived page: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != page.Hash {
+		return nil, fmt.Errorf("archived page of %s does not match its hash %s", page.URL, page.Hash)
+	}
+	return body, nil
+}
+
+// ArchiveFetcher stores every page Fetcher returns in Archive. A page that
+// cannot be archived is logged and still returned.
+type ArchiveFetcher struct {
+	Fetcher Fetcher
+	Archive *PageArchive
+}
+
+func (f *ArchiveFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	body, err := f.Fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if page, err := f.Archive.Store(url, body); err != nil {
+		slog.Warn("Failed to archive page", "url", url, "error", err)
+	} else {
+		slog.Debug("Archived page", "url", url, "hash", page.Hash)
+	}
+	return body, nil
+}
+
+func (f *ArchiveFetcher) Close() error {
+	return closeFetcher(f.Fetcher)
+}
+
+// ReplayFetcher serves the pages of one archived run instead of fetching
+// them. A URL that is not in the run is matched on its path and query alone,
+// so a page fetched from a mirror still replays.
+type ReplayFetcher struct {
+	Archive *PageArchive
+	Pages   []ArchivedPage
+}
+
+func (f *ReplayFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	if page, ok := f.find(url, false); ok {
+		return f.Archive.Read(page)
+	}
+	if page, ok := f.find(url, true); ok {
+		slog.Debug("Replaying page from another host", "url", url, "archived", page.URL)
+		return f.Archive.Read(page)
+	}
+	return nil, fmt.Errorf("%s is not in the archived run", url)
+}
+
+// find returns the last page of the run fetched from url, or with its path
+// and query when anyHost is set.
+func (f *ReplayFetcher) find(url string, anyHost bool) (ArchivedPage, bool) {
+	for i := len(f.Pages) - 1; i >= 0; i-- {
+		page := f.Pages[i]
+		if page.URL == url || (anyHost && samePathAndQuery(page.URL, url)) {
+			return page, true
+		}
+	}
+	return ArchivedPage{}, false
+}
+
+func samePathAndQuery(a, b string) bool {
+	parsedA, errA := neturl.Parse(a)
+	parsedB, errB := neturl.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return parsedA.EscapedPath() == parsedB.EscapedPath() && parsedA.RawQuery == parsedB.RawQuery
+}
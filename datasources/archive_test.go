@@ -0,0 +1,92 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPageArchive(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	if _, err := OpenPageArchive(dir); err == nil {
+		t.Error("OpenPageArchive() of an empty directory succeeded, want an error")
+	}
+
+	first, err := NewPageArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := &countingFetcher{body: "<html>main</html>"}
+	fetcher := &ArchiveFetcher{Fetcher: origin, Archive: first}
+	for range 2 {
+		if body, err := fetcher.Fetch(ctx, "https://ethernodes.org/"); err != nil || string(body) != origin.body {
+			t.Fatalf("Fetch() = %q, %v, want the page of the fetcher", body, err)
+		}
+	}
+	failing := &ArchiveFetcher{Fetcher: &countingFetcher{err: errors.New("connection reset")}, Archive: first}
+	if _, err := failing.Fetch(ctx, "https://ethernodes.org/client/execution/geth"); err == nil {
+		t.Error("Fetch() of a failing fetcher succeeded")
+	}
+
+	second, err := NewPageArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Store("https://ethernodes.org/", []byte("<html>main, later</html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := filepath.Glob(filepath.Join(dir, "objects", "*", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("archive holds %d objects, want the identical bodies stored once: %v", len(objects), objects)
+	}
+
+	opened, err := OpenPageArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := opened.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 || pages[0].Hash != pages[1].Hash || pages[1].Hash == pages[2].Hash {
+		t.Errorf("Pages() = %+v, want an entry for every fetch, the first two of the same body", pages)
+	}
+
+	runs, err := opened.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || len(runs[0].Pages) != 2 || len(runs[1].Pages) != 1 {
+		t.Fatalf("Runs() = %+v, want the two fetches of the first run, then the second run", runs)
+	}
+	if runs[0].ID != first.run || runs[1].ID != second.run || runs[0].Started.After(runs[1].Started) {
+		t.Errorf("Runs() = %+v, want the runs oldest first", runs)
+	}
+
+	replay := &ReplayFetcher{Archive: opened, Pages: runs[0].Pages}
+	if body, err := replay.Fetch(ctx, "https://mirror.example/"); err != nil || string(body) != origin.body {
+		t.Errorf("ReplayFetcher.Fetch() from a mirror = %q, %v, want the archived page", body, err)
+	}
+	if _, err := replay.Fetch(ctx, "https://ethernodes.org/client/execution/geth"); err == nil {
+		t.Error("ReplayFetcher.Fetch() of a page not in the run succeeded")
+	}
+
+	// An object changed on disk no longer matches the hash it is stored under.
+	if err := os.WriteFile(opened.objectPath(pages[2].Hash), []byte("<html>tampered</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opened.Read(pages[2]); err == nil || !strings.Contains(err.Error(), "does not match its hash") {
+		t.Errorf("Read() of a changed object = %v, want a hash mismatch", err)
+	}
+	if body, err := opened.Read(pages[0]); err != nil || string(body) != origin.body {
+		t.Errorf("Read() = %q, %v, want the archived body", body, err)
+	}
+}
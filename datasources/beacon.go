@@ -0,0 +1,213 @@
+package datasources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+const BeaconSourceName = "Beacon peers"
+
+// DefaultBeaconPeersPath lists the connected peers of a beacon node.
+const DefaultBeaconPeersPath = "/eth/v1/node/peers?state=connected"
+
+// DefaultBeaconAgentField is where a peer's agent string is in a peer
+// object of the response.
+const DefaultBeaconAgentField = "agent"
+
+// BeaconDataSourceOptions configure a data source reading the peers of our
+// own beacon nodes.
+type BeaconDataSourceOptions struct {
+	// URLs are the Beacon API base URLs of the nodes, which must run on
+	// Network.
+	URLs []string
+	// PeersPath is appended to each URL; DefaultBeaconPeersPath when empty.
+	PeersPath string
+	// AgentField is the dotted path of the agent string in each peer object;
+	// DefaultBeaconAgentField when empty.
+	AgentField        string
+	Network           configs.Network
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+	// Archive, when set, keeps every response.
+	Archive *PageArchive
+	// Transport of the requests; nil is http.DefaultTransport.
+	Transport http.RoundTripper
+	// Fetcher, when set, replaces the API requests, e.g. to replay archived
+	// responses.
+	Fetcher Fetcher
+}
+
+// BeaconDataSource counts the consensus clients of the peers of our own
+// beacon nodes by the agent string they announce. Like RPCDataSource, it is
+// our nodes' view of the network rather than a crawl of it.
+type BeaconDataSource struct {
+	config  BeaconDataSourceOptions
+	fetcher Fetcher
+}
+
+func NewBeaconDataSource(cfg *BeaconDataSourceOptions) (*BeaconDataSource, error) {
+	if cfg == nil || len(cfg.URLs) == 0 {
+		return nil, fmt.Errorf("at least one beacon node url is required")
+	}
+	config := *cfg
+	if config.PeersPath == "" {
+		config.PeersPath = DefaultBeaconPeersPath
+	}
+	if config.AgentField == "" {
+		config.AgentField = DefaultBeaconAgentField
+	}
+	if config.Network == "" {
+		config.Network = configs.NetworkMainnet
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 3
+	}
+	if config.InitialRetryDelay < 0 {
+		config.InitialRetryDelay = 1 * time.Second
+	}
+
+	fetcher := config.Fetcher
+	if fetcher == nil {
+		fetcher = &JSONFetcher{
+			Client:            &http.Client{Transport: config.Transport, Timeout: 30 * time.Second},
+			MaxRetries:        config.MaxRetries,
+			InitialRetryDelay: config.InitialRetryDelay,
+		}
+		if config.Archive != nil {
+			fetcher = &ArchiveFetcher{Fetcher: fetcher, Archive: config.Archive}
+		}
+	}
+
+	return &BeaconDataSource{config: config, fetcher: fetcher}, nil
+}
+
+func (b BeaconDataSource) SourceType() DataSourceType {
+	return DataSourceTypeBeacon
+}
+
+func (b BeaconDataSource) SourceName() string {
+	return BeaconSourceName
+}
+
+// getPeers returns the peer objects of the node at url: the "data" array of
+// the standard response, or the response itself when it is an array, as
+// with some clients' own peers endpoints.
+func (b BeaconDataSource) getPeers(ctx context.Context, url string) ([]any, error) {
+	body, err := b.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("parse JSON from %s: %w", redactedURL(url), err)
+	}
+
+	if peers, ok := document.([]any); ok {
+		return peers, nil
+	}
+	if peers, ok := lookupJSON(document, "data"); ok {
+		if peers, ok := peers.([]any); ok {
+			return peers, nil
+		}
+	}
+	return nil, fmt.Errorf("no peers in the response of %s", redactedURL(url))
+}
+
+// GetDistribution counts the peers of every node by client. A peer of
+// several of our nodes is counted once.
+func (b BeaconDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	if layer != configs.LayerConsensus {
+		return Distribution{}, fmt.Errorf("beacon nodes do not see %s clients", layer)
+	}
+
+	seen := make(map[string]bool)
+	var peers []PeerClient
+	var agents int
+	nodes := make([]string, 0, len(b.config.URLs))
+	for _, nodeURL := range b.config.URLs {
+		url := strings.TrimSuffix(nodeURL, "/") + b.config.PeersPath
+		nodes = append(nodes, redactedURL(url))
+		nodePeers, err := b.getPeers(ctx, url)
+		if err != nil {
+			return Distribution{}, err
+		}
+		slog.Info("Read beacon node peers", "node", redactedURL(nodeURL), "peers", len(nodePeers))
+
+		for _, peer := range nodePeers {
+			if id, ok := lookupJSON(peer, "peer_id"); ok {
+				if seen[fmt.Sprint(id)] {
+					continue
+				}
+				seen[fmt.Sprint(id)] = true
+			}
+			agent, _ := lookupJSON(peer, b.config.AgentField)
+			if agent, ok := agent.(string); ok && agent != "" {
+				agents++
+				peers = append(peers, ParsePeerClient(agent, layer))
+			} else {
+				peers = append(peers, ParsePeerClient("", layer))
+			}
+		}
+	}
+
+	rows := peerClientRows(peers)
+	recordMatches(ctx, strings.Join(nodes, " "), "beacon_peers", nil, map[string]any{"total": len(peers), "agents": agents, "clients": clientRowLabels(rows)})
+	if len(peers) == 0 {
+		return Distribution{}, fmt.Errorf("none of the %d beacon nodes has any peer", len(b.config.URLs))
+	}
+	// Peers without an agent are counted as "Other", but none having one
+	// means the nodes do not publish it where it is looked for.
+	if agents == 0 {
+		return Distribution{}, fmt.Errorf("none of the %d peers has an agent string at %q", len(peers), b.config.AgentField)
+	}
+
+	return Distribution{
+		Source:      string(b.SourceType()),
+		Network:     b.config.Network,
+		Layer:       layer,
+		Total:       int64(len(peers)),
+		TotalSynced: -1,
+		Clients:     rows,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (b BeaconDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	distribution, err := b.GetDistribution(ctx, clientName.Layer())
+	if err != nil {
+		return ClientData{}, err
+	}
+
+	// A client none of our nodes is connected to counts as zero peers.
+	client, _ := distribution.Client(clientName)
+
+	slog.Info("Successfully retrieved beacon peer data",
+		"client", clientName,
+		"clientTotal", client.Total,
+		"overallTotal", distribution.Total,
+		"versions", len(client.Versions))
+
+	return ClientData{
+		Source:      distribution.Source,
+		Network:     distribution.Network,
+		Layer:       distribution.Layer,
+		ClientName:  clientName,
+		Total:       distribution.Total,
+		ClientTotal: client.Total,
+		TotalSynced: distribution.TotalSynced,
+		// Peers announce no sync status.
+		ClientSynced: -1,
+		Versions:     client.Versions,
+		CreatedAt:    distribution.CreatedAt,
+	}, nil
+}
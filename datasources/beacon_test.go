@@ -0,0 +1,118 @@
+package datasources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+func newBeaconNode(t *testing.T, path, response string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RequestURI() != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBeaconDataSource(t *testing.T) {
+	first := newBeaconNode(t, DefaultBeaconPeersPath, `{"data":[
+		{"peer_id":"a","agent":"Lighthouse/v4.5.0-441fc16/x86_64-linux"},
+		{"peer_id":"b","agent":"teku/teku/v23.10.0/linux-x86_64/-eclipseadoptium-openjdk64bitservervm-java-17"},
+		{"peer_id":"c","agent":"Lighthouse/v4.6.0-rc.0/x86_64-linux"},
+		{"peer_id":"d"}
+	]}`)
+	second := newBeaconNode(t, DefaultBeaconPeersPath, `{"data":[
+		{"peer_id":"a","agent":"Lighthouse/v4.5.0-441fc16/x86_64-linux"},
+		{"peer_id":"e","agent":"js-libp2p/0.46.21/UserAgentNotSet"}
+	]}`)
+	source, err := NewBeaconDataSource(&BeaconDataSourceOptions{URLs: []string{first.URL + "/", second.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := source.GetClientData(context.Background(), configs.ClientTypeLighthouse)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	if data.Total != 5 || data.ClientTotal != 2 || data.TotalSynced != -1 || data.ClientSynced != -1 {
+		t.Errorf("GetClientData() = %+v, want 2 of 5 peers and unknown synced counts", data)
+	}
+	if len(data.Versions) != 2 || data.Versions[0].Version != "4.6.0-rc.0" {
+		t.Errorf("GetClientData() versions = %+v, want 4.6.0-rc.0 and 4.5.0", data.Versions)
+	}
+
+	distribution, err := source.GetDistribution(context.Background(), configs.LayerConsensus)
+	if err != nil {
+		t.Fatalf("GetDistribution() error = %v", err)
+	}
+	counts := make(map[string]int64)
+	for _, client := range distribution.Clients {
+		counts[client.Name] += client.Total
+	}
+	for name, want := range map[string]int64{"Lighthouse": 2, "Teku": 1, "Lodestar": 1, OtherClientsLabel: 1} {
+		if counts[name] != want {
+			t.Errorf("GetDistribution() %s = %d, want %d (%v)", name, counts[name], want, counts)
+		}
+	}
+
+	if _, err := source.GetDistribution(context.Background(), configs.LayerExecution); err == nil {
+		t.Error("GetDistribution() of the execution layer error = nil, want one")
+	}
+}
+
+func TestBeaconDataSourceClientEndpoint(t *testing.T) {
+	node := newBeaconNode(t, "/lighthouse/peers", `[
+		{"peer_id":"a","peer_info":{"client":{"agent_string":"Prysm/v5.0.0/abc"}}},
+		{"peer_id":"b","peer_info":{"client":{"agent_string":"nimbus"}}}
+	]`)
+	source, err := NewBeaconDataSource(&BeaconDataSourceOptions{
+		URLs:       []string{node.URL},
+		PeersPath:  "/lighthouse/peers",
+		AgentField: "peer_info.client.agent_string",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := source.GetClientData(context.Background(), configs.ClientTypePrysm)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	if data.Total != 2 || data.ClientTotal != 1 {
+		t.Errorf("GetClientData() = %+v, want 1 of 2 peers", data)
+	}
+}
+
+func TestBeaconDataSourceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"no agents", `{"data":[{"peer_id":"a"},{"peer_id":"b"}]}`, `none of the 2 peers has an agent string at "agent"`},
+		{"no peers", `{"data":[]}`, "has any peer"},
+		{"not peers", `{"data":{}}`, "no peers in the response"},
+		{"not json", `<html>`, "parse JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newBeaconNode(t, DefaultBeaconPeersPath, tt.response)
+			source, err := NewBeaconDataSource(&BeaconDataSourceOptions{URLs: []string{node.URL}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := source.GetDistribution(context.Background(), configs.LayerConsensus); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GetDistribution() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
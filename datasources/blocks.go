@@ -0,0 +1,253 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlockKind is the kind of anti-bot response that stopped a fetch.
+type BlockKind string
+
+const (
+	// BlockKindJSChallenge is Cloudflare's "Just a moment..." interstitial,
+	// which a real browser passes by running its script.
+	BlockKindJSChallenge BlockKind = "js-challenge"
+	// BlockKindTurnstile is a managed or interactive challenge with a
+	// Turnstile widget, which may need a human.
+	BlockKindTurnstile BlockKind = "turnstile"
+	// BlockKindFirewall is a firewall rule denying access, e.g. error 1020.
+	BlockKindFirewall BlockKind = "firewall"
+	// BlockKindRateLimit is HTTP 429 or Cloudflare error 1015.
+	BlockKindRateLimit BlockKind = "rate-limit"
+)
+
+// BlockAction is what to do about a block.
+type BlockAction string
+
+const (
+	// BlockActionWait retries the same way once RetryAfter has passed.
+	BlockActionWait BlockAction = "wait"
+	// BlockActionFlareSolverr retries through a real browser.
+	BlockActionFlareSolverr BlockAction = "flaresolverr"
+	// BlockActionGiveUp stops retrying; only a different egress or a human
+	// can get past the block.
+	BlockActionGiveUp BlockAction = "give-up"
+)
+
+// defaultRateLimitWait is the wait after a rate limit that does not say how
+// long to wait.
+const defaultRateLimitWait = 10 * time.Second
+
+// maxRateLimitWait is the longest Retry-After a fetcher waits out itself.
+const maxRateLimitWait = time.Minute
+
+// BlockError is returned by fetches that got an anti-bot page instead of
+// the content.
+type BlockError struct {
+	Kind BlockKind
+	URL  string
+	// Status is the HTTP status of the block page.
+	Status int
+	// RayID identifies the request in Cloudflare's logs, when present.
+	RayID string
+	// Code is the Cloudflare error code, e.g. 1020, or 0.
+	Code int
+	// RetryAfter is how long a rate limit asks to wait.
+	RetryAfter time.Duration
+	// ViaFlareSolverr is set when the block came back through FlareSolverr.
+	ViaFlareSolverr bool
+}
+
+func (e *BlockError) Error() string {
+	msg := fmt.Sprintf("cloudflare %s at %s (HTTP %d", e.Kind, e.URL, e.Status)
+	if e.Code != 0 {
+		msg += fmt.Sprintf(", error %d", e.Code)
+	}
+	if e.RayID != "" {
+		msg += ", ray " + e.RayID
+	}
+	msg += ")"
+	if e.ViaFlareSolverr {
+		msg += " via flaresolverr"
+	}
+	return msg
+}
+
+// Action returns what to do about the block. Challenges are handed to
+// FlareSolverr unless they came back through it already.
+func (e *BlockError) Action() BlockAction {
+	switch e.Kind {
+	case BlockKindRateLimit:
+		return BlockActionWait
+	case BlockKindJSChallenge, BlockKindTurnstile:
+		if e.ViaFlareSolverr {
+			return BlockActionGiveUp
+		}
+		return BlockActionFlareSolverr
+	default:
+		return BlockActionGiveUp
+	}
+}
+
+// Alert reports whether the block needs someone to act, such as moving the
+// egress or allow-listing it, rather than passing on its own.
+func (e *BlockError) Alert() bool {
+	return e.Action() == BlockActionGiveUp
+}
+
+// logLevel is the level blocks of this kind are logged at: challenges are
+// routine, the rest worth a look.
+func (e *BlockError) logLevel() slog.Level {
+	switch {
+	case e.Alert():
+		return slog.LevelError
+	case e.Kind == BlockKindRateLimit:
+		return slog.LevelWarn
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// BlockFrom returns the last BlockError in err's tree, which for a chain of
+// fetchers is the block of the last fetcher that got one.
+func BlockFrom(err error) (*BlockError, bool) {
+	var last *BlockError
+	var walk func(err error)
+	walk = func(err error) {
+		if block, ok := err.(*BlockError); ok {
+			last = block
+		}
+		switch unwrapped := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, err := range unwrapped.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			if err := unwrapped.Unwrap(); err != nil {
+				walk(err)
+			}
+		}
+	}
+	if err != nil {
+		walk(err)
+	}
+	return last, last != nil
+}
+
+var (
+	// cfErrorCodePattern matches the error code of Cloudflare's error pages,
+	// both the HTML ones and the plain "error code: 1020".
+	cfErrorCodePattern = regexp.MustCompile(`(?i)(?:cf-error-code">\s*|error code:?\s*|Error\s+)(1\d{3})\b`)
+	// cfRayIDPatterns match the Ray ID in the page footer or in the
+	// challenge options.
+	cfRayIDPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`Ray ID:\s*(?:<[^>]*>\s*)*([0-9a-f]{16})`),
+		regexp.MustCompile(`cRay:\s*'([0-9a-f]{16})'`),
+	}
+)
+
+var (
+	cfTurnstileMarkers = []string{"cf-turnstile", "challenges.cloudflare.com/turnstile", "cType: 'interactive'"}
+	cfChallengeMarkers = []string{"_cf_chl_opt", "/cdn-cgi/challenge-platform", "cf-browser-verification", "<title>Just a moment...</title>"}
+	cfFirewallMarkers  = []string{"Sorry, you have been blocked", "Attention Required! | Cloudflare", "used Cloudflare to restrict access"}
+)
+
+// classifyBlock returns the block a response is, or nil when it is not one.
+// Only markers of Cloudflare's own pages count, so content that merely
+// mentions Cloudflare is not mistaken for a block. Challenge markers only
+// count on a challenge response: Cloudflare adds its challenge platform
+// script to ordinary pages too. header may be nil.
+func classifyBlock(url string, status int, header http.Header, body []byte) *BlockError {
+	page := string(body)
+	block := &BlockError{URL: url, Status: status, RayID: rayID(header, page)}
+	mitigated := header != nil && header.Get("Cf-Mitigated") == "challenge"
+	challenged := mitigated || status == http.StatusForbidden || status == http.StatusServiceUnavailable
+
+	if matches := cfErrorCodePattern.FindStringSubmatch(page); matches != nil && hasCloudflareErrorPage(header, page) {
+		block.Code, _ = strconv.Atoi(matches[1])
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests || block.Code == 1015:
+		block.Kind = BlockKindRateLimit
+		block.RetryAfter = retryAfter(header)
+	case block.Code != 0 || containsAny(page, cfFirewallMarkers):
+		block.Kind = BlockKindFirewall
+	case challenged && containsAny(page, cfTurnstileMarkers):
+		block.Kind = BlockKindTurnstile
+	case mitigated || (challenged && containsAny(page, cfChallengeMarkers)):
+		block.Kind = BlockKindJSChallenge
+	default:
+		return nil
+	}
+	return block
+}
+
+// hasCloudflareErrorPage reports whether a page with an error code is one of
+// Cloudflare's, rather than content quoting an error code.
+func hasCloudflareErrorPage(header http.Header, page string) bool {
+	if strings.Contains(page, "cf-error-details") || strings.Contains(page, "cf-error-code") || containsAny(page, cfFirewallMarkers) {
+		return true
+	}
+	// Cloudflare's plain-text error bodies are only "error code: 1020".
+	return header != nil && header.Get("Cf-Ray") != "" && len(strings.TrimSpace(page)) < 64
+}
+
+func rayID(header http.Header, page string) string {
+	if header != nil {
+		if ray := header.Get("Cf-Ray"); ray != "" {
+			ray, _, _ = strings.Cut(ray, "-")
+			return ray
+		}
+	}
+	for _, pattern := range cfRayIDPatterns {
+		if matches := pattern.FindStringSubmatch(page); matches != nil {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// retryAfter reads the Retry-After header, in seconds or as a date.
+func retryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return defaultRateLimitWait
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return defaultRateLimitWait
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitOutRateLimit waits when err is a rate limit asking for no more than
+// maxRateLimitWait, and reports whether the fetch should be retried.
+func waitOutRateLimit(ctx context.Context, err error) bool {
+	var block *BlockError
+	if !errors.As(err, &block) || block.Action() != BlockActionWait || block.RetryAfter > maxRateLimitWait {
+		return false
+	}
+	slog.Warn("Rate limited, waiting before retrying", "url", block.URL, "wait", block.RetryAfter, "rayID", block.RayID)
+	return sleepContext(ctx, block.RetryAfter) == nil
+}
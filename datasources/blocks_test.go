@@ -0,0 +1,128 @@
+package datasources
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyBlock(t *testing.T) {
+	cfRay := http.Header{"Cf-Ray": {"8a1b2c3d4e5f6789-AMS"}}
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		body      string
+		wantKind  BlockKind
+		wantCode  int
+		wantRayID string
+		wantRetry time.Duration
+		wantNone  bool
+	}{
+		{
+			name:     "js challenge",
+			status:   http.StatusForbidden,
+			header:   cfRay,
+			body:     `<html><head><title>Just a moment...</title></head><body><script>window._cf_chl_opt={}</script></body></html>`,
+			wantKind: BlockKindJSChallenge, wantRayID: "8a1b2c3d4e5f6789",
+		},
+		{
+			name:     "js challenge on a 503",
+			status:   http.StatusServiceUnavailable,
+			body:     `<html><head><title>Just a moment...</title></head><body><script src="/cdn-cgi/challenge-platform/h/g/orchestrate/chl_page/v1"></script></body></html>`,
+			wantKind: BlockKindJSChallenge,
+		},
+		{
+			name:     "challenge by header",
+			status:   http.StatusForbidden,
+			header:   http.Header{"Cf-Mitigated": {"challenge"}},
+			body:     `<html></html>`,
+			wantKind: BlockKindJSChallenge,
+		},
+		{
+			name:     "turnstile",
+			status:   http.StatusForbidden,
+			body:     `<title>Just a moment...</title><div class="cf-turnstile"></div>`,
+			wantKind: BlockKindTurnstile,
+		},
+		{
+			name:     "firewall error page",
+			status:   http.StatusForbidden,
+			body:     `<title>Attention Required! | Cloudflare</title><div id="cf-error-details"><span class="cf-error-code">1020</span></div><span>Cloudflare Ray ID: <strong class="font-semibold">8a1b2c3d4e5f0000</strong></span>`,
+			wantKind: BlockKindFirewall, wantCode: 1020, wantRayID: "8a1b2c3d4e5f0000",
+		},
+		{
+			name:     "plain text error code",
+			status:   http.StatusForbidden,
+			header:   cfRay,
+			body:     "error code: 1020",
+			wantKind: BlockKindFirewall, wantCode: 1020, wantRayID: "8a1b2c3d4e5f6789",
+		},
+		{
+			name:     "rate limit",
+			status:   http.StatusTooManyRequests,
+			header:   http.Header{"Retry-After": {"30"}},
+			body:     "",
+			wantKind: BlockKindRateLimit, wantRetry: 30 * time.Second,
+		},
+		{
+			name:     "rate limit error page",
+			status:   http.StatusForbidden,
+			header:   cfRay,
+			body:     "error code: 1015",
+			wantKind: BlockKindRateLimit, wantCode: 1015, wantRayID: "8a1b2c3d4e5f6789", wantRetry: defaultRateLimitWait,
+		},
+		{
+			name:     "page quoting an error code",
+			status:   http.StatusOK,
+			body:     `<html><body><p>Cloudflare error 1020 means access was denied by a firewall rule. Most sites fix it by changing their rules.</p></body></html>`,
+			wantNone: true,
+		},
+		{
+			name:     "page mentioning cloudflare",
+			status:   http.StatusOK,
+			header:   cfRay,
+			body:     `<html><body><h4>Execution Layer Clients</h4><p>Served through Cloudflare.</p></body></html>`,
+			wantNone: true,
+		},
+		{
+			name:     "page with the challenge platform script",
+			status:   http.StatusOK,
+			header:   cfRay,
+			body:     `<html><body><h4>Execution Layer Clients</h4><script>(function(){var a=document.createElement('script');a.src='/cdn-cgi/challenge-platform/scripts/jsd/main.js';document.head.appendChild(a);})();</script></body></html>`,
+			wantNone: true,
+		},
+		{
+			name:     "turnstile widget on a page",
+			status:   http.StatusOK,
+			body:     `<form><div class="cf-turnstile" data-sitekey="0x4AAA"></div></form>`,
+			wantNone: true,
+		},
+		{
+			name:     "server error",
+			status:   http.StatusBadGateway,
+			body:     `<html><body>Bad gateway</body></html>`,
+			wantNone: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := classifyBlock("https://ethernodes.org/", tt.status, tt.header, []byte(tt.body))
+			if tt.wantNone {
+				if block != nil {
+					t.Errorf("classifyBlock() = %+v, want no block", block)
+				}
+				return
+			}
+			if block == nil {
+				t.Fatalf("classifyBlock() = nil, want a %s block", tt.wantKind)
+			}
+			if block.Kind != tt.wantKind || block.Code != tt.wantCode || block.RayID != tt.wantRayID || block.RetryAfter != tt.wantRetry {
+				t.Errorf("classifyBlock() = %+v, want kind %s, code %d, ray id %q, retry after %s", block, tt.wantKind, tt.wantCode, tt.wantRayID, tt.wantRetry)
+			}
+			if block.Status != tt.status || block.URL != "https://ethernodes.org/" {
+				t.Errorf("classifyBlock() = %+v, want the status and url of the response", block)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package datasources
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+// Dimension is an attribute nodes of a client can be broken down by.
+type Dimension string
+
+const (
+	DimensionCountry  Dimension = "country"
+	DimensionProvider Dimension = "provider"
+	DimensionOS       Dimension = "os"
+)
+
+// Dimensions lists every dimension, in the order reports show them.
+var Dimensions = []Dimension{
+	DimensionCountry,
+	DimensionProvider,
+	DimensionOS,
+}
+
+func DimensionFromString(s string) (Dimension, error) {
+	for _, d := range Dimensions {
+		if strings.EqualFold(s, string(d)) {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("invalid dimension: %s", s)
+}
+
+type BreakdownEntry struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// Breakdown is the share of a client's nodes per value of one dimension, e.g.
+// per country or per hosting provider. It is recorded as its own dataset next
+// to ClientData.
+type Breakdown struct {
+	Source     string
+	Network    configs.Network
+	Layer      configs.Layer
+	ClientName configs.ClientType
+	Dimension  Dimension
+	// Total is the client's node count the entries are shares of; it can be
+	// larger than the sum of the entries when the source only lists the top
+	// values.
+	Total     int64
+	Entries   []BreakdownEntry
+	CreatedAt time.Time
+}
+
+// Top returns the entry holding the most nodes.
+func (b Breakdown) Top() (BreakdownEntry, bool) {
+	if len(b.Entries) == 0 {
+		return BreakdownEntry{}, false
+	}
+	return slices.MaxFunc(b.Entries, func(x, y BreakdownEntry) int {
+		return cmp.Compare(x.Count, y.Count)
+	}), true
+}
+
+// Share returns the percentage of the client's nodes an entry holds.
+func (b Breakdown) Share(entry BreakdownEntry) float64 {
+	if b.Total <= 0 {
+		return 0
+	}
+	return float64(entry.Count) * 100 / float64(b.Total)
+}
+
+// NormalizeOS groups an OS label such as "linux-amd64", "darwin-arm64" or
+// "Windows" into the platforms we build releases for: Linux, Linux (arm),
+// macOS and Windows. Other labels are kept as they are.
+func NormalizeOS(label string) string {
+	lower := strings.ToLower(label)
+	arm := strings.Contains(lower, "arm") || strings.Contains(lower, "aarch64")
+	switch {
+	case strings.Contains(lower, "darwin") || strings.Contains(lower, "mac"):
+		return "macOS"
+	case strings.Contains(lower, "windows"):
+		return "Windows"
+	case strings.Contains(lower, "linux") && arm:
+		return "Linux (arm)"
+	case strings.Contains(lower, "linux"):
+		return "Linux"
+	default:
+		return label
+	}
+}
+
+// newBreakdown sorts the entries by count, largest first, and falls back to
+// their sum when the source published no total. OS entries are grouped by
+// NormalizeOS first.
+func newBreakdown(source string, network configs.Network, clientName configs.ClientType, dimension Dimension, total int64, entries []BreakdownEntry) Breakdown {
+	if dimension == DimensionOS {
+		entries = mergeEntries(entries, NormalizeOS)
+	}
+	slices.SortStableFunc(entries, func(x, y BreakdownEntry) int {
+		return cmp.Compare(y.Count, x.Count)
+	})
+	if total <= 0 {
+		total = 0
+		for _, entry := range entries {
+			total += entry.Count
+		}
+	}
+	return Breakdown{
+		Source:     source,
+		Network:    network,
+		Layer:      clientName.Layer(),
+		ClientName: clientName,
+		Dimension:  dimension,
+		Total:      total,
+		Entries:    entries,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// mergeEntries sums the entries whose labels normalize to the same value.
+func mergeEntries(entries []BreakdownEntry, normalize func(string) string) []BreakdownEntry {
+	merged := make([]BreakdownEntry, 0, len(entries))
+	indexes := make(map[string]int)
+	for _, entry := range entries {
+		label := normalize(entry.Label)
+		if i, ok := indexes[label]; ok {
+			merged[i].Count += entry.Count
+			continue
+		}
+		indexes[label] = len(merged)
+		merged = append(merged, BreakdownEntry{Label: label, Count: entry.Count})
+	}
+	return merged
+}
+
+// BreakdownSource is implemented by data sources that publish per-client
+// breakdowns by country, hosting provider and the like.
+type BreakdownSource interface {
+	GetBreakdowns(ctx context.Context, clientName configs.ClientType, dimensions []Dimension) ([]Breakdown, error)
+}
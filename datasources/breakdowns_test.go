@@ -0,0 +1,64 @@
+package datasources
+
+import (
+	"slices"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+func TestNormalizeOS(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"linux-amd64", "Linux"},
+		{"Linux", "Linux"},
+		{"linux-x86_64", "Linux"},
+		{"linux-arm64", "Linux (arm)"},
+		{"Linux aarch64", "Linux (arm)"},
+		{"darwin", "macOS"},
+		{"darwin-arm64", "macOS"},
+		{"MacOS", "macOS"},
+		{"windows-amd64", "Windows"},
+		{"FreeBSD", "FreeBSD"},
+		{"unknown", "unknown"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeOS(tt.label); got != tt.want {
+			t.Errorf("NormalizeOS(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestNewBreakdown(t *testing.T) {
+	entries := []BreakdownEntry{
+		{"darwin-arm64", 5},
+		{"linux-amd64", 40},
+		{"Linux", 30},
+		{"linux-arm64", 10},
+		{"unknown", 15},
+		{"darwin", 10},
+	}
+
+	// OS labels are grouped, largest first, and the total falls back to
+	// their sum.
+	got := newBreakdown("ethernodes", configs.NetworkMainnet, configs.ClientTypeNethermind, DimensionOS, -1, slices.Clone(entries))
+	want := []BreakdownEntry{{"Linux", 70}, {"macOS", 15}, {"unknown", 15}, {"Linux (arm)", 10}}
+	if !slices.Equal(got.Entries, want) {
+		t.Errorf("os entries = %v, want %v", got.Entries, want)
+	}
+	if got.Total != 110 || got.Layer != configs.LayerExecution {
+		t.Errorf("os breakdown total = %d, layer %s, want 110 on the execution layer", got.Total, got.Layer)
+	}
+	if top, _ := got.Top(); top.Label != "Linux" || got.Share(top) != float64(70)*100/110 {
+		t.Errorf("Top() = %v with a share of %.2f, want Linux", top, got.Share(top))
+	}
+
+	// Other dimensions keep their labels, and a published total is kept.
+	got = newBreakdown("ethernodes", configs.NetworkMainnet, configs.ClientTypeNethermind, DimensionCountry, 200, []BreakdownEntry{{"Germany", 20}, {"United States", 50}})
+	if want := []BreakdownEntry{{"United States", 50}, {"Germany", 20}}; !slices.Equal(got.Entries, want) || got.Total != 200 {
+		t.Errorf("country breakdown = %v of %d, want %v of 200", got.Entries, got.Total, want)
+	}
+}
@@ -0,0 +1,154 @@
+package datasources
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cfClearanceCookie is the cookie Cloudflare sets once a challenge is solved.
+const cfClearanceCookie = "cf_clearance"
+
+// Clearance holds the Cloudflare credentials of the FlareSolverr solves, by
+// the egress of the solve. Cloudflare only honours cf_clearance together with
+// the user agent and egress IP that solved the challenge, so a clearance is
+// only handed to requests going out through the same proxy, and dropped once
+// Cloudflare blocks that proxy.
+type Clearance struct {
+	// now is the clock of the solves and cookie expiries; nil is time.Now.
+	now func() time.Time
+
+	mu sync.RWMutex
+	// solves maps the proxy of a solve, nil when it went out directly, to
+	// its credentials.
+	solves map[*Proxy]clearanceSolve
+}
+
+type clearanceSolve struct {
+	userAgent string
+	cookies   []*http.Cookie
+	solvedAt  time.Time
+}
+
+func (c *Clearance) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// set replaces the credentials of proxy when the solve returned a
+// cf_clearance cookie. proxy is the egress of the solve, nil when it went out
+// directly.
+func (c *Clearance) set(userAgent string, cookies []flareSolverrCookie, proxy *Proxy) {
+	var converted []*http.Cookie
+	found := false
+	for _, cookie := range cookies {
+		if cookie.Name == cfClearanceCookie {
+			found = true
+		}
+		converted = append(converted, &http.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  time.Unix(int64(cookie.Expires), 0),
+			HttpOnly: cookie.HTTPOnly,
+			Secure:   cookie.Secure,
+		})
+	}
+	if !found || userAgent == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.solves == nil {
+		c.solves = make(map[*Proxy]clearanceSolve)
+	}
+	c.solves[proxy] = clearanceSolve{userAgent: userAgent, cookies: converted, solvedAt: c.clock()}
+}
+
+// discard drops the credentials of proxy, once Cloudflare has blocked a
+// request going out through it: the clearance no longer gets through.
+func (c *Clearance) discard(proxy *Proxy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.solves[proxy]; ok {
+		slog.Debug("Discarding Cloudflare clearance of a blocked egress", "proxy", proxy)
+		delete(c.solves, proxy)
+	}
+}
+
+// UserAgent returns the user agent that obtained the clearance of proxy, if
+// any.
+func (c *Clearance) UserAgent(proxy *Proxy) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	solve, ok := c.solves[proxy]
+	return solve.userAgent, ok
+}
+
+// Proxies returns the egresses holding a clearance, the latest solve first.
+// nil stands for a solve that went out directly.
+func (c *Clearance) Proxies() []*Proxy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	proxies := make([]*Proxy, 0, len(c.solves))
+	for proxy := range c.solves {
+		proxies = append(proxies, proxy)
+	}
+	slices.SortFunc(proxies, func(a, b *Proxy) int {
+		return c.solves[b].solvedAt.Compare(c.solves[a].solvedAt)
+	})
+	return proxies
+}
+
+// Cookies returns the unexpired cookies of the solve through proxy that
+// apply to host.
+func (c *Clearance) Cookies(proxy *Proxy, host string) []*http.Cookie {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock()
+	var cookies []*http.Cookie
+	for _, cookie := range c.solves[proxy].cookies {
+		if cookie.Expires.After(time.Unix(0, 0)) && cookie.Expires.Before(now) {
+			continue
+		}
+		domain := strings.TrimPrefix(cookie.Domain, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+// apply sets the user agent and cookies of the clearance of proxy on req,
+// which must go out through proxy, and reports whether it holds a
+// cf_clearance cookie for the request's host.
+func (c *Clearance) apply(req *http.Request, proxy *Proxy) bool {
+	userAgent, ok := c.UserAgent(proxy)
+	if !ok {
+		return false
+	}
+	cookies := c.Cookies(proxy, req.URL.Hostname())
+	cleared := false
+	for _, cookie := range cookies {
+		if cookie.Name == cfClearanceCookie {
+			cleared = true
+		}
+	}
+	if !cleared {
+		return false
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return true
+}
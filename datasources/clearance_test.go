@@ -0,0 +1,142 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func clearanceCookies(domain string, expires time.Time) []flareSolverrCookie {
+	return []flareSolverrCookie{
+		{Name: cfClearanceCookie, Value: "solved", Domain: domain, Path: "/", Expires: float64(expires.Unix())},
+		{Name: "__cf_bm", Value: "bot", Domain: domain, Path: "/"},
+	}
+}
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return names
+}
+
+func TestClearanceByProxy(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clearance := &Clearance{now: func() time.Time { return now }}
+	pool, err := NewProxyPool([]string{"http://a:1", "http://b:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := pool.proxies[0], pool.proxies[1]
+
+	// A solve without a cf_clearance cookie or a user agent is not kept.
+	clearance.set("Mozilla/5.0", []flareSolverrCookie{{Name: "__cf_bm", Value: "bot", Domain: ".ethernodes.org"}}, a)
+	clearance.set("", clearanceCookies(".ethernodes.org", now.Add(time.Hour)), a)
+	if proxies := clearance.Proxies(); len(proxies) != 0 {
+		t.Fatalf("Proxies() = %v, want none without a clearance", proxies)
+	}
+
+	clearance.set("Mozilla/5.0 (a)", clearanceCookies(".ethernodes.org", now.Add(time.Hour)), a)
+	now = now.Add(time.Minute)
+	clearance.set("Mozilla/5.0 (b)", clearanceCookies("ethernodes.org", now.Add(time.Hour)), b)
+	if got := clearance.Proxies(); !slices.Equal(got, []*Proxy{b, a}) {
+		t.Errorf("Proxies() = %v, want the latest solve first", got)
+	}
+
+	if userAgent, _ := clearance.UserAgent(a); userAgent != "Mozilla/5.0 (a)" {
+		t.Errorf("UserAgent(a) = %q, want the user agent of the solve through a", userAgent)
+	}
+	if _, ok := clearance.UserAgent(nil); ok {
+		t.Error("UserAgent(nil) is set, want no clearance for a direct request")
+	}
+	for _, tt := range []struct {
+		proxy *Proxy
+		host  string
+		want  []string
+	}{
+		{a, "ethernodes.org", []string{cfClearanceCookie, "__cf_bm"}},
+		{a, "www.ethernodes.org", []string{cfClearanceCookie, "__cf_bm"}},
+		{b, "ethernodes.org", []string{cfClearanceCookie, "__cf_bm"}},
+		{a, "notethernodes.org", nil},
+		{nil, "ethernodes.org", nil},
+	} {
+		if got := cookieNames(clearance.Cookies(tt.proxy, tt.host)); !slices.Equal(got, tt.want) {
+			t.Errorf("Cookies(%s, %s) = %v, want %v", tt.proxy, tt.host, got, tt.want)
+		}
+	}
+
+	// Once it expires, cf_clearance is dropped and the request goes without.
+	now = now.Add(time.Hour)
+	if got := cookieNames(clearance.Cookies(a, "ethernodes.org")); !slices.Equal(got, []string{"__cf_bm"}) {
+		t.Errorf("Cookies(a) after the expiry = %v, want only the session cookie", got)
+	}
+	req := httptest.NewRequest(http.MethodGet, "https://ethernodes.org/", nil)
+	if clearance.apply(req, a) {
+		t.Error("apply(a) after the expiry reports a clearance")
+	}
+
+	clearance.discard(b)
+	if got := clearance.Proxies(); !slices.Equal(got, []*Proxy{a}) {
+		t.Errorf("Proxies() after discarding b = %v, want only a", got)
+	}
+}
+
+func TestClearanceApply(t *testing.T) {
+	clearance := new(Clearance)
+	clearance.set("Mozilla/5.0 (solver)", clearanceCookies("ethernodes.org", time.Now().Add(time.Hour)), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "https://ethernodes.org/", nil)
+	req.Header.Set("User-Agent", browserUserAgent)
+	if !clearance.apply(req, nil) {
+		t.Fatal("apply() reports no clearance")
+	}
+	if got := req.Header.Get("User-Agent"); got != "Mozilla/5.0 (solver)" {
+		t.Errorf("User-Agent = %q, want the user agent of the solve", got)
+	}
+	if cookie, err := req.Cookie(cfClearanceCookie); err != nil || cookie.Value != "solved" {
+		t.Errorf("cf_clearance cookie = %v, %v, want the cookie of the solve", cookie, err)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "https://ethernets.io/", nil)
+	if clearance.apply(other, nil) || other.Header.Get("Cookie") != "" {
+		t.Error("apply() sends the clearance to another host")
+	}
+}
+
+func TestDirectFetcherDiscardsBlockedClearance(t *testing.T) {
+	var cookies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = append(cookies, r.Header.Get("Cookie"))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<html><head><title>Just a moment...</title></head><body><script>window._cf_chl_opt={}</script></body></html>`))
+	}))
+	defer server.Close()
+	serverURL, err := neturl.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clearance := new(Clearance)
+	clearance.set("Mozilla/5.0 (solver)", clearanceCookies(serverURL.Hostname(), time.Now().Add(time.Hour)), nil)
+	fetcher := &DirectFetcher{Client: server.Client(), Clearance: clearance, RequireClearance: true}
+
+	var block *BlockError
+	if _, err := fetcher.Fetch(context.Background(), server.URL); !errors.As(err, &block) {
+		t.Fatalf("Fetch() error = %v, want a BlockError", err)
+	}
+	if len(cookies) != 1 || cookies[0] == "" {
+		t.Errorf("requests sent cookies %q, want one request with the clearance", cookies)
+	}
+	if _, err := fetcher.Fetch(context.Background(), server.URL); !errors.Is(err, errNoClearance) {
+		t.Errorf("Fetch() after the block error = %v, want %v as the clearance is discarded", err, errNoClearance)
+	}
+	if len(cookies) != 1 {
+		t.Errorf("%d requests sent, want no request without a clearance", len(cookies))
+	}
+}
@@ -0,0 +1,44 @@
+package datasources
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// sleepContext waits for d, returning early with the context's error when it
+// is cancelled so backoffs do not outlive the run.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// contextTransport binds every request to ctx. colly v1 has no context
+// support of its own, so this is how its requests get cancelled.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// newCollector creates a colly collector whose requests go through transport,
+// http.DefaultTransport when nil, and are cancelled with ctx.
+func newCollector(ctx context.Context, transport http.RoundTripper, options ...func(*colly.Collector)) *colly.Collector {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c := colly.NewCollector(options...)
+	c.WithTransport(contextTransport{ctx: ctx, base: transport})
+	return c
+}
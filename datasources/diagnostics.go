@@ -0,0 +1,225 @@
+package datasources
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"client-nodes-reporter/configs"
+)
+
+// Diagnostics collects what a run fetched and what the parsers found in it,
+// so a failed run can be written out as a bundle and attached to a ticket.
+// It is carried in the context under configs.ContextKeyDiagnostics.
+type Diagnostics struct {
+	mu      sync.Mutex
+	started time.Time
+	fetches []FetchRecord
+	matches []SelectorMatch
+}
+
+// FetchRecord is one fetch attempt.
+type FetchRecord struct {
+	URL string `json:"url"`
+	// Fetcher is the fetch path: direct, flaresolverr or colly.
+	Fetcher string `json:"fetcher"`
+	// Via is the proxy or FlareSolverr endpoint used, if any.
+	Via      string      `json:"via,omitempty"`
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Started  time.Time   `json:"started"`
+	Duration string      `json:"duration"`
+	Error    string      `json:"error,omitempty"`
+	// Page is the file of the raw body in the bundle.
+	Page string `json:"page,omitempty"`
+
+	body []byte
+}
+
+// SelectorMatch is what a parser found on a page.
+type SelectorMatch struct {
+	URL    string `json:"url"`
+	Parser string `json:"parser"`
+	// Selectors counts the elements matching each selector the parsers rely
+	// on, so a layout change shows up as a zero.
+	Selectors map[string]int `json:"selectors"`
+	// Headings are the texts of the page's headings.
+	Headings []string `json:"headings,omitempty"`
+	// Found is what the parser extracted, e.g. the total and client labels.
+	Found map[string]any `json:"found,omitempty"`
+}
+
+// diagnosticSelectors are the selectors the ethernodes and ethernets parsers
+// rely on.
+var diagnosticSelectors = []string{"h2", "h4", ".progress-group", ".progress-group-header", ".fw-semibold", "span"}
+
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{started: time.Now()}
+}
+
+func diagnosticsFrom(ctx context.Context) *Diagnostics {
+	diagnostics, _ := ctx.Value(configs.ContextKeyDiagnostics).(*Diagnostics)
+	return diagnostics
+}
+
+// recordFetch adds a fetch to the diagnostics of ctx, if any.
+func recordFetch(ctx context.Context, record FetchRecord, body []byte, err error) {
+	diagnostics := diagnosticsFrom(ctx)
+	if diagnostics == nil {
+		return
+	}
+	record.Duration = time.Since(record.Started).String()
+	record.body = body
+	// The bundle is meant to be attached to tickets, so it carries no
+	// cookies such as cf_clearance.
+	if record.Header.Get("Set-Cookie") != "" {
+		record.Header = record.Header.Clone()
+		record.Header.Set("Set-Cookie", "[redacted]")
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	diagnostics.mu.Lock()
+	defer diagnostics.mu.Unlock()
+	diagnostics.fetches = append(diagnostics.fetches, record)
+}
+
+// recordMatches adds what parser found on the page at url to the
+// diagnostics of ctx, if any. doc is nil for documents that are not HTML,
+// such as API responses.
+func recordMatches(ctx context.Context, url, parser string, doc *goquery.Document, found map[string]any) {
+	diagnostics := diagnosticsFrom(ctx)
+	if diagnostics == nil {
+		return
+	}
+	match := SelectorMatch{URL: url, Parser: parser, Selectors: make(map[string]int), Found: found}
+	if doc != nil {
+		for _, selector := range diagnosticSelectors {
+			match.Selectors[selector] = doc.Find(selector).Length()
+		}
+		doc.Find("h1, h2, h3, h4, h5, h6").Each(func(_ int, h *goquery.Selection) {
+			if text := strings.Join(strings.Fields(h.Text()), " "); text != "" {
+				match.Headings = append(match.Headings, text)
+			}
+		})
+	}
+
+	diagnostics.mu.Lock()
+	defer diagnostics.mu.Unlock()
+	diagnostics.matches = append(diagnostics.matches, match)
+}
+
+// diagnosticsSummary is summary.json of a bundle.
+type diagnosticsSummary struct {
+	Error    string          `json:"error,omitempty"`
+	Started  time.Time       `json:"started"`
+	Duration string          `json:"duration"`
+	Fetches  []FetchRecord   `json:"fetches"`
+	Matches  []SelectorMatch `json:"matches"`
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Write writes the bundle of a run that failed with runErr below path and
+// returns where it went. A path ending in .tar.gz or .tgz is written as a
+// tarball; any other path is a directory that gets one timestamped
+// subdirectory per bundle. The bundle holds summary.json, with the fetches,
+// their headers, timings and the selector matches, and the raw body of
+// every fetched page under pages/.
+func (d *Diagnostics) Write(path string, runErr error) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	summary := diagnosticsSummary{
+		Started:  d.started,
+		Duration: time.Since(d.started).String(),
+		Matches:  d.matches,
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	files := make(map[string][]byte)
+	for i, fetch := range d.fetches {
+		if fetch.body != nil {
+			page := strings.TrimPrefix(strings.TrimPrefix(fetch.URL, "https://"), "http://")
+			name := strings.Trim(unsafePathChars.ReplaceAllString(page, "_"), "_")
+			fetch.Page = fmt.Sprintf("pages/%03d-%s-%s.html", i+1, fetch.Fetcher, name)
+			files[fetch.Page] = fetch.body
+		}
+		summary.Fetches = append(summary.Fetches, fetch)
+	}
+	encoded, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode diagnostics summary: %w", err)
+	}
+	files["summary.json"] = encoded
+
+	name := "diagnostics-" + d.started.UTC().Format("20060102T150405Z")
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		return path, writeTarball(path, name, files)
+	}
+
+	dir := filepath.Join(path, name)
+	for file, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return "", fmt.Errorf("create diagnostics directory: %w", err)
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return "", fmt.Errorf("write diagnostics file: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+func writeTarball(path, prefix string, files map[string][]byte) (err error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create diagnostics directory: %w", err)
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create diagnostics tarball: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("close diagnostics tarball: %w", closeErr)
+		}
+	}()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		content := files[name]
+		header := &tar.Header{Name: prefix + "/" + name, Mode: 0o644, Size: int64(len(content)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("write diagnostics tarball: %w", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return fmt.Errorf("write diagnostics tarball: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("write diagnostics tarball: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("write diagnostics tarball: %w", err)
+	}
+	return nil
+}
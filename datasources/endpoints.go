@@ -0,0 +1,126 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+// ethernodesNetworkURLs maps each network to its ethernodes site. Only the
+// mainnet site is known; the site of a testnet is given as the base URL.
+var ethernodesNetworkURLs = map[configs.Network]string{
+	configs.NetworkMainnet: "https://ethernodes.org",
+}
+
+// ethernodesNetworkMirrors are the other hosts serving the same pages as the
+// site of a network.
+var ethernodesNetworkMirrors = map[configs.Network][]string{
+	configs.NetworkMainnet: {"https://www.ethernodes.org"},
+}
+
+// EthernodesPaths are the paths of the ethernodes pages relative to a base
+// URL. "{layer}" is replaced by "el" or "cl" and "{client}" by the client's
+// URL name.
+type EthernodesPaths struct {
+	Main         string
+	Client       string
+	SyncedClient string
+	Sync         string
+}
+
+var DefaultEthernodesPaths = EthernodesPaths{
+	Main:         "/",
+	Client:       "/client/{layer}/{client}",
+	SyncedClient: "/client/{layer}/{client}?synced=1",
+	Sync:         "/sync",
+}
+
+// withDefaults fills the paths left empty from DefaultEthernodesPaths.
+func (p EthernodesPaths) withDefaults() EthernodesPaths {
+	if p.Main == "" {
+		p.Main = DefaultEthernodesPaths.Main
+	}
+	if p.Client == "" {
+		p.Client = DefaultEthernodesPaths.Client
+	}
+	if p.SyncedClient == "" {
+		p.SyncedClient = DefaultEthernodesPaths.SyncedClient
+	}
+	if p.Sync == "" {
+		p.Sync = DefaultEthernodesPaths.Sync
+	}
+	return p
+}
+
+// EthernodesEndpoints is where the ethernodes pages are fetched from: the
+// primary base URL first, then each mirror in order.
+type EthernodesEndpoints struct {
+	Primary string
+	Mirrors []string
+	Paths   EthernodesPaths
+}
+
+// newEthernodesEndpoints resolves the endpoints of a network. A non-empty
+// baseURL replaces the network's site and its default mirrors, so the scraper
+// can be pointed at a caching mirror, a local stand-in or the site of a
+// testnet.
+func newEthernodesEndpoints(network configs.Network, baseURL string, mirrors []string, paths EthernodesPaths) (EthernodesEndpoints, error) {
+	primary := baseURL
+	if primary == "" {
+		var ok bool
+		primary, ok = ethernodesNetworkURLs[network]
+		if !ok {
+			return EthernodesEndpoints{}, fmt.Errorf("no ethernodes site is known for %s; set the base url of the site tracking it", network)
+		}
+		if mirrors == nil {
+			mirrors = ethernodesNetworkMirrors[network]
+		}
+	}
+
+	endpoints := EthernodesEndpoints{
+		Primary: strings.TrimRight(primary, "/"),
+		Paths:   paths.withDefaults(),
+	}
+	for _, mirror := range mirrors {
+		if mirror = strings.TrimRight(mirror, "/"); mirror != "" {
+			endpoints.Mirrors = append(endpoints.Mirrors, mirror)
+		}
+	}
+	return endpoints, nil
+}
+
+// URLs returns the URL of a page on the primary and on every mirror.
+func (e EthernodesEndpoints) URLs(path string, layer configs.Layer, clientURLName string) []string {
+	path = strings.NewReplacer(
+		"{layer}", layer.Short(),
+		"{client}", clientURLName,
+	).Replace(path)
+
+	urls := make([]string, 0, len(e.Mirrors)+1)
+	for _, base := range append([]string{e.Primary}, e.Mirrors...) {
+		urls = append(urls, base+path)
+	}
+	return urls
+}
+
+// fetchFromEndpoints calls fetch with the URL of a page on the primary and
+// then on each mirror until one succeeds.
+func (e EthernodesDataSource) fetchFromEndpoints(ctx context.Context, path string, layer configs.Layer, clientURLName string, fetch func(url string) error) error {
+	var lastErr error
+	for i, url := range e.endpoints.URLs(path, layer, clientURLName) {
+		if i > 0 {
+			if err := sleepContext(ctx, 2*time.Second); err != nil {
+				return err
+			}
+		}
+		if lastErr = fetch(url); lastErr == nil {
+			return nil
+		}
+		slog.Debug("Failed to get data from", "url", url, "error", lastErr)
+	}
+	return fmt.Errorf("failed to fetch %s from any ethernodes endpoint: %w", path, lastErr)
+}
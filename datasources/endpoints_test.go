@@ -0,0 +1,62 @@
+package datasources
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+func TestNewEthernodesEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		network     configs.Network
+		baseURL     string
+		mirrors     []string
+		wantPrimary string
+		wantMirrors []string
+		wantErr     string
+	}{
+		{"mainnet", configs.NetworkMainnet, "", nil, "https://ethernodes.org", []string{"https://www.ethernodes.org"}, ""},
+		{"mainnet without mirrors", configs.NetworkMainnet, "", []string{}, "https://ethernodes.org", nil, ""},
+		{"base url replaces the mirrors", configs.NetworkMainnet, "http://localhost:8080/", nil, "http://localhost:8080", nil, ""},
+		{"testnet with base url", configs.NetworkHolesky, "https://holesky.ethernodes.org", []string{"https://mirror.example/", ""}, "https://holesky.ethernodes.org", []string{"https://mirror.example"}, ""},
+		{"testnet without base url", configs.NetworkHolesky, "", nil, "", nil, "no ethernodes site is known for"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := newEthernodesEndpoints(tt.network, tt.baseURL, tt.mirrors, EthernodesPaths{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newEthernodesEndpoints() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newEthernodesEndpoints() error = %v", err)
+			}
+			if endpoints.Primary != tt.wantPrimary || !slices.Equal(endpoints.Mirrors, tt.wantMirrors) {
+				t.Errorf("newEthernodesEndpoints() = %s %v, want %s %v", endpoints.Primary, endpoints.Mirrors, tt.wantPrimary, tt.wantMirrors)
+			}
+			if endpoints.Paths != DefaultEthernodesPaths {
+				t.Errorf("newEthernodesEndpoints() paths = %+v, want the defaults", endpoints.Paths)
+			}
+		})
+	}
+}
+
+func TestEthernodesEndpointsURLs(t *testing.T) {
+	endpoints, err := newEthernodesEndpoints(configs.NetworkMainnet, "", nil, EthernodesPaths{SyncedClient: "/{layer}/{client}/synced"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := endpoints.URLs(endpoints.Paths.SyncedClient, configs.LayerConsensus, "lighthouse")
+	want := []string{"https://ethernodes.org/cl/lighthouse/synced", "https://www.ethernodes.org/cl/lighthouse/synced"}
+	if !slices.Equal(got, want) {
+		t.Errorf("URLs() = %v, want %v", got, want)
+	}
+	if endpoints.Paths.Client != DefaultEthernodesPaths.Client {
+		t.Errorf("Paths.Client = %q, want the default", endpoints.Paths.Client)
+	}
+}
@@ -1,15 +1,14 @@
 package datasources
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"regexp"
-	"strconv"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/gocolly/colly"
 
 	"client-nodes-reporter/configs"
 )
@@ -17,13 +16,34 @@ import (
 const EthernetsSourceName = "Ethernets"
 
 type EthernetsDataSourceOptions struct {
-	BaseURL           string
+	BaseURL string
+	// Network must be mainnet; ethernets does not track testnets.
+	Network           configs.Network
 	MaxRetries        int
 	InitialRetryDelay time.Duration
+	// FlareSolverrURLs are the FlareSolverr v1 endpoints used by the
+	// flaresolverr fetch strategy.
+	FlareSolverrURLs []string
+	// Proxies, when set, are rotated by the direct and FlareSolverr fetches.
+	Proxies *ProxyPool
+	// Archive, when set, keeps every fetched page.
+	Archive *PageArchive
+	// Transport of the requests that do not go through a proxy; nil is
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Fetcher, when set, replaces the fetchers of FetchStrategies, e.g. to
+	// replay archived pages.
+	Fetcher Fetcher
+	// FetchStrategies are tried in order; empty means FetchStrategyColly.
+	FetchStrategies []FetchStrategy
+	// Rules say where the numbers are on each page; nil is
+	// DefaultExtractionRules.
+	Rules *ExtractionRules
 }
 
 type EthernetsDataSource struct {
-	config EthernetsDataSourceOptions
+	config  EthernetsDataSourceOptions
+	fetcher Fetcher
 }
 
 func NewEthernetsDataSource(cfg *EthernetsDataSourceOptions) (*EthernetsDataSource, error) {
@@ -31,12 +51,16 @@ func NewEthernetsDataSource(cfg *EthernetsDataSourceOptions) (*EthernetsDataSour
 		BaseURL:           "https://www.ethernets.io",
 		MaxRetries:        3,
 		InitialRetryDelay: 1 * time.Second,
+		FetchStrategies:   []FetchStrategy{FetchStrategyColly},
 	}
 
 	if cfg != nil {
 		if cfg.BaseURL != "" {
 			config.BaseURL = cfg.BaseURL
 		}
+		if cfg.Network != "" && cfg.Network != configs.NetworkMainnet {
+			return nil, fmt.Errorf("ethernets does not support network: %s", cfg.Network)
+		}
 		if cfg.MaxRetries < 0 {
 			config.MaxRetries = 3
 		} else {
@@ -47,9 +71,45 @@ func NewEthernetsDataSource(cfg *EthernetsDataSourceOptions) (*EthernetsDataSour
 		} else {
 			config.InitialRetryDelay = cfg.InitialRetryDelay
 		}
+		config.FlareSolverrURLs = cfg.FlareSolverrURLs
+		config.Proxies = cfg.Proxies
+		config.Archive = cfg.Archive
+		config.Transport = cfg.Transport
+		config.Fetcher = cfg.Fetcher
+		if len(cfg.FetchStrategies) > 0 {
+			config.FetchStrategies = cfg.FetchStrategies
+		}
+		config.Rules = cfg.Rules
+	}
+	if config.Rules == nil {
+		config.Rules = DefaultExtractionRules()
 	}
 
-	return &EthernetsDataSource{config: config}, nil
+	fetcher := config.Fetcher
+	if fetcher == nil {
+		var err error
+		fetcher, err = NewFetcher(FetcherOptions{
+			Strategies:        config.FetchStrategies,
+			FlareSolverrURLs:  config.FlareSolverrURLs,
+			Proxies:           config.Proxies,
+			Archive:           config.Archive,
+			Transport:         config.Transport,
+			Referer:           config.BaseURL + "/",
+			MaxRetries:        config.MaxRetries,
+			InitialRetryDelay: config.InitialRetryDelay,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &EthernetsDataSource{config: config, fetcher: fetcher}, nil
+}
+
+// Close releases what the fetcher holds for the run, such as a FlareSolverr
+// session.
+func (e EthernetsDataSource) Close() error {
+	return closeFetcher(e.fetcher)
 }
 
 func (e EthernetsDataSource) SourceType() DataSourceType {
@@ -60,101 +120,172 @@ func (e EthernetsDataSource) SourceName() string {
 	return EthernetsSourceName
 }
 
-func (e EthernetsDataSource) getNumbersFrom(url string, clientName configs.ClientType) (int64, int64, error) {
-	// Total number of clients
-	var total int64 = -1
-	var clientNumber int64 = -1
-	var scrapeErr error
+// getNumbersFrom returns the "Total" count and every client row of an
+// ethernets page.
+func (e EthernetsDataSource) getNumbersFrom(ctx context.Context, url string) (int64, []ClientCount, error) {
+	body, err := e.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return -1, nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return -1, nil, fmt.Errorf("parse HTML from %s: %w", url, err)
+	}
 
-	c := colly.NewCollector(
-		colly.MaxDepth(1),
-	)
-
-	c.OnRequest(func(r *colly.Request) {
-		slog.Debug("Visiting", "url", r.URL)
-		r.Ctx.Put("retries", 0)
-	})
-
-	c.OnHTML("h2", func(e *colly.HTMLElement) {
-		if strings.Contains(e.Text, "Client Names") {
-			// Get the parent div element
-			parent := e.DOM.Parent()
-
-			// All clients have text in the format `<client-name> (<number>)` with a special case for `Total`
-			parent.Find("span").Each(func(i int, s *goquery.Selection) {
-				rawClientText := s.Text()
-				re := regexp.MustCompile(`(\w+)\s+\((\d+)\)`)
-				matches := re.FindStringSubmatch(rawClientText)
-				if len(matches) == 3 {
-					parsedName := matches[1]
-					parsedNumber := matches[2]
-					slog.Debug("Found client", "name", parsedName, "number", parsedNumber)
-					if strings.EqualFold(parsedName, "Total") {
-						totalParsed, err := strconv.ParseInt(parsedNumber, 10, 64)
-						if err != nil {
-							scrapeErr = fmt.Errorf("failed to parse total number of clients: %w", err)
-							return
-						}
-						total = totalParsed
-					} else if strings.EqualFold(parsedName, string(clientName)) {
-						clientNumberParsed, err := strconv.ParseInt(parsedNumber, 10, 64)
-						if err != nil {
-							scrapeErr = fmt.Errorf("failed to parse client number: %w", err)
-							return
-						}
-						clientNumber = clientNumberParsed
-					}
-				}
+	total, scrapeErr := e.config.Rules.ExtractCount(e.SourceType(), PageKindMain, url, doc, "total", configs.LayerExecution)
+	var rows []ClientCount
+	if scrapeErr == nil {
+		var entries []BreakdownEntry
+		entries, scrapeErr = e.config.Rules.Extract(e.SourceType(), PageKindMain, url, doc, "clients", configs.LayerExecution)
+		for _, entry := range entries {
+			slog.Debug("Found client", "name", entry.Label, "number", entry.Count)
+			rows = append(rows, ClientCount{
+				Name:       entry.Label,
+				ClientName: e.config.Rules.ClientType(e.SourceType(), entry.Label, configs.LayerExecution),
+				Total:      entry.Count,
 			})
 		}
-	})
-
-	c.OnError(func(r *colly.Response, err error) {
-		retries := r.Ctx.GetAny("retries").(int)
-		if retries < e.config.MaxRetries {
-			slog.Info("Error during http request. Retrying...", "error", err, "retries", retries)
-			delay := time.Duration(int64(e.config.InitialRetryDelay) * (1 << uint(retries)))
-			time.Sleep(delay)
-			r.Ctx.Put("retries", retries+1)
-			r.Request.Retry()
-		}
-	})
-
-	if err := c.Visit(url); err != nil {
-		return -1, -1, err
 	}
 
+	recordMatches(ctx, url, "clients", doc, map[string]any{"total": total, "clients": clientRowLabels(rows)})
+	if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindMain, url, doc, configs.LayerExecution); err != nil {
+		return -1, nil, err
+	}
 	if scrapeErr != nil {
-		return total, clientNumber, fmt.Errorf("failed to find total or client data: %w", scrapeErr)
+		return total, rows, fmt.Errorf("failed to find total or client data: %w", scrapeErr)
+	}
+	if total <= 0 {
+		return -1, nil, fmt.Errorf("could not extract total from %s", url)
 	}
 
-	return total, clientNumber, nil
+	return total, rows, nil
 }
 
-func (e EthernetsDataSource) GetClientData(clientName configs.ClientType) (ClientData, error) {
+// GetDistribution merges the "Client Names" spans of the synced and unsynced
+// pages into one row per client. Ethernets only tracks execution clients.
+func (e EthernetsDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	if layer != configs.LayerExecution {
+		return Distribution{}, fmt.Errorf("ethernets does not publish %s clients", layer)
+	}
+
 	syncedUrl := fmt.Sprintf("%s/?synced=yes", e.config.BaseURL)
 	unsyncedUrl := fmt.Sprintf("%s/?synced=no", e.config.BaseURL)
 
-	totalSynced, clientSynced, err := e.getNumbersFrom(syncedUrl, clientName)
+	totalSynced, syncedRows, err := e.getNumbersFrom(ctx, syncedUrl)
 	if err != nil {
-		return ClientData{}, fmt.Errorf("failed to get synced data: %w", err)
+		return Distribution{}, fmt.Errorf("failed to get synced data: %w", err)
 	}
-	totalUnsynced, clientUnsynced, err := e.getNumbersFrom(unsyncedUrl, clientName)
+	totalUnsynced, unsyncedRows, err := e.getNumbersFrom(ctx, unsyncedUrl)
 	if err != nil {
-		return ClientData{}, fmt.Errorf("failed to get unsynced data: %w", err)
+		return Distribution{}, fmt.Errorf("failed to get unsynced data: %w", err)
+	}
+
+	var clients []ClientCount
+	indexes := make(map[string]int)
+	for _, row := range syncedRows {
+		row.Synced = row.Total
+		indexes[strings.ToLower(row.Name)] = len(clients)
+		clients = append(clients, row)
+	}
+	for _, row := range unsyncedRows {
+		if i, ok := indexes[strings.ToLower(row.Name)]; ok {
+			clients[i].Total += row.Total
+			continue
+		}
+		row.Synced = 0
+		indexes[strings.ToLower(row.Name)] = len(clients)
+		clients = append(clients, row)
 	}
 
 	totalNumber := totalSynced + totalUnsynced
 
-	clientTotal := clientSynced + clientUnsynced
+	return Distribution{
+		Source:      string(e.SourceType()),
+		Network:     configs.NetworkMainnet,
+		Layer:       layer,
+		Total:       totalNumber,
+		TotalSynced: totalSynced,
+		Clients:     addOtherBucket(clients, totalNumber, totalSynced),
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (e EthernetsDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	distribution, err := e.GetDistribution(ctx, clientName.Layer())
+	if err != nil {
+		return ClientData{}, err
+	}
+
+	// A missing row counts as zero nodes rather than an error.
+	var clientTotal, clientSynced int64
+	for _, client := range distribution.Clients {
+		if client.ClientName == clientName {
+			clientTotal += client.Total
+			clientSynced += client.Synced
+		}
+	}
 
 	return ClientData{
 		string(e.SourceType()),
+		distribution.Network,
+		distribution.Layer,
 		clientName,
-		totalNumber,
+		distribution.Total,
 		clientTotal,
-		totalSynced,
+		distribution.TotalSynced,
 		clientSynced,
-		time.Now(),
+		nil,
+		distribution.CreatedAt,
 	}, nil
 }
+
+// GetBreakdowns reads the requested breakdowns from the page filtered to one
+// client, https://www.ethernets.io/?client=<name>.
+func (e EthernetsDataSource) GetBreakdowns(ctx context.Context, clientName configs.ClientType, dimensions []Dimension) ([]Breakdown, error) {
+	if clientName.Layer() != configs.LayerExecution {
+		return nil, fmt.Errorf("ethernets does not publish %s clients", clientName.Layer())
+	}
+
+	url := fmt.Sprintf("%s/?client=%s", e.config.BaseURL, clientName)
+	for _, dimension := range dimensions {
+		if !e.config.Rules.Has(e.SourceType(), PageKindClient, string(dimension)) {
+			return nil, fmt.Errorf("ethernets does not publish a %s breakdown", dimension)
+		}
+	}
+
+	body, err := e.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("parse HTML from %s: %w", url, err)
+	}
+
+	entries := make(map[Dimension][]BreakdownEntry)
+	found := make(map[string]any, len(dimensions))
+	var scrapeErr error
+	for _, dimension := range dimensions {
+		entries[dimension], scrapeErr = e.config.Rules.Extract(e.SourceType(), PageKindClient, url, doc, string(dimension), clientName.Layer())
+		found[string(dimension)] = len(entries[dimension])
+		if scrapeErr != nil {
+			break
+		}
+	}
+	recordMatches(ctx, url, "breakdowns", doc, found)
+	if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindClient, url, doc, clientName.Layer()); err != nil {
+		return nil, err
+	}
+	if scrapeErr != nil {
+		return nil, fmt.Errorf("failed to find breakdown data: %w", scrapeErr)
+	}
+
+	breakdowns := make([]Breakdown, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		if len(entries[dimension]) == 0 {
+			return nil, fmt.Errorf("could not extract %s breakdown from %s", dimension, url)
+		}
+		breakdowns = append(breakdowns, newBreakdown(string(e.SourceType()), configs.NetworkMainnet, clientName, dimension, -1, entries[dimension]))
+	}
+	return breakdowns, nil
+}
@@ -1,70 +1,73 @@
 package datasources
 
 import (
-	"bytes"
-	"compress/gzip"
+	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/gocolly/colly"
 
 	"client-nodes-reporter/configs"
 )
 
-// readMaybeGzip reads a response body, decompressing it when the server
-// returned Content-Encoding: gzip. net/http only auto-decompresses when
-// the caller did NOT set Accept-Encoding explicitly — code paths that set
-// it manually (to look browser-like for Cloudflare) must decompress here.
-func readMaybeGzip(resp *http.Response) ([]byte, error) {
-	raw, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
-		return raw, nil
-	}
-	gr, err := gzip.NewReader(bytes.NewReader(raw))
-	if err != nil {
-		return nil, fmt.Errorf("gzip reader: %w", err)
-	}
-	defer gr.Close()
-	return io.ReadAll(gr)
-}
-
 const EthernodesSourceName = "Ethernodes"
 
 type EthernodesDataSourceOptions struct {
-	BaseURL           string
+	// BaseURL, when non-empty, replaces the network's ethernodes site and its
+	// default mirrors.
+	BaseURL string
+	// Mirrors are tried in order when a page cannot be read from BaseURL. Nil
+	// keeps the network's default mirrors unless BaseURL is set.
+	Mirrors []string
+	// Paths overrides the page paths; empty fields keep DefaultEthernodesPaths.
+	Paths             EthernodesPaths
+	Network           configs.Network
 	MaxRetries        int
 	InitialRetryDelay time.Duration
-	// FlareSolverrURL, when non-empty, routes all outbound fetches through a
-	// FlareSolverr v1 endpoint (e.g. "http://localhost:8191/v1"). When set, the
-	// colly fallback is intentionally bypassed so a FlareSolverr failure is
-	// surfaced loudly instead of silently masked.
-	FlareSolverrURL string
+	// FlareSolverrURLs, when non-empty, route all outbound fetches through
+	// FlareSolverr v1 endpoints (e.g. "http://localhost:8191/v1") under the
+	// auto strategy. The colly fallback is then intentionally bypassed so a
+	// FlareSolverr failure is surfaced loudly instead of silently masked.
+	FlareSolverrURLs []string
+	// Proxies, when set, are rotated by the direct and FlareSolverr fetches.
+	Proxies *ProxyPool
+	// Archive, when set, keeps every fetched page.
+	Archive *PageArchive
+	// Transport of the requests that do not go through a proxy; nil is
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Fetcher, when set, replaces the fetchers of FetchStrategies, e.g. to
+	// replay archived pages.
+	Fetcher Fetcher
+	// FetchStrategies are tried in order; empty means FetchStrategyAuto.
+	FetchStrategies []FetchStrategy
+	// Rules say where the numbers are on each page; nil is
+	// DefaultExtractionRules.
+	Rules *ExtractionRules
 }
 
 type EthernodesDataSource struct {
-	config EthernodesDataSourceOptions
+	config    EthernodesDataSourceOptions
+	endpoints EthernodesEndpoints
+	fetcher   Fetcher
 }
 
 func NewEthernodesDataSource(cfg *EthernodesDataSourceOptions) (*EthernodesDataSource, error) {
 	config := EthernodesDataSourceOptions{
-		BaseURL:           "https://ethernodes.org",
+		Network:           configs.NetworkMainnet,
 		MaxRetries:        3,
 		InitialRetryDelay: 1 * time.Second,
 	}
 
 	if cfg != nil {
-		if cfg.BaseURL != "" {
-			config.BaseURL = cfg.BaseURL
+		config.BaseURL = cfg.BaseURL
+		config.Mirrors = cfg.Mirrors
+		config.Paths = cfg.Paths
+		if cfg.Network != "" {
+			config.Network = cfg.Network
 		}
 		if cfg.MaxRetries < 0 {
 			config.MaxRetries = 3
@@ -76,79 +79,47 @@ func NewEthernodesDataSource(cfg *EthernodesDataSourceOptions) (*EthernodesDataS
 		} else {
 			config.InitialRetryDelay = cfg.InitialRetryDelay
 		}
-		config.FlareSolverrURL = cfg.FlareSolverrURL
+		config.FlareSolverrURLs = cfg.FlareSolverrURLs
+		config.Proxies = cfg.Proxies
+		config.Archive = cfg.Archive
+		config.Transport = cfg.Transport
+		config.Fetcher = cfg.Fetcher
+		config.FetchStrategies = cfg.FetchStrategies
+		config.Rules = cfg.Rules
 	}
-
-	return &EthernodesDataSource{config: config}, nil
-}
-
-// fetchHTML returns the HTML body for url. When FlareSolverrURL is configured,
-// the request is proxied through FlareSolverr (real headless Chromium, correct
-// TLS fingerprint, JS challenges solved). Otherwise it does the direct browser-
-// shaped GET that the colly-less code paths historically did.
-//
-// The Cloudflare-block detection lives here so it covers both paths: if the
-// FlareSolverr-fronted response *still* contains a CF block page, we want to
-// fail loudly rather than parse garbage downstream.
-func (e EthernodesDataSource) fetchHTML(url string) ([]byte, error) {
-	if e.config.FlareSolverrURL != "" {
-		body, upstreamStatus, err := fetchViaFlareSolverr(e.config.FlareSolverrURL, url)
-		if err != nil {
-			return nil, err
-		}
-		if upstreamStatus < 200 || upstreamStatus >= 300 {
-			return nil, fmt.Errorf("ethernodes returned HTTP %d via flaresolverr", upstreamStatus)
-		}
-		if isCloudflareBlock(body) {
-			return nil, fmt.Errorf("cloudflare protection still tripping through flaresolverr at %s", url)
-		}
-		return []byte(body), nil
+	if config.Rules == nil {
+		config.Rules = DefaultExtractionRules()
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Accept-Encoding", "gzip, deflate")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Pragma", "no-cache")
-	req.Header.Set("Sec-Ch-Ua", "\"Not_A Brand\";v=\"8\", \"Chromium\";v=\"120\", \"Google Chrome\";v=\"120\"")
-	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	req.Header.Set("Sec-Ch-Ua-Platform", "\"macOS\"")
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Referer", "https://ethernodes.org/")
-
-	resp, err := client.Do(req)
+	endpoints, err := newEthernodesEndpoints(config.Network, config.BaseURL, config.Mirrors, config.Paths)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := readMaybeGzip(resp)
-	if err != nil {
-		return nil, err
-	}
-	if isCloudflareBlock(string(body)) {
-		return nil, fmt.Errorf("cloudflare protection detected at %s", url)
+	fetcher := config.Fetcher
+	if fetcher == nil {
+		fetcher, err = NewFetcher(FetcherOptions{
+			Strategies:        config.FetchStrategies,
+			FlareSolverrURLs:  config.FlareSolverrURLs,
+			Proxies:           config.Proxies,
+			Archive:           config.Archive,
+			Transport:         config.Transport,
+			Referer:           endpoints.Primary + "/",
+			MaxRetries:        config.MaxRetries,
+			InitialRetryDelay: config.InitialRetryDelay,
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
-	return body, nil
+
+	return &EthernodesDataSource{config: config, endpoints: endpoints, fetcher: fetcher}, nil
 }
 
-// isCloudflareBlock returns true if the response body looks like a Cloudflare
-// challenge or block page. Pre-existing call sites checked these substrings
-// inline; centralizing them keeps the FlareSolverr and direct paths in sync.
-func isCloudflareBlock(body string) bool {
-	return strings.Contains(body, "Just a moment") ||
-		strings.Contains(body, "cf-browser-verification") ||
-		strings.Contains(body, "Cloudflare")
+// Close releases what the fetcher holds for the run, such as a FlareSolverr
+// session.
+func (e EthernodesDataSource) Close() error {
+	return closeFetcher(e.fetcher)
 }
 
 func (e EthernodesDataSource) SourceType() DataSourceType {
@@ -159,372 +130,246 @@ func (e EthernodesDataSource) SourceName() string {
 	return EthernodesSourceName
 }
 
-func (e EthernodesDataSource) getNumbersFromWithContent(url string, clientName configs.ClientType) (int64, int64, string, error) {
-	var total int64 = -1
-	var clientNumber int64 = -1
-	var scrapeErr error
-
-	slog.Debug("Fetching ethernodes main page", "url", url, "viaFlareSolverr", e.config.FlareSolverrURL != "")
+// getClientRows fetches an ethernodes page and returns the "Total" count and
+// every client row of the layer's "<Layer> Clients" section.
+func (e EthernodesDataSource) getClientRows(ctx context.Context, url string, layer configs.Layer) (int64, []ClientCount, error) {
+	slog.Debug("Fetching ethernodes main page", "url", url)
 
-	body, err := e.fetchHTML(url)
+	body, err := e.fetcher.Fetch(ctx, url)
 	if err != nil {
-		// When FlareSolverr is configured, the colly fallback is intentionally
-		// skipped: we want a FlareSolverr failure to surface, not to be masked
-		// by a second attempt from a raw Go client that has already been
-		// blocked at this IP.
-		if e.config.FlareSolverrURL != "" {
-			return -1, -1, "", err
-		}
-		slog.Debug("Direct fetch failed, trying colly fallback", "error", err)
-		total, clientNumber, fallbackErr := e.getNumbersFromWithColly(url, clientName)
-		return total, clientNumber, "", fallbackErr
+		return -1, nil, err
 	}
-
-	bodyStr := string(body)
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
 	if err != nil {
-		if e.config.FlareSolverrURL != "" {
-			return -1, -1, "", fmt.Errorf("parse HTML: %w", err)
-		}
-		slog.Debug("Failed to parse HTML from direct request", "error", err)
-		total, clientNumber, fallbackErr := e.getNumbersFromWithColly(url, clientName)
-		return total, clientNumber, "", fallbackErr
+		return -1, nil, fmt.Errorf("parse HTML: %w", err)
 	}
 
-	processHTML(doc, clientName, &total, &clientNumber, &scrapeErr)
+	total, rows, scrapeErr := e.extractClientRows(url, doc, layer)
+	recordMatches(ctx, url, "clients", doc, map[string]any{
+		"layer":   layer,
+		"total":   total,
+		"clients": clientRowLabels(rows),
+	})
+	if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindMain, url, doc, layer); err != nil {
+		return -1, nil, err
+	}
+	if scrapeErr != nil {
+		return -1, nil, fmt.Errorf("failed to find total or client data: %w", scrapeErr)
+	}
+	if total <= 0 || len(rows) == 0 {
+		return -1, nil, fmt.Errorf("could not extract total/client counts from %s", url)
+	}
+	slog.Debug("Successfully extracted data", "total", total, "clients", len(rows))
+	return total, rows, nil
+}
 
-	if total > 0 && clientNumber > 0 {
-		slog.Debug("Successfully extracted data", "total", total, "clientNumber", clientNumber)
-		return total, clientNumber, bodyStr, nil
+// clientRowLabels returns the labels of rows with their counts, for the
+// diagnostics bundle.
+func clientRowLabels(rows []ClientCount) map[string]int64 {
+	labels := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		labels[row.Name] = row.Total
 	}
+	return labels
+}
 
-	if e.config.FlareSolverrURL != "" {
-		return -1, -1, "", fmt.Errorf("could not extract total/client counts from %s", url)
+// extractClientRows reads the "Total" count and every client row of the
+// layer's clients section of a main page.
+func (e EthernodesDataSource) extractClientRows(url string, doc *goquery.Document, layer configs.Layer) (int64, []ClientCount, error) {
+	total, err := e.config.Rules.ExtractCount(e.SourceType(), PageKindMain, url, doc, "total", layer)
+	if err != nil {
+		return -1, nil, err
 	}
-	slog.Debug("Direct fetch did not yield data, trying colly fallback")
-	total, clientNumber, fallbackErr := e.getNumbersFromWithColly(url, clientName)
-	return total, clientNumber, "", fallbackErr
+	entries, err := e.config.Rules.Extract(e.SourceType(), PageKindMain, url, doc, "clients", layer)
+	if err != nil {
+		return total, nil, err
+	}
+	rows := make([]ClientCount, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, ClientCount{
+			Name:       entry.Label,
+			ClientName: e.config.Rules.ClientType(e.SourceType(), entry.Label, layer),
+			Total:      entry.Count,
+			Synced:     -1,
+		})
+	}
+	return total, rows, nil
 }
 
-func (e EthernodesDataSource) getNumbersFromWithColly(url string, clientName configs.ClientType) (int64, int64, error) {
-	// Total number of clients
+// getMainPageRows returns the total and every client row of a layer from the
+// ethernodes main page, trying the primary and then each mirror in turn.
+func (e EthernodesDataSource) getMainPageRows(ctx context.Context, layer configs.Layer) (int64, []ClientCount, error) {
 	var total int64 = -1
-	var clientNumber int64 = -1
-	var scrapeErr error
-
-	c := colly.NewCollector(
-		colly.MaxDepth(1),
-		colly.AllowURLRevisit(),
-	)
-	
-	// Add a delay between requests to be respectful
-	c.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		RandomDelay: 5 * time.Second,
-	})
+	var rows []ClientCount
 
-	// Try different user agents to avoid detection
-	userAgents := []string{
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/121.0",
-	}
-	
-	// Use a random user agent
-	randomIndex := time.Now().UnixNano() % int64(len(userAgents))
-	c.UserAgent = userAgents[randomIndex]
-	
-	c.OnRequest(func(r *colly.Request) {
-		// Add headers that might help bypass protection
-		r.Headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-		r.Headers.Set("Accept-Language", "en-US,en;q=0.9")
-		r.Headers.Set("Accept-Encoding", "gzip, deflate, br")
-		r.Headers.Set("Cache-Control", "max-age=0")
-		r.Headers.Set("Sec-Ch-Ua", "\"Not_A Brand\";v=\"8\", \"Chromium\";v=\"120\", \"Google Chrome\";v=\"120\"")
-		r.Headers.Set("Sec-Ch-Ua-Mobile", "?0")
-		r.Headers.Set("Sec-Ch-Ua-Platform", "\"Windows\"")
-		r.Headers.Set("Sec-Fetch-Dest", "document")
-		r.Headers.Set("Sec-Fetch-Mode", "navigate")
-		r.Headers.Set("Sec-Fetch-Site", "none")
-		r.Headers.Set("Sec-Fetch-User", "?1")
-		r.Headers.Set("Upgrade-Insecure-Requests", "1")
-		
-		slog.Debug("Visiting", "url", r.URL)
-		r.Ctx.Put("retries", 0)
-	})
-
-	// Look for Execution Layer Clients section
-	c.OnHTML("h4", func(e *colly.HTMLElement) {
-		if strings.Contains(e.Text, "Execution Layer Clients") {
-			slog.Debug("Found Execution Layer Clients section")
-			processHTMLFromSelection(e.DOM, clientName, &total, &clientNumber, &scrapeErr)
+	err := e.fetchFromEndpoints(ctx, e.endpoints.Paths.Main, layer, "", func(url string) error {
+		slog.Debug("Trying main page for total counts", "url", url)
+		t, r, err := e.getClientRows(ctx, url, layer)
+		if err != nil {
+			return err
+		}
+		if t <= 0 || len(r) == 0 {
+			return fmt.Errorf("could not extract total/client counts from %s", url)
 		}
+		slog.Info("Successfully retrieved total counts from main page", "url", url, "total", t, "clients", len(r))
+		total, rows = t, r
+		return nil
 	})
+	if err != nil {
+		return -1, nil, err
+	}
+	return total, rows, nil
+}
 
-	c.OnError(func(r *colly.Response, err error) {
-		slog.Debug("HTTP Error", "status", r.StatusCode, "error", err, "url", r.Request.URL)
-		
-		// If we got a 403 Forbidden, try to process the response anyway
-		if r.StatusCode == 403 {
-			slog.Debug("Received 403 Forbidden, attempting to process response body", "bodyLength", len(r.Body))
-			
-			// Log a snippet of the response body to see what we're getting
-			bodyStr := string(r.Body)
-			if len(bodyStr) > 500 {
-				slog.Debug("Response body snippet", "snippet", bodyStr[:500])
-			} else {
-				slog.Debug("Response body", "body", bodyStr)
-			}
-			
-			// Check if we got a Cloudflare protection page
-			if strings.Contains(bodyStr, "Just a moment") || strings.Contains(bodyStr, "Cloudflare") {
-				slog.Debug("Detected Cloudflare protection page - this source may not be accessible")
-				// Don't try to process Cloudflare protection pages
-				return
-			}
-			
-			// Try to parse the response body even with 403
-			doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
-			if err != nil {
-				slog.Debug("Failed to parse response body", "error", err)
-				return
+// getDistribution scrapes the main page once plus the per-client pages of
+// clients only, so GetClientData does not fetch pages it won't use.
+// withSynced fetches each client's synced page and the /sync page;
+// withVersions fetches each client's unfiltered page for the per-version
+// totals. Counts that were not fetched are left at -1 (per-version synced
+// counts at 0).
+func (e EthernodesDataSource) getDistribution(ctx context.Context, layer configs.Layer, clients []configs.ClientType, withSynced, withVersions bool) (Distribution, error) {
+	total, rows, err := e.getMainPageRows(ctx, layer)
+	if err != nil {
+		return Distribution{}, err
+	}
+
+	for _, clientName := range clients {
+		var clientTotal int64
+		var indexes []int
+		for i, row := range rows {
+			if row.ClientName == clientName {
+				clientTotal += row.Total
+				indexes = append(indexes, i)
 			}
-			
-			slog.Debug("Successfully parsed response body, processing HTML")
-			// Process the HTML manually
-			processHTML(doc, clientName, &total, &clientNumber, &scrapeErr)
-			slog.Debug("Finished processing HTML from 403 response", "total", total, "clientNumber", clientNumber)
-			return
 		}
-		
-		retries := r.Ctx.GetAny("retries").(int)
-		if retries < e.config.MaxRetries {
-			slog.Debug("Error during http request. Retrying...", "error", err, "retries", retries)
-			delay := time.Duration(int64(e.config.InitialRetryDelay) * (1 << uint(retries)))
-			time.Sleep(delay)
-			r.Ctx.Put("retries", retries+1)
-			r.Request.Retry()
-		} else {
-			slog.Debug("Max retries reached, giving up", "error", err, "retries", retries)
+		if len(indexes) == 0 {
+			continue
+		}
+		// A client listed with no nodes has no pages worth fetching.
+		if clientTotal == 0 {
+			if withSynced {
+				for _, i := range indexes {
+					rows[i].Synced = 0
+				}
+			}
+			continue
 		}
-	})
 
-	// Try different HTTP methods
-	methods := []string{"GET", "HEAD"}
-	var visitErr error
-	
-	for _, method := range methods {
-		if method == "GET" {
-			visitErr = c.Visit(url)
-		} else {
-			// For HEAD requests, we need to handle differently
-			req, err := http.NewRequest(method, url, nil)
+		// Per-client synced count from /client/<el|cl>/<name>?synced=1.
+		var clientSynced int64 = -1
+		var syncedVersions map[string]int64
+		if withSynced {
+			clientSynced, syncedVersions, err = e.getClientSyncedCount(ctx, clientName)
 			if err != nil {
-				continue
+				return Distribution{}, fmt.Errorf("failed to get %s synced count: %w", clientName, err)
 			}
-			req.Header.Set("User-Agent", c.UserAgent)
-			req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-			
-			client := &http.Client{Timeout: 30 * time.Second}
-			resp, err := client.Do(req)
+		}
+
+		// Per-version totals from the unfiltered /client/<el|cl>/<name>.
+		var versions []VersionCount
+		if withVersions {
+			totalVersions, err := e.getClientVersionTotals(ctx, clientName)
 			if err != nil {
-				continue
-			}
-			resp.Body.Close()
-			
-			if resp.StatusCode == 200 {
-				// If HEAD works, try GET
-				visitErr = c.Visit(url)
-				break
+				return Distribution{}, fmt.Errorf("failed to get %s versions: %w", clientName, err)
 			}
+			versions = mergeVersionCounts(totalVersions, syncedVersions)
 		}
-		
-		if visitErr == nil {
-			break
-		}
-	}
-	
-	// Check if we got data despite any errors
-	if total > 0 && clientNumber > 0 {
-		slog.Debug("Got data despite error, proceeding with available data", "total", total, "clientNumber", clientNumber, "visitError", visitErr)
-		return total, clientNumber, nil
-	}
-	
-	// If we got some data but not complete, log it
-	if total > 0 || clientNumber > 0 {
-		slog.Debug("Got partial data", "total", total, "clientNumber", clientNumber, "visitError", visitErr)
-	}
-	
-	if visitErr != nil {
-		// Check if this is likely a Cloudflare protection issue
-		if strings.Contains(visitErr.Error(), "Forbidden") {
-			return -1, -1, fmt.Errorf("access denied by Cloudflare protection - ethernodes.org may not be accessible via automated requests")
+
+		// The synced page covers every row of the client (e.g. "geth" and
+		// "go-ethereum"), so it is attributed to the first one.
+		for n, i := range indexes {
+			if n == 0 {
+				rows[i].Synced = clientSynced
+				rows[i].Versions = versions
+			} else if withSynced {
+				rows[i].Synced = 0
+			}
 		}
-		return -1, -1, visitErr
 	}
 
-	if scrapeErr != nil {
-		return total, clientNumber, fmt.Errorf("failed to find total or client data: %w", scrapeErr)
+	// Overall synced count of the layer from /sync.
+	var totalSynced int64 = -1
+	if withSynced {
+		totalSynced, err = e.getOverallSynced(ctx, layer)
+		if err != nil {
+			return Distribution{}, fmt.Errorf("failed to get overall synced count: %w", err)
+		}
 	}
 
-	return total, clientNumber, nil
+	return Distribution{
+		Source:      string(e.SourceType()),
+		Network:     e.config.Network,
+		Layer:       layer,
+		Total:       total,
+		TotalSynced: totalSynced,
+		Clients:     addOtherBucket(rows, total, -1),
+		CreatedAt:   time.Now(),
+	}, nil
 }
 
-// processHTML extracts client data from the HTML document
-func processHTML(doc *goquery.Document, clientName configs.ClientType, total *int64, clientNumber *int64, scrapeErr *error) {
-	// Look for Execution Layer Clients section
-	doc.Find("h4").Each(func(i int, s *goquery.Selection) {
-		if strings.Contains(s.Text(), "Execution Layer Clients") {
-			processHTMLFromSelection(s, clientName, total, clientNumber, scrapeErr)
-		}
-	})
-}
+// GetDistribution returns every client row of the layer's clients section,
+// with synced counts for the clients we track.
+func (e EthernodesDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	distribution, err := e.getDistribution(ctx, layer, configs.ClientTypesOf(layer), true, false)
+	if err != nil {
+		return Distribution{}, err
+	}
 
-// processHTMLFromSelection extracts client data from a goquery selection
-func processHTMLFromSelection(s *goquery.Selection, clientName configs.ClientType, total *int64, clientNumber *int64, scrapeErr *error) {
-	slog.Debug("Processing HTML from selection", "clientName", clientName)
-	
-	// Find the parent container that holds all progress groups
-	parent := s.Parent()
-	slog.Debug("Found parent container", "parentLength", parent.Length())
-	
-	// Look for progress groups within this section
-	progressGroups := parent.Find(".progress-group")
-	slog.Debug("Found progress groups", "count", progressGroups.Length())
-	
-	// Process each progress group
-	progressGroups.Each(func(i int, s *goquery.Selection) {
-		// Get the client name and count from the progress group header
-		header := s.Find(".progress-group-header")
-		
-		// Extract client name
-		clientNameElement := header.Find("div").First()
-		clientNameText := strings.TrimSpace(clientNameElement.Text())
-		
-		// Skip if it's the "Total" row
-		if strings.EqualFold(clientNameText, "Total") {
-			// Extract total count
-			countElement := header.Find(".fw-semibold").First()
-			if countElement.Length() > 0 {
-				totalText := strings.TrimSpace(countElement.Text())
-				totalParsed, err := strconv.ParseInt(totalText, 10, 64)
-				if err != nil {
-					*scrapeErr = fmt.Errorf("failed to parse total number: %w", err)
-					return
-				}
-				*total = totalParsed
-				slog.Debug("Found total", "total", *total)
-			}
-			return
-		}
-		
-		// Extract client count
-		countElement := header.Find(".fw-semibold").First()
-		if countElement.Length() > 0 {
-			countText := strings.TrimSpace(countElement.Text())
-			countParsed, err := strconv.ParseInt(countText, 10, 64)
-			if err != nil {
-				*scrapeErr = fmt.Errorf("failed to parse client count: %w", err)
-				return
-			}
-			
-			// Check if this is the client we're looking for
-			// Ethernodes uses different naming conventions than our configs
-			if matchesClientName(clientNameText, clientName) {
-				*clientNumber = countParsed
-				slog.Debug("Found client", "name", clientNameText, "count", *clientNumber)
-			}
-		}
-	})
-}
+	slog.Info("Successfully retrieved ethernodes distribution",
+		"layer", layer,
+		"clients", len(distribution.Clients),
+		"overallTotal", distribution.Total,
+		"overallSynced", distribution.TotalSynced)
 
-// matchesClientName maps our client types to Ethernodes naming conventions
-func matchesClientName(ethernodesName string, clientName configs.ClientType) bool {
-	ethernodesName = strings.ToLower(strings.TrimSpace(ethernodesName))
-	
-	switch clientName {
-	case configs.ClientTypeGeth:
-		// Ethernodes shows "geth" and "go-ethereum" as separate clients
-		// We'll count both as "geth" for our purposes
-		return ethernodesName == "geth" || ethernodesName == "go-ethereum"
-	case configs.ClientTypeNethermind:
-		return ethernodesName == "nethermind"
-	case configs.ClientTypeBesu:
-		return ethernodesName == "besu"
-	case configs.ClientTypeErigon:
-		return ethernodesName == "erigon"
-	case configs.ClientTypeReth:
-		return ethernodesName == "reth"
-	default:
-		return false
-	}
+	return distribution, nil
 }
 
-func (e EthernodesDataSource) GetClientData(clientName configs.ClientType) (ClientData, error) {
-	// First, get the correct total counts from the main page
-	mainURLs := []string{
-		"https://ethernodes.org/",
-		"https://ethernodes.org",
-		"https://www.ethernodes.org/",
-		"https://www.ethernodes.org",
+// GetVersionDistribution returns the layer's client rows with the per-version
+// totals of the given clients. Synced counts are not fetched.
+func (e EthernodesDataSource) GetVersionDistribution(ctx context.Context, layer configs.Layer, clients []configs.ClientType) (Distribution, error) {
+	distribution, err := e.getDistribution(ctx, layer, clients, false, true)
+	if err != nil {
+		return Distribution{}, err
 	}
 
-	var total int64 = -1
-	var clientTotal int64 = -1
-	var lastErr error
-
-	// Try to get data from main page first
-	for _, url := range mainURLs {
-		slog.Debug("Trying main page for total counts", "url", url)
-		overallTotal, clientNumber, _, err := e.getNumbersFromWithContent(url, clientName)
-		if err == nil && overallTotal > 0 && clientNumber > 0 {
-			total = overallTotal
-			clientTotal = clientNumber
-			slog.Info("Successfully retrieved total counts from main page", "url", url, "total", total, "clientTotal", clientTotal)
-			break
-		}
-		lastErr = err
-		slog.Debug("Failed to get data from", "url", url, "error", err)
-		time.Sleep(2 * time.Second)
-	}
+	slog.Info("Successfully retrieved ethernodes version distribution",
+		"layer", layer,
+		"clients", len(clients),
+		"overallTotal", distribution.Total)
 
-	if total <= 0 || clientTotal <= 0 {
-		return ClientData{}, fmt.Errorf("failed to get total counts from any ethernodes.org endpoint: %w", lastErr)
-	}
+	return distribution, nil
+}
 
-	// Per-client synced count from /client/el/<name>?synced=1.
-	clientSynced, err := e.getClientSyncedCount(clientName)
+func (e EthernodesDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	distribution, err := e.getDistribution(ctx, clientName.Layer(), []configs.ClientType{clientName}, true, true)
 	if err != nil {
-		return ClientData{}, fmt.Errorf("failed to get client synced count: %w", err)
-	}
-	if clientSynced > clientTotal {
-		// Defensive: cap at clientTotal so downstream math stays sensible.
-		slog.Warn("clientSynced exceeds clientTotal, capping", "clientSynced", clientSynced, "clientTotal", clientTotal)
-		clientSynced = clientTotal
+		return ClientData{}, err
 	}
 
-	// Overall EL synced count from /sync.
-	totalSynced, err := e.getOverallExecutionLayerSynced()
-	if err != nil {
-		return ClientData{}, fmt.Errorf("failed to get overall synced count: %w", err)
+	client, ok := distribution.Client(clientName)
+	if !ok {
+		return ClientData{}, fmt.Errorf("client %s not listed on %s", clientName, e.endpoints.Primary)
 	}
 
 	slog.Info("Successfully retrieved ethernodes data",
 		"client", clientName,
-		"clientTotal", clientTotal,
-		"clientSynced", clientSynced,
-		"overallTotal", total,
-		"overallSynced", totalSynced)
+		"clientTotal", client.Total,
+		"clientSynced", client.Synced,
+		"overallTotal", distribution.Total,
+		"overallSynced", distribution.TotalSynced,
+		"versions", len(client.Versions))
 
 	return ClientData{
-		Source:       string(e.SourceType()),
+		Source:       distribution.Source,
+		Network:      distribution.Network,
+		Layer:        distribution.Layer,
 		ClientName:   clientName,
-		Total:        total,
-		ClientTotal:  clientTotal,
-		TotalSynced:  totalSynced,
-		ClientSynced: clientSynced,
-		CreatedAt:    time.Now(),
+		Total:        distribution.Total,
+		ClientTotal:  client.Total,
+		TotalSynced:  distribution.TotalSynced,
+		ClientSynced: client.Synced,
+		Versions:     client.Versions,
+		CreatedAt:    distribution.CreatedAt,
 	}, nil
 }
 
@@ -541,229 +386,196 @@ func (e EthernodesDataSource) getClientURLName(clientName configs.ClientType) st
 		return "erigon"
 	case configs.ClientTypeReth:
 		return "reth"
+	case configs.ClientTypeLighthouse:
+		return "lighthouse"
+	case configs.ClientTypePrysm:
+		return "prysm"
+	case configs.ClientTypeTeku:
+		return "teku"
+	case configs.ClientTypeNimbus:
+		return "nimbus"
+	case configs.ClientTypeLodestar:
+		return "lodestar"
+	case configs.ClientTypeGrandine:
+		return "grandine"
 	default:
 		return ""
 	}
 }
 
-// getClientCountFromURL gets the count of nodes from a specific client URL
-func (e EthernodesDataSource) getClientCountFromURL(url string) (int64, error) {
-	// Try direct HTTP request first (like curl)
-	slog.Debug("Trying direct HTTP request for client count", "url", url)
-	
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	
-	// Create request with exact same headers as working curl
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return -1, fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	// Set the exact same User-Agent as the working curl command
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	
-	// Make the request
-	resp, err := client.Do(req)
-	if err != nil {
-		slog.Debug("Direct HTTP request failed", "error", err)
-		return -1, err
+// getClientSyncedCount returns the count of synced nodes for one client, and
+// their per-version counts, as reported by its synced page
+// (/client/<el|cl>/<name>?synced=1 by default).
+// (?synced=0 also exists but does not filter — it returns the same page as no
+// query parameter, so we ignore it and derive unsynced = total - synced.)
+func (e EthernodesDataSource) getClientSyncedCount(ctx context.Context, clientName configs.ClientType) (int64, map[string]int64, error) {
+	clientURLName := e.getClientURLName(clientName)
+	if clientURLName == "" {
+		return -1, nil, fmt.Errorf("unsupported client: %s", clientName)
 	}
-	defer resp.Body.Close()
-	
-	slog.Debug("Direct HTTP request successful", "status", resp.StatusCode, "contentLength", resp.ContentLength)
-	
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+
+	var count int64 = -1
+	var versions map[string]int64
+	err := e.fetchFromEndpoints(ctx, e.endpoints.Paths.SyncedClient, clientName.Layer(), clientURLName, func(syncedURL string) error {
+		slog.Debug("Fetching client synced count", "url", syncedURL)
+		var err error
+		count, versions, err = e.getClientCountWithEnhancedHeaders(ctx, syncedURL, clientName.Layer())
+		return err
+	})
 	if err != nil {
-		slog.Debug("Failed to read response body", "error", err)
-		return -1, err
+		return -1, nil, err
 	}
-	
-	bodyStr := string(body)
-	slog.Debug("Response body length", "length", len(bodyStr))
-	
-	// Check if we got a Cloudflare protection page
-	if strings.Contains(bodyStr, "Just a moment") || strings.Contains(bodyStr, "Cloudflare") {
-		slog.Debug("Detected Cloudflare protection page in direct request")
-		return -1, fmt.Errorf("cloudflare protection detected")
-	}
-	
-	// Parse the HTML using goquery
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
-	if err != nil {
-		slog.Debug("Failed to parse HTML from direct request", "error", err)
-		return -1, err
+	return count, versions, nil
+}
+
+// GetBreakdowns reads the requested breakdowns from one fetch of the client's
+// unfiltered page (/client/<el|cl>/<name> by default).
+func (e EthernodesDataSource) GetBreakdowns(ctx context.Context, clientName configs.ClientType, dimensions []Dimension) ([]Breakdown, error) {
+	clientURLName := e.getClientURLName(clientName)
+	if clientURLName == "" {
+		return nil, fmt.Errorf("unsupported client: %s", clientName)
 	}
-	
-	// Look for the count in the page
-	// Ethernodes client pages typically show the count in a prominent location
-	var count int64 = -1
-	
-	// Try different selectors to find the count
-	selectors := []string{
-		".node-count",
-		".count",
-		"h1", // Sometimes the count is in the main heading
-		".stats-number",
-		"[data-count]",
-	}
-	
-	for _, selector := range selectors {
-		doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-			text := strings.TrimSpace(s.Text())
-			// Look for numbers in the text
-			if strings.Contains(text, "node") || strings.Contains(text, "count") {
-				// Extract numbers from the text
-				words := strings.Fields(text)
-				for _, word := range words {
-					// Remove common punctuation
-					word = strings.Trim(word, ".,!?()[]{}")
-					if parsed, err := strconv.ParseInt(word, 10, 64); err == nil && parsed > 0 {
-						count = parsed
-						slog.Debug("Found count from selector", "selector", selector, "text", text, "count", count)
-						return
-					}
-				}
-			}
-		})
-		if count > 0 {
-			break
+
+	var breakdowns []Breakdown
+	err := e.fetchFromEndpoints(ctx, e.endpoints.Paths.Client, clientName.Layer(), clientURLName, func(clientURL string) error {
+		slog.Debug("Fetching client breakdowns", "url", clientURL, "dimensions", dimensions)
+
+		body, err := e.fetcher.Fetch(ctx, clientURL)
+		if err != nil {
+			return err
 		}
-	}
-	
-	if count > 0 {
-		slog.Debug("Successfully extracted count from client URL", "url", url, "count", count)
-		return count, nil
-	}
-	
-	// If we couldn't find the count, try to parse the page content more broadly
-	slog.Debug("Could not find count with specific selectors, trying broader search")
-	
-	// Look for any large numbers in the page that might be the count
-	doc.Find("body").Each(func(i int, s *goquery.Selection) {
-		text := s.Text()
-		// Use regex to find numbers
-		re := regexp.MustCompile(`\b(\d{1,3}(?:,\d{3})*)\b`)
-		matches := re.FindAllString(text, -1)
-		for _, match := range matches {
-			// Remove commas and parse
-			cleanMatch := strings.ReplaceAll(match, ",", "")
-			if parsed, err := strconv.ParseInt(cleanMatch, 10, 64); err == nil && parsed > 0 {
-				// Prefer larger numbers as they're more likely to be the count
-				if parsed > count {
-					count = parsed
-				}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+		if err != nil {
+			return fmt.Errorf("parse HTML from %s: %w", clientURL, err)
+		}
+		clientTotal, totalErr := e.config.Rules.ExtractCount(e.SourceType(), PageKindClient, clientURL, doc, "total", clientName.Layer())
+		found := map[string]any{"total": clientTotal}
+		defer recordMatches(ctx, clientURL, "breakdowns", doc, found)
+		if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindClient, clientURL, doc, clientName.Layer()); err != nil {
+			return err
+		}
+		if totalErr != nil {
+			return totalErr
+		}
+		if clientTotal <= 0 {
+			return fmt.Errorf("could not extract count from %s", clientURL)
+		}
+
+		breakdowns = make([]Breakdown, 0, len(dimensions))
+		for _, dimension := range dimensions {
+			entries, err := e.config.Rules.Extract(e.SourceType(), PageKindClient, clientURL, doc, string(dimension), clientName.Layer())
+			found[string(dimension)] = len(entries)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s breakdown from %s: %w", dimension, clientURL, err)
+			}
+			if len(entries) == 0 {
+				return fmt.Errorf("could not extract %s breakdown from %s", dimension, clientURL)
 			}
+			breakdowns = append(breakdowns, newBreakdown(string(e.SourceType()), e.config.Network, clientName, dimension, clientTotal, entries))
 		}
+		return nil
 	})
-	
-	if count > 0 {
-		slog.Debug("Found count using broader search", "url", url, "count", count)
-		return count, nil
+	if err != nil {
+		return nil, err
 	}
-	
-	return -1, fmt.Errorf("could not extract count from URL: %s", url)
+	return breakdowns, nil
 }
 
-// getClientSyncedCount returns the count of synced nodes for one client, as
-// reported by https://ethernodes.org/client/el/<name>?synced=1.
-// (?synced=0 also exists but does not filter — it returns the same page as no
-// query parameter, so we ignore it and derive unsynced = total - synced.)
-func (e EthernodesDataSource) getClientSyncedCount(clientName configs.ClientType) (int64, error) {
+// getClientVersionTotals returns the per-version node counts of one client
+// from its unfiltered page (/client/<el|cl>/<name> by default).
+func (e EthernodesDataSource) getClientVersionTotals(ctx context.Context, clientName configs.ClientType) (map[string]int64, error) {
 	clientURLName := e.getClientURLName(clientName)
 	if clientURLName == "" {
-		return -1, fmt.Errorf("unsupported client: %s", clientName)
+		return nil, fmt.Errorf("unsupported client: %s", clientName)
 	}
 
-	syncedURL := fmt.Sprintf("https://ethernodes.org/client/el/%s?synced=1", clientURLName)
-	slog.Debug("Fetching client synced count", "url", syncedURL)
-	return e.getClientCountWithEnhancedHeaders(syncedURL)
+	var versions map[string]int64
+	err := e.fetchFromEndpoints(ctx, e.endpoints.Paths.Client, clientName.Layer(), clientURLName, func(clientURL string) error {
+		slog.Debug("Fetching client versions", "url", clientURL)
+		var err error
+		_, versions, err = e.getClientCountWithEnhancedHeaders(ctx, clientURL, clientName.Layer())
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return fmt.Errorf("could not extract versions from %s", clientURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
 }
 
-// getOverallExecutionLayerSynced returns the overall synced EL node count from
-// https://ethernodes.org/sync (the "Execution Layer Sync Status" section).
-func (e EthernodesDataSource) getOverallExecutionLayerSynced() (int64, error) {
-	const syncURL = "https://ethernodes.org/sync"
-	slog.Debug("Fetching overall execution-layer synced count", "url", syncURL)
+// getOverallSynced returns the overall synced node count of a layer from
+// the sync page (the "<Layer> Sync Status" sections of /sync by default).
+func (e EthernodesDataSource) getOverallSynced(ctx context.Context, layer configs.Layer) (int64, error) {
+	var count int64 = -1
+	err := e.fetchFromEndpoints(ctx, e.endpoints.Paths.Sync, layer, "", func(syncURL string) error {
+		slog.Debug("Fetching overall synced count", "url", syncURL, "layer", layer)
 
-	body, err := e.fetchWithEnhancedHeaders(syncURL)
+		body, err := e.fetcher.Fetch(ctx, syncURL)
+		if err != nil {
+			return err
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+		if err != nil {
+			return fmt.Errorf("parse /sync HTML: %w", err)
+		}
+
+		count, err = e.config.Rules.ExtractCount(e.SourceType(), PageKindSync, syncURL, doc, "synced", layer)
+		recordMatches(ctx, syncURL, "synced", doc, map[string]any{"layer": layer, "synced": count})
+		if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindSync, syncURL, doc, layer); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if count <= 0 {
+			return fmt.Errorf("could not extract synced count from %s", syncURL)
+		}
+		return nil
+	})
 	if err != nil {
 		return -1, err
 	}
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
-	if err != nil {
-		return -1, fmt.Errorf("parse /sync HTML: %w", err)
-	}
-
-	// The page has two sections (Execution Layer, Consensus Layer), each with
-	// progress-groups labelled Total/Synced/Syncing. The first "Synced" group
-	// in DOM order belongs to Execution Layer.
-	count := findProgressGroupTotal(doc, "synced")
-	if count <= 0 {
-		return -1, fmt.Errorf("could not extract synced count from %s", syncURL)
-	}
 	return count, nil
 }
 
-// fetchWithEnhancedHeaders delegates to fetchHTML so callers (the per-client
-// synced page and the /sync overall page) share the same FlareSolverr-aware
-// fetch path as the main-page scraper.
-func (e EthernodesDataSource) fetchWithEnhancedHeaders(url string) ([]byte, error) {
-	return e.fetchHTML(url)
-}
-
-
 // getClientCountWithEnhancedHeaders fetches one of the per-client Ethernodes
-// pages and extracts the "Total" count from its first .progress-group.
-func (e EthernodesDataSource) getClientCountWithEnhancedHeaders(url string) (int64, error) {
-	body, err := e.fetchWithEnhancedHeaders(url)
+// pages and extracts its "Total" count, plus the node count of every version
+// it lists; labels that normalise to the same release are summed.
+func (e EthernodesDataSource) getClientCountWithEnhancedHeaders(ctx context.Context, url string, layer configs.Layer) (int64, map[string]int64, error) {
+	body, err := e.fetcher.Fetch(ctx, url)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
 	if err != nil {
-		return -1, fmt.Errorf("parse HTML from %s: %w", url, err)
+		return -1, nil, fmt.Errorf("parse HTML from %s: %w", url, err)
+	}
+	count, scrapeErr := e.config.Rules.ExtractCount(e.SourceType(), PageKindClient, url, doc, "total", layer)
+	versions := make(map[string]int64)
+	if scrapeErr == nil {
+		var entries []BreakdownEntry
+		entries, scrapeErr = e.config.Rules.Extract(e.SourceType(), PageKindClient, url, doc, "versions", layer)
+		for _, entry := range entries {
+			if version, ok := NormalizeVersion(entry.Label); ok {
+				versions[version] += entry.Count
+			}
+		}
+	}
+	recordMatches(ctx, url, "client", doc, map[string]any{"total": count, "versions": versions})
+	if err := checkLayout(ctx, e.config.Rules, e.SourceType(), PageKindClient, url, doc, layer); err != nil {
+		return -1, nil, err
+	}
+	if scrapeErr != nil {
+		return -1, nil, scrapeErr
 	}
-	count := findProgressGroupTotal(doc, "total")
 	if count <= 0 {
-		return -1, fmt.Errorf("could not extract count from %s", url)
+		return -1, nil, fmt.Errorf("could not extract count from %s", url)
 	}
-	slog.Debug("Successfully extracted count with enhanced headers", "url", url, "count", count)
-	return count, nil
+	slog.Debug("Successfully extracted count with enhanced headers", "url", url, "count", count, "versions", len(versions))
+	return count, versions, nil
 }
-
-// findProgressGroupTotal locates the count value displayed alongside a labelled
-// row inside a Bootstrap-style `.progress-group` block. The Ethernodes per-client
-// pages render their headline numbers as:
-//
-//	<div class="progress-group">
-//	  <div class="progress-group-header ...">
-//	    <div>Total</div>
-//	    <div class="ms-auto fw-semibold me-2">1396</div>
-//	  </div>
-//	</div>
-//
-// Pass `labelLower` lowercased (e.g. "total", "synced", "syncing").
-func findProgressGroupTotal(doc *goquery.Document, labelLower string) int64 {
-	var count int64 = -1
-	doc.Find(".progress-group").EachWithBreak(func(_ int, pg *goquery.Selection) bool {
-		header := pg.Find(".progress-group-header").First()
-		if header.Length() == 0 {
-			return true
-		}
-		if !strings.Contains(strings.ToLower(header.Text()), labelLower) {
-			return true
-		}
-		text := strings.TrimSpace(header.Find(".fw-semibold").First().Text())
-		cleaned := strings.ReplaceAll(text, ",", "")
-		if parsed, err := strconv.ParseInt(cleaned, 10, 64); err == nil && parsed > 0 {
-			count = parsed
-			return false
-		}
-		return true
-	})
-	return count
-} 
@@ -0,0 +1,68 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+// fixtureFetcher serves the fixtures of testdata by URL.
+type fixtureFetcher map[string]string
+
+func (f fixtureFetcher) Fetch(_ context.Context, url string) ([]byte, error) {
+	name, ok := f[url]
+	if !ok {
+		return nil, fmt.Errorf("unexpected fetch of %s", url)
+	}
+	return os.ReadFile(filepath.Join("testdata", name))
+}
+
+func TestEthernodesDataSourceBaseURLWithPath(t *testing.T) {
+	source, err := NewEthernodesDataSource(&EthernodesDataSourceOptions{
+		BaseURL: "https://cache.example/ethernodes/",
+		Paths:   EthernodesPaths{Client: "/{layer}/{client}"},
+		Fetcher: fixtureFetcher{
+			"https://cache.example/ethernodes/":              "ethernodes-main.html",
+			"https://cache.example/ethernodes/el/nethermind": "ethernodes-client.html",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distribution, err := source.GetVersionDistribution(context.Background(), configs.LayerExecution, []configs.ClientType{configs.ClientTypeNethermind})
+	if err != nil {
+		t.Fatalf("GetVersionDistribution() error = %v", err)
+	}
+	client, ok := distribution.Client(configs.ClientTypeNethermind)
+	if !ok {
+		t.Fatalf("GetVersionDistribution() = %+v, want a nethermind row", distribution)
+	}
+	if client.Total != 2104 || len(client.Versions) != 1 || client.Versions[0] != (VersionCount{Version: "1.29.1", Total: 1203}) {
+		t.Errorf("nethermind = %+v, want 2104 nodes and 1203 on 1.29.1", client)
+	}
+}
+
+func TestEthernodesDataSourceClientWithoutNodes(t *testing.T) {
+	// Only the main page is served: a client listed with 0 nodes has no
+	// client page to fetch.
+	source, err := NewEthernodesDataSource(&EthernodesDataSourceOptions{
+		Fetcher: fixtureFetcher{"https://ethernodes.org/": "ethernodes-main.html"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	distribution, err := source.GetVersionDistribution(context.Background(), configs.LayerConsensus, []configs.ClientType{configs.ClientTypePrysm})
+	if err != nil {
+		t.Fatalf("GetVersionDistribution() error = %v", err)
+	}
+	client, ok := distribution.Client(configs.ClientTypePrysm)
+	if !ok || client.Total != 0 {
+		t.Errorf("prysm = %+v, %t; want a row of 0 nodes", client, ok)
+	}
+}
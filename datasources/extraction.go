@@ -0,0 +1,544 @@
+package datasources
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+
+	"client-nodes-reporter/configs"
+)
+
+// ExtractionRulesVersion is the version of the extraction rules format this
+// build reads.
+const ExtractionRulesVersion = 1
+
+// defaultSectionHeadings are the headings a section is looked up under when
+// its rule does not name them.
+const defaultSectionHeadings = "h1, h2, h3, h4, h5, h6"
+
+//go:embed extraction-rules.yaml
+var defaultExtractionRules []byte
+
+// ExtractionRules describe where the numbers are on the pages of each source,
+// so a change of the sites' markup can be followed by editing the rules
+// rather than the code. See extraction-rules.yaml, the rules used by default,
+// for the format:
+//
+//	version: 1
+//	sources:
+//	  ethernodes:
+//	    clients:
+//	      geth: [geth, go-ethereum]
+//	    pages:
+//	      - name: main
+//	        values:
+//	          total:
+//	            - section: {headings: h4, contains: ['{layer} Clients']}
+//	              rows: {selector: .progress-group, label: div, value: .fw-semibold}
+//	              labels: {equals: [Total]}
+type ExtractionRules struct {
+	Version int                             `yaml:"version"`
+	Sources map[DataSourceType]*SourceRules `yaml:"sources"`
+}
+
+// SourceRules are the extraction rules of one source.
+type SourceRules struct {
+	// Clients lists the labels each client is shown under, when not only its
+	// own name.
+	Clients map[configs.ClientType][]string `yaml:"clients"`
+	Pages   []*PageRule                     `yaml:"pages"`
+}
+
+// PageKind is the kind of page a rule reads. The caller knows which page it
+// fetched, so the rule is picked by kind rather than by URL, and a base URL
+// with a path or other page paths need no other rules.
+type PageKind string
+
+const (
+	// PageKindMain lists the clients of every layer: the ethernodes main
+	// page, or the ethernets page of all clients.
+	PageKindMain PageKind = "main"
+	// PageKindClient is the page of one client.
+	PageKindClient PageKind = "client"
+	// PageKindSync is the ethernodes page of the synced counts.
+	PageKindSync PageKind = "sync"
+)
+
+// PageRule reads the values of the pages of one kind, its name.
+type PageRule struct {
+	Name PageKind `yaml:"name"`
+	// Values are the alternatives each value is read with, in order.
+	Values map[string][]ValueRule `yaml:"values"`
+}
+
+// ValueRule reads the rows of one value.
+type ValueRule struct {
+	// Layers restricts the rule to these layers; empty is every layer.
+	Layers []configs.Layer `yaml:"layers"`
+	// Section, when set, restricts the rows to one section of the page.
+	Section *SectionRule `yaml:"section"`
+	Rows    RowRule      `yaml:"rows"`
+	// Labels, when set, keeps the rows whose label matches.
+	Labels *LabelRule `yaml:"labels"`
+	Number NumberRule `yaml:"number"`
+	// Nth, when set, keeps only the nth row left, counting from 0.
+	Nth *int `yaml:"nth"`
+}
+
+// SectionRule finds the section below a heading: the heading's parent.
+// Headings and texts may hold {layer} and {otherLayer}, and texts are
+// matched case-insensitively, like labels.
+type SectionRule struct {
+	// Headings is the selector of the headings; empty is h1 to h6.
+	Headings string `yaml:"headings"`
+	// Contains are texts one of which the heading holds.
+	Contains []string `yaml:"contains"`
+	// Exclude skips sections holding a heading with one of these texts.
+	Exclude []string `yaml:"exclude"`
+}
+
+// RowRule reads a label and a number out of each element matching Selector,
+// either through the Label and Value selectors or through the two groups of
+// Pattern.
+type RowRule struct {
+	Selector string `yaml:"selector"`
+	// Label selects the label within the row; empty is the row itself.
+	Label string `yaml:"label"`
+	// Value selects the number within the row. Rows without one are skipped.
+	Value string `yaml:"value"`
+	// Pattern, when set, matches the text of the row, the label being its
+	// first group and the number its second. Rows it does not match are
+	// skipped.
+	Pattern string `yaml:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// LabelRule matches row labels, case-insensitively. A rule with several
+// conditions matches labels meeting any of them.
+type LabelRule struct {
+	Equals   []string `yaml:"equals"`
+	Contains []string `yaml:"contains"`
+	Pattern  string   `yaml:"pattern"`
+	// Version matches labels that are a client version; see NormalizeVersion.
+	Version bool `yaml:"version"`
+	// Not matches the labels the nested rule does not.
+	Not *LabelRule `yaml:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// NumberRule parses the number of a row.
+type NumberRule struct {
+	// Remove are the texts, such as thousands separators, removed before
+	// parsing; nil is ",".
+	Remove []string `yaml:"remove"`
+	// SkipInvalid skips the rows whose number does not parse, instead of
+	// failing the extraction. Rows whose number is negative are always
+	// skipped.
+	SkipInvalid bool `yaml:"skipInvalid"`
+}
+
+var loadDefaultExtractionRules = sync.OnceValues(func() (*ExtractionRules, error) {
+	return ParseExtractionRules(defaultExtractionRules)
+})
+
+// DefaultExtractionRules returns the rules built into the reporter.
+func DefaultExtractionRules() *ExtractionRules {
+	rules, err := loadDefaultExtractionRules()
+	if err != nil {
+		panic(fmt.Sprintf("invalid default extraction rules: %v", err))
+	}
+	return rules
+}
+
+// LoadExtractionRules reads extraction rules from a YAML file.
+func LoadExtractionRules(path string) (*ExtractionRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extraction rules: %w", err)
+	}
+	return ParseExtractionRules(data)
+}
+
+// ParseExtractionRules parses and validates YAML extraction rules.
+func ParseExtractionRules(data []byte) (*ExtractionRules, error) {
+	var rules ExtractionRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse extraction rules: %w", err)
+	}
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid extraction rules: %w", err)
+	}
+	return &rules, nil
+}
+
+// compile validates the rules and compiles their patterns.
+func (r *ExtractionRules) compile() error {
+	if r.Version != ExtractionRulesVersion {
+		return fmt.Errorf("version %d is not supported, expected %d", r.Version, ExtractionRulesVersion)
+	}
+	for source, rules := range r.Sources {
+		if rules == nil {
+			return fmt.Errorf("%s: no rules", source)
+		}
+		for client := range rules.Clients {
+			if configs.ClientTypeFromString(string(client)) == configs.ClientTypeUnknown {
+				return fmt.Errorf("%s: unknown client %q", source, string(client))
+			}
+		}
+		seen := make(map[PageKind]bool, len(rules.Pages))
+		for i, page := range rules.Pages {
+			if page == nil || page.Name == "" {
+				return fmt.Errorf("%s: page %d has no name", source, i)
+			}
+			if page.Name != PageKindMain && page.Name != PageKindClient && page.Name != PageKindSync {
+				return fmt.Errorf("%s: unknown page %q", source, string(page.Name))
+			}
+			if seen[page.Name] {
+				return fmt.Errorf("%s: page %s is given twice", source, page.Name)
+			}
+			seen[page.Name] = true
+			for name, values := range page.Values {
+				for j := range values {
+					if err := values[j].compile(); err != nil {
+						return fmt.Errorf("%s page %s: %s[%d]: %w", source, page.Name, name, j, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (v *ValueRule) compile() error {
+	for i, name := range v.Layers {
+		layer, ok := configs.LayerFromString(string(name))
+		if !ok {
+			return fmt.Errorf("unknown layer %q", string(name))
+		}
+		v.Layers[i] = layer
+	}
+	if v.Rows.Selector == "" {
+		return fmt.Errorf("rows have no selector")
+	}
+	if v.Rows.Pattern != "" {
+		pattern, err := regexp.Compile(v.Rows.Pattern)
+		if err != nil {
+			return fmt.Errorf("rows pattern: %w", err)
+		}
+		if pattern.NumSubexp() < 2 {
+			return fmt.Errorf("rows pattern %q needs a label and a number group", v.Rows.Pattern)
+		}
+		v.Rows.pattern = pattern
+	} else if v.Rows.Value == "" {
+		return fmt.Errorf("rows have neither a value selector nor a pattern")
+	}
+	if v.Nth != nil && *v.Nth < 0 {
+		return fmt.Errorf("nth must not be negative")
+	}
+	if v.Labels != nil {
+		return v.Labels.compile()
+	}
+	return nil
+}
+
+func (l *LabelRule) compile() error {
+	if l.Pattern != "" {
+		pattern, err := regexp.Compile("(?i)" + l.Pattern)
+		if err != nil {
+			return fmt.Errorf("labels pattern: %w", err)
+		}
+		l.pattern = pattern
+	}
+	if l.Not != nil {
+		return l.Not.compile()
+	}
+	return nil
+}
+
+// pagePath returns the path and query of url.
+func pagePath(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	if parsed.RawQuery != "" {
+		return parsed.Path + "?" + parsed.RawQuery
+	}
+	return parsed.Path
+}
+
+// page returns the rule of source's pages of kind.
+func (r *ExtractionRules) page(source DataSourceType, kind PageKind) (*PageRule, error) {
+	if rules := r.Sources[source]; rules != nil {
+		for _, rule := range rules.Pages {
+			if rule.Name == kind {
+				return rule, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no %s extraction rule for %s pages", source, kind)
+}
+
+// Has reports whether the rule of source's pages of kind reads value.
+func (r *ExtractionRules) Has(source DataSourceType, kind PageKind, value string) bool {
+	page, err := r.page(source, kind)
+	return err == nil && len(page.Values[value]) > 0
+}
+
+// Extract reads value from the page of source at url, a page of kind, for
+// layer. The alternatives of the value are tried in order and the rows of the
+// first yielding any are returned; none is not an error.
+func (r *ExtractionRules) Extract(source DataSourceType, kind PageKind, url string, doc *goquery.Document, value string, layer configs.Layer) ([]BreakdownEntry, error) {
+	page, err := r.page(source, kind)
+	if err != nil {
+		return nil, err
+	}
+	alternatives, ok := page.Values[value]
+	if !ok {
+		return nil, fmt.Errorf("%s extraction rule %s has no %s value", source, page.Name, value)
+	}
+	for _, rule := range alternatives {
+		if len(rule.Layers) > 0 && !slices.Contains(rule.Layers, layer) {
+			continue
+		}
+		rows, err := rule.extract(doc, layer)
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", value, url, err)
+		}
+		if len(rows) > 0 {
+			return rows, nil
+		}
+	}
+	return nil, nil
+}
+
+// ExtractCount reads a single number: the first row of value, or -1 when
+// there is none.
+func (r *ExtractionRules) ExtractCount(source DataSourceType, kind PageKind, url string, doc *goquery.Document, value string, layer configs.Layer) (int64, error) {
+	rows, err := r.Extract(source, kind, url, doc, value, layer)
+	if err != nil || len(rows) == 0 {
+		return -1, err
+	}
+	return rows[0].Count, nil
+}
+
+// ClientType returns the client of layer a label of source stands for, or
+// ClientTypeUnknown.
+func (r *ExtractionRules) ClientType(source DataSourceType, label string, layer configs.Layer) configs.ClientType {
+	label = strings.TrimSpace(label)
+	var aliases map[configs.ClientType][]string
+	if rules := r.Sources[source]; rules != nil {
+		aliases = rules.Clients
+	}
+	for _, client := range configs.ClientTypesOf(layer) {
+		names, ok := aliases[client]
+		if !ok {
+			names = []string{string(client)}
+		}
+		if slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, label) }) {
+			return client
+		}
+	}
+	return configs.ClientTypeUnknown
+}
+
+// Fingerprint returns the structure of a page of source of kind its rule
+// relies on, for layer: how many headings hold each text its sections look
+// for, how many elements match each row selector, and the labels of the
+// rows standing for a known client.
+func (r *ExtractionRules) Fingerprint(source DataSourceType, kind PageKind, doc *goquery.Document, layer configs.Layer) (PageFingerprint, error) {
+	page, err := r.page(source, kind)
+	if err != nil {
+		return PageFingerprint{}, err
+	}
+
+	fingerprint := PageFingerprint{Rule: string(page.Name), Headings: make(map[string]int), Selectors: make(map[string]int)}
+	for _, value := range slices.Sorted(maps.Keys(page.Values)) {
+		for _, rule := range page.Values[value] {
+			if len(rule.Layers) > 0 && !slices.Contains(rule.Layers, layer) {
+				continue
+			}
+			if rule.Section != nil {
+				headings := rule.Section.Headings
+				if headings == "" {
+					headings = defaultSectionHeadings
+				}
+				for _, text := range expandLayer(rule.Section.Contains, layer) {
+					fingerprint.Headings[text] = doc.Find(headings).FilterFunction(func(_ int, h *goquery.Selection) bool {
+						return containsFold(h.Text(), []string{text})
+					}).Length()
+				}
+			}
+			fingerprint.Selectors[rule.Rows.Selector] = doc.Find(rule.Rows.Selector).Length()
+
+			// Rows that do not parse show up as a failed extraction instead.
+			rows, _ := rule.extract(doc, layer)
+			for _, row := range rows {
+				if r.ClientType(source, row.Label, layer) != configs.ClientTypeUnknown && !slices.Contains(fingerprint.Clients, row.Label) {
+					fingerprint.Clients = append(fingerprint.Clients, row.Label)
+				}
+			}
+		}
+	}
+	slices.Sort(fingerprint.Clients)
+	return fingerprint, nil
+}
+
+func (v *ValueRule) extract(doc *goquery.Document, layer configs.Layer) ([]BreakdownEntry, error) {
+	if v.Section == nil {
+		return v.extractIn(doc.Selection)
+	}
+
+	headings := v.Section.Headings
+	if headings == "" {
+		headings = defaultSectionHeadings
+	}
+	contains := expandLayer(v.Section.Contains, layer)
+	exclude := expandLayer(v.Section.Exclude, layer)
+	var rows []BreakdownEntry
+	var err error
+	doc.Find(headings).EachWithBreak(func(_ int, h *goquery.Selection) bool {
+		if !containsFold(h.Text(), contains) {
+			return true
+		}
+		// A container holding the excluded headings too may hold the rows
+		// of another section first.
+		section := h.Parent()
+		if containsFold(section.Find(headings).Text(), exclude) {
+			return true
+		}
+		rows, err = v.extractIn(section)
+		return err == nil && len(rows) == 0
+	})
+	return rows, err
+}
+
+// extractIn reads the rows below scope. Rows whose number is negative are
+// dropped, so no placeholder such as -1 is taken for a count; a client listed
+// with 0 nodes is kept.
+func (v *ValueRule) extractIn(scope *goquery.Selection) ([]BreakdownEntry, error) {
+	var rows []BreakdownEntry
+	var err error
+	scope.Find(v.Rows.Selector).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		label, number, ok := v.Rows.read(s)
+		if !ok || (v.Labels != nil && !v.Labels.matches(label)) {
+			return true
+		}
+		count, parseErr := v.Number.parse(number)
+		if parseErr != nil {
+			if v.Number.SkipInvalid {
+				return true
+			}
+			err = fmt.Errorf("failed to parse count of %s: %w", label, parseErr)
+			return false
+		}
+		if count < 0 {
+			return true
+		}
+		rows = append(rows, BreakdownEntry{Label: label, Count: count})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if v.Nth != nil {
+		if *v.Nth >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[*v.Nth : *v.Nth+1]
+	}
+	return rows, nil
+}
+
+// read returns the label and the number text of a row.
+func (r RowRule) read(s *goquery.Selection) (label, number string, ok bool) {
+	if r.pattern != nil {
+		matches := r.pattern.FindStringSubmatch(s.Text())
+		if matches == nil {
+			return "", "", false
+		}
+		return strings.TrimSpace(matches[1]), matches[2], true
+	}
+
+	labelElement := s
+	if r.Label != "" {
+		labelElement = s.Find(r.Label).First()
+	}
+	valueElement := s.Find(r.Value).First()
+	if valueElement.Length() == 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(labelElement.Text()), valueElement.Text(), true
+}
+
+func (l *LabelRule) matches(label string) bool {
+	if l.Not != nil && !l.Not.matches(label) {
+		return true
+	}
+	lower := strings.ToLower(label)
+	for _, text := range l.Equals {
+		if strings.EqualFold(label, text) {
+			return true
+		}
+	}
+	for _, text := range l.Contains {
+		if strings.Contains(lower, strings.ToLower(text)) {
+			return true
+		}
+	}
+	if l.pattern != nil && l.pattern.MatchString(label) {
+		return true
+	}
+	if l.Version {
+		if _, ok := NormalizeVersion(label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (n NumberRule) parse(text string) (int64, error) {
+	remove := n.Remove
+	if remove == nil {
+		remove = []string{","}
+	}
+	text = strings.TrimSpace(text)
+	for _, r := range remove {
+		text = strings.ReplaceAll(text, r, "")
+	}
+	return strconv.ParseInt(text, 10, 64)
+}
+
+// containsFold reports whether s holds one of substrings, ignoring case.
+func containsFold(s string, substrings []string) bool {
+	s = strings.ToLower(s)
+	return slices.ContainsFunc(substrings, func(substring string) bool {
+		return strings.Contains(s, strings.ToLower(substring))
+	})
+}
+
+// expandLayer replaces {layer} and {otherLayer} in texts.
+func expandLayer(texts []string, layer configs.Layer) []string {
+	other := configs.LayerConsensus
+	if layer == configs.LayerConsensus {
+		other = configs.LayerExecution
+	}
+	replacer := strings.NewReplacer("{layer}", layer.String(), "{otherLayer}", other.String())
+	expanded := make([]string, len(texts))
+	for i, text := range texts {
+		expanded[i] = replacer.Replace(text)
+	}
+	return expanded
+}
@@ -0,0 +1,187 @@
+package datasources
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"client-nodes-reporter/configs"
+)
+
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDefaultExtractionRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  DataSourceType
+		fixture string
+		kind    PageKind
+		value   string
+		layer   configs.Layer
+		want    []BreakdownEntry
+	}{
+		{
+			name:    "ethernodes execution total",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-main.html",
+			kind:    PageKindMain,
+			value:   "total",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "Total", Count: 7480}},
+		},
+		{
+			name:    "ethernodes execution clients drop negative counts",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-main.html",
+			kind:    PageKindMain,
+			value:   "clients",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "geth", Count: 3912}, {Label: "nethermind", Count: 2104}, {Label: "go-ethereum", Count: 15}},
+		},
+		{
+			name:    "ethernodes consensus heading matched case-insensitively and zero row kept",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-main.html",
+			kind:    PageKindMain,
+			value:   "clients",
+			layer:   configs.LayerConsensus,
+			want:    []BreakdownEntry{{Label: "lighthouse", Count: 4311}, {Label: "prysm", Count: 0}},
+		},
+		{
+			name:    "ethernodes client total",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-client.html",
+			kind:    PageKindClient,
+			value:   "total",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "Total nodes", Count: 2104}},
+		},
+		{
+			name:    "ethernodes client versions skip invalid counts",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-client.html",
+			kind:    PageKindClient,
+			value:   "versions",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "v1.29.1", Count: 1203}},
+		},
+		{
+			name:    "ethernodes client provider",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-client.html",
+			kind:    PageKindClient,
+			value:   "provider",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "Hetzner", Count: 640}},
+		},
+		{
+			name:    "ethernodes client os skips hosting",
+			source:  DataSourceTypeEthernodes,
+			fixture: "ethernodes-client.html",
+			kind:    PageKindClient,
+			value:   "os",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "linux", Count: 2001}},
+		},
+		{
+			name:    "ethernets total",
+			source:  DataSourceTypeEthernets,
+			fixture: "ethernets-clients.html",
+			kind:    PageKindMain,
+			value:   "total",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "Total", Count: 5210}},
+		},
+		{
+			name:    "ethernets clients",
+			source:  DataSourceTypeEthernets,
+			fixture: "ethernets-clients.html",
+			kind:    PageKindMain,
+			value:   "clients",
+			layer:   configs.LayerExecution,
+			want:    []BreakdownEntry{{Label: "Geth", Count: 2830}, {Label: "Nethermind", Count: 1466}, {Label: "Erigon", Count: 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DefaultExtractionRules().Extract(tt.source, tt.kind, tt.fixture, loadFixture(t, tt.fixture), tt.value, tt.layer)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Extract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCountWithoutRows(t *testing.T) {
+	doc := loadFixture(t, "ethernodes-main.html")
+	count, err := DefaultExtractionRules().ExtractCount(DataSourceTypeEthernodes, PageKindSync, "https://ethernodes.org/sync", doc, "synced", configs.LayerExecution)
+	if err != nil || count != -1 {
+		t.Errorf("ExtractCount() = %d, %v; want -1, nil", count, err)
+	}
+}
+
+func TestExtractionRulesInvalidNumber(t *testing.T) {
+	const rules = `
+version: 1
+sources:
+  ethernodes:
+    pages:
+      - name: client
+        values:
+          versions:
+            - rows: {selector: .progress-group-header, label: div, value: .fw-semibold}
+              labels: {version: true}
+`
+	parsed, err := ParseExtractionRules([]byte(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parsed.Extract(DataSourceTypeEthernodes, PageKindClient, "https://ethernodes.org/client/execution/nethermind", loadFixture(t, "ethernodes-client.html"), "versions", configs.LayerExecution)
+	if err == nil || !strings.Contains(err.Error(), "v1.28.0") {
+		t.Errorf("Extract() error = %v, want the count of v1.28.0 failing to parse", err)
+	}
+}
+
+func TestParseExtractionRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"version", "version: 2", "version 2 is not supported"},
+		{"unknown client", "version: 1\nsources: {ethernodes: {clients: {parity: [parity]}}}", `unknown client "parity"`},
+		{"page without name", "version: 1\nsources: {ethernodes: {pages: [{values: {}}]}}", "page 0 has no name"},
+		{"unknown page", "version: 1\nsources: {ethernodes: {pages: [{name: index}]}}", `unknown page "index"`},
+		{"page twice", "version: 1\nsources: {ethernodes: {pages: [{name: main}, {name: main}]}}", "page main is given twice"},
+		{"rows without selector", "version: 1\nsources: {ethernodes: {pages: [{name: main, values: {total: [{rows: {value: span}}]}}]}}", "rows have no selector"},
+		{"pattern without groups", "version: 1\nsources: {ethernodes: {pages: [{name: main, values: {total: [{rows: {selector: span, pattern: '\\d+'}}]}}]}}", "needs a label and a number group"},
+		{"unknown layer", "version: 1\nsources: {ethernodes: {pages: [{name: main, values: {total: [{layers: [data], rows: {selector: span, value: b}}]}}]}}", `unknown layer "data"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExtractionRules([]byte(tt.rules))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseExtractionRules() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
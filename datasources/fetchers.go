@@ -0,0 +1,483 @@
+package datasources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Fetcher returns the HTML body of a page.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+type FetchStrategy string
+
+const (
+	// FetchStrategyAuto goes through FlareSolverr when it is configured, and
+	// otherwise direct with colly as the fallback.
+	FetchStrategyAuto         FetchStrategy = "auto"
+	FetchStrategyDirect       FetchStrategy = "direct"
+	FetchStrategyFlareSolverr FetchStrategy = "flaresolverr"
+	FetchStrategyColly        FetchStrategy = "colly"
+)
+
+func FetchStrategyFromString(s string) (FetchStrategy, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return FetchStrategyAuto, nil
+	case "direct":
+		return FetchStrategyDirect, nil
+	case "flaresolverr":
+		return FetchStrategyFlareSolverr, nil
+	case "colly":
+		return FetchStrategyColly, nil
+	default:
+		return "", fmt.Errorf("invalid fetch strategy: %s", s)
+	}
+}
+
+// FetcherOptions configure the fetchers built by NewFetcher.
+type FetcherOptions struct {
+	// Strategies are tried in order; more than one builds a ChainFetcher.
+	Strategies []FetchStrategy
+	// FlareSolverrURLs are the FlareSolverr v1 endpoints, at least one of
+	// which is required by the flaresolverr strategy.
+	FlareSolverrURLs []string
+	// Proxies, when set, are rotated by the direct and FlareSolverr fetchers.
+	Proxies *ProxyPool
+	// Archive, when set, keeps every fetched page.
+	Archive *PageArchive
+	// Transport of the requests that do not go through a proxy; nil is
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Referer sent by the direct fetcher.
+	Referer           string
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+}
+
+// NewFetcher builds the fetcher of the given strategies.
+func NewFetcher(options FetcherOptions) (Fetcher, error) {
+	if len(options.Strategies) == 0 {
+		options.Strategies = []FetchStrategy{FetchStrategyAuto}
+	}
+
+	// Every fetcher of the run shares the clearance of the FlareSolverr solves.
+	clearance := new(Clearance)
+	client := &http.Client{Transport: options.Transport, Timeout: 30 * time.Second}
+	fetchers := make([]Fetcher, 0, len(options.Strategies))
+	for _, strategy := range options.Strategies {
+		switch strategy {
+		case FetchStrategyAuto:
+			// Once FlareSolverr has solved a challenge, pages go direct with its
+			// clearance. FlareSolverr comes last so its failure is surfaced
+			// rather than masked by a raw Go client that has already been
+			// blocked at this IP.
+			if len(options.FlareSolverrURLs) > 0 {
+				fetchers = append(fetchers, &ChainFetcher{Fetchers: []Fetcher{
+					&DirectFetcher{Client: client, Referer: options.Referer, Clearance: clearance, RequireClearance: true, Proxies: options.Proxies},
+					&FlareSolverrFetcher{URLs: options.FlareSolverrURLs, Clearance: clearance, Proxies: options.Proxies, Transport: options.Transport},
+				}})
+			} else {
+				fetchers = append(fetchers, &ChainFetcher{Fetchers: []Fetcher{
+					&DirectFetcher{Client: client, Referer: options.Referer, Proxies: options.Proxies},
+					&CollyFetcher{MaxRetries: options.MaxRetries, InitialRetryDelay: options.InitialRetryDelay, Transport: options.Transport},
+				}})
+			}
+		case FetchStrategyDirect:
+			fetchers = append(fetchers, &DirectFetcher{Client: client, Referer: options.Referer, Clearance: clearance, Proxies: options.Proxies})
+		case FetchStrategyFlareSolverr:
+			if len(options.FlareSolverrURLs) == 0 {
+				return nil, fmt.Errorf("flaresolverr fetch strategy requires a flaresolverr url")
+			}
+			fetchers = append(fetchers, &FlareSolverrFetcher{URLs: options.FlareSolverrURLs, Clearance: clearance, Proxies: options.Proxies, Transport: options.Transport})
+		case FetchStrategyColly:
+			fetchers = append(fetchers, &CollyFetcher{MaxRetries: options.MaxRetries, InitialRetryDelay: options.InitialRetryDelay, Transport: options.Transport})
+		default:
+			return nil, fmt.Errorf("invalid fetch strategy: %s", strategy)
+		}
+	}
+
+	var fetcher Fetcher = &ChainFetcher{Fetchers: fetchers}
+	if len(fetchers) == 1 {
+		fetcher = fetchers[0]
+	}
+	if options.Archive != nil {
+		fetcher = &ArchiveFetcher{Fetcher: fetcher, Archive: options.Archive}
+	}
+	return fetcher, nil
+}
+
+// closeFetcher closes fetcher when it holds resources for the run, such as a
+// FlareSolverr session.
+func closeFetcher(fetcher Fetcher) error {
+	if closer, ok := fetcher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ChainFetcher tries each fetcher in order until one succeeds.
+type ChainFetcher struct {
+	Fetchers []Fetcher
+	// Fallback decides whether an error moves on to the next fetcher. When
+	// nil, every error does except a cancelled or expired context and a
+	// block that retrying cannot get past.
+	Fallback func(err error) bool
+}
+
+func (f *ChainFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	var errs []error
+	for i, fetcher := range f.Fetchers {
+		body, err := fetcher.Fetch(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		errs = append(errs, err)
+		if block, ok := BlockFrom(err); ok {
+			slog.Log(ctx, block.logLevel(), "Fetch blocked",
+				"url", url,
+				"kind", block.Kind,
+				"status", block.Status,
+				"rayID", block.RayID,
+				"action", block.Action())
+		}
+		if i == len(f.Fetchers)-1 || !f.fallback(err) {
+			break
+		}
+		slog.Debug("Fetch failed, trying next fetcher", "url", url, "error", err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Close closes every fetcher of the chain that holds resources.
+func (f *ChainFetcher) Close() error {
+	var errs []error
+	for _, fetcher := range f.Fetchers {
+		errs = append(errs, closeFetcher(fetcher))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *ChainFetcher) fallback(err error) bool {
+	if f.Fallback != nil {
+		return f.Fallback(err)
+	}
+	if block, ok := BlockFrom(err); ok && block.Action() == BlockActionGiveUp {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// browserUserAgent is the User-Agent of the direct fetcher.
+const browserUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// setBrowserHeaders makes a request look like a Chrome navigation.
+func setBrowserHeaders(header http.Header) {
+	header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
+	header.Set("Accept-Language", "en-US,en;q=0.9")
+	header.Set("Accept-Encoding", "gzip, deflate")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Pragma", "no-cache")
+	header.Set("Sec-Ch-Ua", "\"Not_A Brand\";v=\"8\", \"Chromium\";v=\"120\", \"Google Chrome\";v=\"120\"")
+	header.Set("Sec-Ch-Ua-Mobile", "?0")
+	header.Set("Sec-Fetch-Dest", "document")
+	header.Set("Sec-Fetch-Mode", "navigate")
+	header.Set("Sec-Fetch-Site", "none")
+	header.Set("Sec-Fetch-User", "?1")
+	header.Set("Upgrade-Insecure-Requests", "1")
+}
+
+// errNoClearance is returned by a DirectFetcher that requires a clearance
+// before FlareSolverr has obtained one.
+var errNoClearance = errors.New("no cloudflare clearance yet")
+
+// DirectFetcher does a browser-shaped GET with net/http.
+type DirectFetcher struct {
+	// Client defaults to an http.Client with a 30s timeout. It is not used
+	// when the request goes through a proxy of Proxies.
+	Client  *http.Client
+	Referer string
+	// Clearance, when it holds a cf_clearance cookie for the host obtained
+	// through the egress of the request, is sent with the request together
+	// with the user agent that obtained it.
+	Clearance *Clearance
+	// RequireClearance skips the request until a clearance is available.
+	RequireClearance bool
+	// Proxies, when set, are rotated between requests, moving on to the next
+	// proxy when one fails or is blocked.
+	Proxies *ProxyPool
+}
+
+func (f *DirectFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	if f.Proxies == nil {
+		body, err := f.fetch(ctx, url, nil)
+		if waitOutRateLimit(ctx, err) {
+			return f.fetch(ctx, url, nil)
+		}
+		return body, err
+	}
+
+	// A clearance only holds from the egress that obtained it, so requests
+	// carrying one go through the proxy of a solve, the latest first,
+	// instead of rotating.
+	if f.Clearance != nil {
+		var errs []error
+		for _, proxy := range f.Clearance.Proxies() {
+			if proxy == nil {
+				continue
+			}
+			body, err := f.fetch(ctx, url, proxy)
+			if errors.Is(err, errNoClearance) {
+				continue
+			}
+			f.Proxies.Record(proxy, err)
+			if err == nil {
+				return body, nil
+			}
+			errs = append(errs, fmt.Errorf("via %s: %w", proxy, err))
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+	}
+	if f.RequireClearance {
+		return nil, errNoClearance
+	}
+
+	var errs []error
+	for range f.Proxies.Len() {
+		proxy := f.Proxies.Next()
+		body, err := f.fetch(ctx, url, proxy)
+		f.Proxies.Record(proxy, err)
+		if err == nil {
+			return body, nil
+		}
+		errs = append(errs, fmt.Errorf("via %s: %w", proxy, err))
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Debug("Fetch through proxy failed, rotating", "proxy", proxy, "error", err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetch does the request, through proxy when it is non-nil.
+func (f *DirectFetcher) fetch(ctx context.Context, url string, proxy *Proxy) ([]byte, error) {
+	client := f.Client
+	if proxy != nil {
+		client = proxy.client(30 * time.Second)
+	} else if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", browserUserAgent)
+	setBrowserHeaders(req.Header)
+	req.Header.Set("Sec-Ch-Ua-Platform", "\"macOS\"")
+	if f.Referer != "" {
+		req.Header.Set("Referer", f.Referer)
+	}
+	cleared := f.Clearance != nil && f.Clearance.apply(req, proxy)
+	if f.RequireClearance && !cleared {
+		return nil, errNoClearance
+	}
+
+	record := FetchRecord{URL: url, Fetcher: string(FetchStrategyDirect), Started: time.Now()}
+	if proxy != nil {
+		record.Via = proxy.String()
+		slog.Debug("Fetching directly", "url", url, "withClearance", cleared, "proxy", proxy)
+	} else {
+		slog.Debug("Fetching directly", "url", url, "withClearance", cleared)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		recordFetch(ctx, record, nil, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	record.Status = resp.StatusCode
+	record.Header = resp.Header
+
+	body, err := readMaybeGzip(resp)
+	if err == nil {
+		if block := classifyBlock(url, resp.StatusCode, resp.Header, body); block != nil {
+			err = block
+			if cleared {
+				f.Clearance.discard(proxy)
+			}
+		}
+	}
+	recordFetch(ctx, record, body, err)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readMaybeGzip reads a response body, decompressing it when the server
+// returned Content-Encoding: gzip. net/http only auto-decompresses when
+// the caller did NOT set Accept-Encoding explicitly — code paths that set
+// it manually (to look browser-like for Cloudflare) must decompress here.
+func readMaybeGzip(resp *http.Response) ([]byte, error) {
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return raw, nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gr.Close()
+	return io.ReadAll(gr)
+}
+
+// collyUserAgents are rotated between colly fetches to avoid detection.
+var collyUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/121.0",
+}
+
+// collyRandomDelay bounds the random pause after each colly request, so the
+// colly fallback does not burst requests at the site.
+const collyRandomDelay = 5 * time.Second
+
+// CollyFetcher fetches with a colly collector, retrying failed requests with
+// exponential backoff. A 403 that is not a block page is still returned, as
+// ethernodes serves its content with that status to some clients.
+type CollyFetcher struct {
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+	// Transport defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+func (f *CollyFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	var body []byte
+	var fetchErr error
+	retries := 0
+	var started time.Time
+
+	c := newCollector(ctx, f.Transport,
+		colly.MaxDepth(1),
+		colly.AllowURLRevisit(),
+	)
+	c.UserAgent = collyUserAgents[time.Now().UnixNano()%int64(len(collyUserAgents))]
+	if err := c.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: 1,
+		RandomDelay: collyRandomDelay,
+	}); err != nil {
+		return nil, fmt.Errorf("limit colly collector: %w", err)
+	}
+
+	c.OnRequest(func(r *colly.Request) {
+		setBrowserHeaders(*r.Headers)
+		r.Headers.Set("Sec-Ch-Ua-Platform", "\"Windows\"")
+		started = time.Now()
+		slog.Debug("Visiting", "url", r.URL)
+	})
+
+	record := func(r *colly.Response, err error) {
+		recordFetch(ctx, FetchRecord{
+			URL:     url,
+			Fetcher: string(FetchStrategyColly),
+			Status:  r.StatusCode,
+			Header:  headerOf(r),
+			Started: started,
+		}, r.Body, err)
+	}
+
+	c.OnResponse(func(r *colly.Response) {
+		if block := classifyBlock(url, r.StatusCode, headerOf(r), r.Body); block != nil {
+			record(r, block)
+			fetchErr = block
+			return
+		}
+		record(r, nil)
+		body = r.Body
+	})
+
+	c.OnError(func(r *colly.Response, err error) {
+		slog.Debug("HTTP Error", "status", r.StatusCode, "error", err, "url", r.Request.URL)
+		block := classifyBlock(url, r.StatusCode, headerOf(r), r.Body)
+		if block != nil {
+			record(r, block)
+		} else {
+			record(r, err)
+		}
+		if block != nil && block.Action() != BlockActionWait {
+			fetchErr = block
+			return
+		}
+		if block == nil && r.StatusCode == http.StatusForbidden && len(r.Body) > 0 {
+			slog.Debug("Received 403 Forbidden, using response body", "bodyLength", len(r.Body))
+			body = r.Body
+			return
+		}
+
+		fetchErr = err
+		if block != nil {
+			fetchErr = block
+		}
+		if retries >= f.MaxRetries {
+			slog.Debug("Max retries reached, giving up", "error", fetchErr, "retries", retries)
+			return
+		}
+		slog.Debug("Error during http request. Retrying...", "error", fetchErr, "retries", retries)
+		delay := time.Duration(int64(f.InitialRetryDelay) * (1 << uint(retries)))
+		if block != nil && block.RetryAfter > delay {
+			delay = block.RetryAfter
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			fetchErr = err
+			return
+		}
+		retries++
+		r.Request.Retry()
+	})
+
+	visitErr := c.Visit(url)
+	if body != nil {
+		return body, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	if visitErr != nil {
+		return nil, visitErr
+	}
+	return nil, fmt.Errorf("empty response from %s", url)
+}
+
+// headerOf returns the headers of a colly response, nil when it has none.
+func headerOf(r *colly.Response) http.Header {
+	if r.Headers == nil {
+		return nil
+	}
+	return *r.Headers
+}
@@ -0,0 +1,118 @@
+package datasources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// countingFetcher returns body, or err when it is set, and counts its calls.
+type countingFetcher struct {
+	body  string
+	err   error
+	calls int
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.body), nil
+}
+
+func TestChainFetcher(t *testing.T) {
+	const url = "https://ethernodes.org/"
+	challenge := &BlockError{URL: url, Kind: BlockKindJSChallenge, Status: http.StatusForbidden}
+	solverChallenge := &BlockError{URL: url, Kind: BlockKindJSChallenge, Status: http.StatusForbidden, ViaFlareSolverr: true}
+	firewall := &BlockError{URL: url, Kind: BlockKindFirewall, Status: http.StatusForbidden, Code: 1020}
+
+	tests := []struct {
+		name      string
+		fetchers  []*countingFetcher
+		fallback  func(err error) bool
+		wantBody  string
+		wantCalls []int
+		wantBlock *BlockError
+	}{
+		{
+			name:      "first succeeds",
+			fetchers:  []*countingFetcher{{body: "direct"}, {body: "solver"}},
+			wantBody:  "direct",
+			wantCalls: []int{1, 0},
+		},
+		{
+			name:      "stops at the first fetcher not blocked",
+			fetchers:  []*countingFetcher{{err: challenge}, {body: "solver"}, {body: "colly"}},
+			wantBody:  "solver",
+			wantCalls: []int{1, 1, 0},
+		},
+		{
+			name:      "falls back after any other error",
+			fetchers:  []*countingFetcher{{err: errors.New("connection reset")}, {body: "colly"}},
+			wantBody:  "colly",
+			wantCalls: []int{1, 1},
+		},
+		{
+			name:      "all blocked",
+			fetchers:  []*countingFetcher{{err: fmt.Errorf("via http://a:1: %w", challenge)}, {err: fmt.Errorf("http://solver/v1: %w", solverChallenge)}},
+			wantCalls: []int{1, 1},
+			wantBlock: solverChallenge,
+		},
+		{
+			name:      "gives up on a firewall block",
+			fetchers:  []*countingFetcher{{err: firewall}, {body: "solver"}},
+			wantCalls: []int{1, 0},
+			wantBlock: firewall,
+		},
+		{
+			name:      "cancelled",
+			fetchers:  []*countingFetcher{{err: fmt.Errorf("fetch: %w", context.Canceled)}, {body: "solver"}},
+			wantCalls: []int{1, 0},
+		},
+		{
+			name:      "custom fallback",
+			fetchers:  []*countingFetcher{{err: challenge}, {body: "solver"}},
+			fallback:  func(err error) bool { return false },
+			wantCalls: []int{1, 0},
+			wantBlock: challenge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &ChainFetcher{Fallback: tt.fallback}
+			for _, fetcher := range tt.fetchers {
+				chain.Fetchers = append(chain.Fetchers, fetcher)
+			}
+
+			body, err := chain.Fetch(context.Background(), url)
+			if tt.wantBody != "" {
+				if err != nil || string(body) != tt.wantBody {
+					t.Errorf("Fetch() = %q, %v, want %q", body, err, tt.wantBody)
+				}
+			} else if err == nil {
+				t.Errorf("Fetch() = %q, want an error", body)
+			}
+			for i, fetcher := range tt.fetchers {
+				if fetcher.calls != tt.wantCalls[i] {
+					t.Errorf("fetcher %d called %d times, want %d", i, fetcher.calls, tt.wantCalls[i])
+				}
+			}
+			if tt.wantBlock != nil {
+				block, ok := BlockFrom(err)
+				if !ok || block != tt.wantBlock {
+					t.Errorf("BlockFrom(%v) = %+v, want the block of the last fetcher tried", err, block)
+				}
+			}
+			if tt.wantBody == "" {
+				for i, fetcher := range tt.fetchers {
+					if fetcher.calls > 0 && !errors.Is(err, fetcher.err) {
+						t.Errorf("Fetch() error = %v, want it to wrap the error of fetcher %d", err, i)
+					}
+				}
+			}
+		})
+	}
+}
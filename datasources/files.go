@@ -0,0 +1,143 @@
+package datasources
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+// FileDataSourceOptions configure a data source that parses saved pages.
+type FileDataSourceOptions struct {
+	// Paths are saved HTML files, or directories holding them. See
+	// SnapshotName for the file name each page is looked up under.
+	Paths []string
+	// Format is the site the pages were saved from: DataSourceTypeEthernodes
+	// or DataSourceTypeEthernets.
+	Format  DataSourceType
+	Network configs.Network
+	// Rules say where the numbers are on each page; nil is
+	// DefaultExtractionRules.
+	Rules *ExtractionRules
+}
+
+// NewFileDataSource returns the data source of Format reading its pages from
+// saved HTML files instead of the network, e.g. during a Cloudflare outage
+// or where the sites cannot be reached. The data it returns is that of
+// Format, so it is recorded and reported alongside the fetched data.
+func NewFileDataSource(cfg *FileDataSourceOptions) (DataSource, error) {
+	fetcher, err := NewFileFetcher(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Format {
+	case DataSourceTypeEthernodes, "":
+		return NewEthernodesDataSource(&EthernodesDataSourceOptions{
+			// Every mirror would be looked up under the same file name.
+			Mirrors: []string{},
+			Network: cfg.Network,
+			Fetcher: fetcher,
+			Rules:   cfg.Rules,
+		})
+	case DataSourceTypeEthernets:
+		return NewEthernetsDataSource(&EthernetsDataSourceOptions{
+			Network: cfg.Network,
+			Fetcher: fetcher,
+			Rules:   cfg.Rules,
+		})
+	default:
+		return nil, fmt.Errorf("invalid file format: %q", cfg.Format)
+	}
+}
+
+// FileFetcher serves saved pages instead of fetching them.
+type FileFetcher struct {
+	// files maps the SnapshotName of each page to its file.
+	files map[string]string
+}
+
+// NewFileFetcher indexes the .html and .htm files among paths, and in the
+// directories among them, by their name without the extension.
+func NewFileFetcher(paths []string) (*FileFetcher, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no saved pages given")
+	}
+
+	f := &FileFetcher{files: make(map[string]string)}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("read saved pages: %w", err)
+		}
+		if !info.IsDir() {
+			f.add(path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				f.add(file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read saved pages: %w", err)
+		}
+	}
+	if len(f.files) == 0 {
+		return nil, fmt.Errorf("no .html files in %s", strings.Join(paths, ", "))
+	}
+	return f, nil
+}
+
+func (f *FileFetcher) add(file string) {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext != ".html" && ext != ".htm" {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if previous, ok := f.files[name]; ok {
+		slog.Warn("Saved page shadows another one of the same name", "file", file, "shadowed", previous)
+	}
+	f.files[name] = file
+}
+
+func (f *FileFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	name := SnapshotName(url)
+	file, ok := f.files[name]
+	if !ok {
+		return nil, fmt.Errorf("no saved page for %s: expected %s.html among %s", url, name, strings.Join(slices.Sorted(maps.Keys(f.files)), ", "))
+	}
+	slog.Debug("Reading saved page", "url", url, "file", file)
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read saved page: %w", err)
+	}
+	recordFetch(ctx, FetchRecord{URL: url, Fetcher: "file", Via: file, Started: time.Now()}, body, nil)
+	return body, nil
+}
+
+// SnapshotName is the file name, without extension, a page is saved under:
+// its path and query with every run of other characters than letters,
+// digits, dots, dashes and underscores replaced by "_", or "index" for the
+// home page. For example, https://ethernodes.org/client/el/nethermind?synced=1
+// is saved as client_el_nethermind_synced_1.html and https://ethernodes.org/
+// as index.html.
+func SnapshotName(url string) string {
+	name := strings.Trim(unsafePathChars.ReplaceAllString(pagePath(url), "_"), "_")
+	if name == "" {
+		return "index"
+	}
+	return name
+}
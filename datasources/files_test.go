@@ -0,0 +1,71 @@
+package datasources
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://ethernodes.org/", "index"},
+		{"https://ethernodes.org", "index"},
+		{"https://ethernodes.org/client/el/nethermind", "client_el_nethermind"},
+		{"https://ethernodes.org/client/el/nethermind?synced=1", "client_el_nethermind_synced_1"},
+		{"https://ethernets.org/?synced=false", "synced_false"},
+	}
+	for _, tt := range tests {
+		if got := SnapshotName(tt.url); got != tt.want {
+			t.Errorf("SnapshotName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"index.html":                     "main",
+		"pages/client_el_nethermind.HTM": "nethermind",
+		"notes.txt":                      "not a page",
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetcher, err := NewFileFetcher([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for url, want := range map[string]string{
+		"https://ethernodes.org/":                     "main",
+		"https://ethernodes.org/client/el/nethermind": "nethermind",
+	} {
+		body, err := fetcher.Fetch(context.Background(), url)
+		if err != nil || string(body) != want {
+			t.Errorf("Fetch(%q) = %q, %v; want %q", url, body, err, want)
+		}
+	}
+	if _, err := fetcher.Fetch(context.Background(), "https://ethernodes.org/client/el/geth"); err == nil || !strings.Contains(err.Error(), "expected client_el_geth.html") {
+		t.Errorf("Fetch() of a page not saved error = %v, want the expected file name", err)
+	}
+
+	if _, err := NewFileFetcher([]string{filepath.Join(dir, "notes.txt")}); err == nil {
+		t.Error("NewFileFetcher() without .html files error = nil, want one")
+	}
+	if _, err := NewFileFetcher(nil); err == nil {
+		t.Error("NewFileFetcher() without paths error = nil, want one")
+	}
+	if _, err := NewFileDataSource(&FileDataSourceOptions{Paths: []string{dir}, Format: "rpc"}); err == nil {
+		t.Error("NewFileDataSource() of an unknown format error = nil, want one")
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,76 +20,162 @@ import (
 // challenges can take 20s+, so 60s is the smallest value that reliably succeeds.
 const flareSolverrMaxTimeout = 60 * time.Second
 
+// flareSolverrSessionTimeout bounds the session commands, which only start or
+// stop a browser and never wait on the target site.
+const flareSolverrSessionTimeout = 30 * time.Second
+
 type flareSolverrRequest struct {
-	Cmd        string `json:"cmd"`
-	URL        string `json:"url"`
-	MaxTimeout int    `json:"maxTimeout"`
+	Cmd        string             `json:"cmd"`
+	URL        string             `json:"url,omitempty"`
+	Session    string             `json:"session,omitempty"`
+	MaxTimeout int                `json:"maxTimeout,omitempty"`
+	Proxy      *flareSolverrProxy `json:"proxy,omitempty"`
+}
+
+// flareSolverrProxy is the egress of the browser. FlareSolverr takes the
+// credentials apart from the URL.
+type flareSolverrProxy struct {
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+func newFlareSolverrProxy(proxy *Proxy) *flareSolverrProxy {
+	if proxy == nil {
+		return nil
+	}
+	withoutUser := *proxy.URL
+	withoutUser.User = nil
+	converted := &flareSolverrProxy{URL: withoutUser.String()}
+	if proxy.URL.User != nil {
+		converted.Username = proxy.URL.User.Username()
+		converted.Password, _ = proxy.URL.User.Password()
+	}
+	return converted
+}
+
+type flareSolverrCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires"`
+	HTTPOnly bool    `json:"httpOnly"`
+	Secure   bool    `json:"secure"`
+}
+
+type flareSolverrSolution struct {
+	URL       string               `json:"url"`
+	Status    int                  `json:"status"`
+	Response  string               `json:"response"`
+	Cookies   []flareSolverrCookie `json:"cookies"`
+	UserAgent string               `json:"userAgent"`
+	Headers   map[string]string    `json:"headers"`
 }
 
 type flareSolverrResponse struct {
-	Status   string `json:"status"`
-	Message  string `json:"message"`
-	Solution struct {
-		URL      string `json:"url"`
-		Status   int    `json:"status"`
-		Response string `json:"response"`
-	} `json:"solution"`
-}
-
-// fetchViaFlareSolverr fetches targetURL through a FlareSolverr v1 endpoint
-// (e.g. http://localhost:8191/v1) and returns the rendered HTML body plus the
-// upstream HTTP status FlareSolverr observed when fetching the target.
-func fetchViaFlareSolverr(solverURL, targetURL string) (string, int, error) {
-	body, err := json.Marshal(flareSolverrRequest{
-		Cmd:        "request.get",
-		URL:        targetURL,
-		MaxTimeout: int(flareSolverrMaxTimeout / time.Millisecond),
-	})
+	Status   string               `json:"status"`
+	Message  string               `json:"message"`
+	Session  string               `json:"session"`
+	Solution flareSolverrSolution `json:"solution"`
+}
+
+// callFlareSolverr sends one command to a FlareSolverr v1 endpoint (e.g.
+// http://localhost:8191/v1) and returns its decoded, successful response.
+func callFlareSolverr(ctx context.Context, transport http.RoundTripper, solverURL string, request flareSolverrRequest, timeout time.Duration) (flareSolverrResponse, error) {
+	body, err := json.Marshal(request)
 	if err != nil {
-		return "", 0, fmt.Errorf("marshal flaresolverr request: %w", err)
+		return flareSolverrResponse{}, fmt.Errorf("marshal flaresolverr request: %w", err)
 	}
 
-	// Outer timeout is FlareSolverr's maxTimeout plus a 30s buffer for the
-	// browser-launch + JSON round trip on top of the in-browser page wait.
-	ctx, cancel := context.WithTimeout(context.Background(), flareSolverrMaxTimeout+30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, solverURL, bytes.NewReader(body))
 	if err != nil {
-		return "", 0, fmt.Errorf("build flaresolverr request: %w", err)
+		return flareSolverrResponse{}, fmt.Errorf("build flaresolverr request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	slog.Debug("Fetching via FlareSolverr", "url", targetURL, "solver", solverURL)
-
-	client := &http.Client{Timeout: flareSolverrMaxTimeout + 30*time.Second}
+	client := &http.Client{Transport: transport, Timeout: timeout}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", 0, fmt.Errorf("flaresolverr request: %w", err)
+		return flareSolverrResponse{}, fmt.Errorf("flaresolverr request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", 0, fmt.Errorf("read flaresolverr response: %w", err)
+		return flareSolverrResponse{}, fmt.Errorf("read flaresolverr response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", 0, fmt.Errorf("flaresolverr returned HTTP %d: %s", resp.StatusCode, truncateForError(string(raw)))
+		return flareSolverrResponse{}, fmt.Errorf("flaresolverr returned HTTP %d: %s", resp.StatusCode, truncateForError(string(raw)))
 	}
 
 	var parsed flareSolverrResponse
 	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return "", 0, fmt.Errorf("decode flaresolverr response: %w", err)
+		return flareSolverrResponse{}, fmt.Errorf("decode flaresolverr response: %w", err)
 	}
 	if parsed.Status != "ok" {
-		return "", 0, fmt.Errorf("flaresolverr failed: %s", parsed.Message)
+		return flareSolverrResponse{}, fmt.Errorf("flaresolverr failed: %s", parsed.Message)
+	}
+	return parsed, nil
+}
+
+// fetchViaFlareSolverr fetches targetURL through a FlareSolverr v1 endpoint,
+// inside session when it is non-empty, and returns the solution: the rendered
+// HTML body, the upstream HTTP status FlareSolverr observed when fetching the
+// target, and the cookies and user agent of the browser. A session keeps the
+// proxy it was created with, so proxy only applies to stateless requests.
+func fetchViaFlareSolverr(ctx context.Context, transport http.RoundTripper, solverURL, session, targetURL string, proxy *Proxy) (flareSolverrSolution, error) {
+	slog.Debug("Fetching via FlareSolverr", "url", targetURL, "solver", solverURL, "session", session)
+
+	var requestProxy *flareSolverrProxy
+	if session == "" {
+		requestProxy = newFlareSolverrProxy(proxy)
+	}
+
+	// Outer timeout is FlareSolverr's maxTimeout plus a 30s buffer for the
+	// browser-launch + JSON round trip on top of the in-browser page wait.
+	parsed, err := callFlareSolverr(ctx, transport, solverURL, flareSolverrRequest{
+		Cmd:        "request.get",
+		URL:        targetURL,
+		Session:    session,
+		MaxTimeout: int(flareSolverrMaxTimeout / time.Millisecond),
+		Proxy:      requestProxy,
+	}, flareSolverrMaxTimeout+30*time.Second)
+	if err != nil {
+		return flareSolverrSolution{}, err
 	}
 
 	slog.Debug("FlareSolverr returned",
 		"upstreamStatus", parsed.Solution.Status,
-		"bodyLength", len(parsed.Solution.Response))
-	return parsed.Solution.Response, parsed.Solution.Status, nil
+		"bodyLength", len(parsed.Solution.Response),
+		"cookies", len(parsed.Solution.Cookies))
+	return parsed.Solution, nil
+}
+
+// createFlareSolverrSession starts a browser instance that keeps its cookies
+// between requests, so a challenge is only solved once per run. The browser
+// goes out through proxy when it is non-nil.
+func createFlareSolverrSession(ctx context.Context, transport http.RoundTripper, solverURL string, proxy *Proxy) (string, error) {
+	parsed, err := callFlareSolverr(ctx, transport, solverURL, flareSolverrRequest{
+		Cmd:   "sessions.create",
+		Proxy: newFlareSolverrProxy(proxy),
+	}, flareSolverrSessionTimeout)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Session == "" {
+		return "", fmt.Errorf("flaresolverr returned no session id")
+	}
+	return parsed.Session, nil
+}
+
+func destroyFlareSolverrSession(ctx context.Context, transport http.RoundTripper, solverURL, session string) error {
+	_, err := callFlareSolverr(ctx, transport, solverURL, flareSolverrRequest{Cmd: "sessions.destroy", Session: session}, flareSolverrSessionTimeout)
+	return err
 }
 
 func truncateForError(s string) string {
@@ -95,3 +185,367 @@ func truncateForError(s string) string {
 	}
 	return s[:max] + "..."
 }
+
+// flareSolverrMaxFailures is how many consecutive failures take an endpoint
+// out of rotation while another one is still healthy.
+const flareSolverrMaxFailures = 3
+
+// FlareSolverrFetcher fetches through FlareSolverr v1 endpoints: real
+// headless Chromium with the right TLS fingerprint that solves JS challenges.
+// Fetches are spread round-robin over the endpoints and fail over to the next
+// one when an endpoint errors. Each endpoint keeps one session, created on
+// first use and destroyed by Close.
+type FlareSolverrFetcher struct {
+	URLs []string
+	// Clearance, when set, receives the cookies and user agent of every
+	// solve, with its egress, so other fetchers can reuse them.
+	Clearance *Clearance
+	// Proxies, when set, are the egresses of the browser. The session of an
+	// endpoint keeps its proxy until Cloudflare blocks it; the fetch then
+	// moves on to another proxy of the pool, replacing the session.
+	Proxies *ProxyPool
+	// Transport of the requests to FlareSolverr; nil is http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mu        sync.Mutex
+	endpoints []*flareSolverrEndpoint
+	next      int
+}
+
+type flareSolverrEndpoint struct {
+	url string
+	// session is the FlareSolverr session of the endpoint, going out through
+	// proxy (nil for none). Both are set when created is, on the first fetch
+	// through the endpoint; an empty session then means FlareSolverr could
+	// not create one and fetches go without.
+	session string
+	proxy   *Proxy
+	created bool
+	// failures counts consecutive failed fetches.
+	failures int
+}
+
+func (f *FlareSolverrFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	var errs []error
+	for _, endpoint := range f.rotation() {
+		body, err := f.fetchFrom(ctx, endpoint, url)
+		f.record(endpoint, err)
+		if err == nil {
+			return body, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", endpoint.url, err))
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Debug("FlareSolverr endpoint failed", "solver", endpoint.url, "error", err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no flaresolverr endpoint configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetchFrom fetches url through endpoint. With a proxy pool, a fetch that
+// Cloudflare blocks is tried again through every other proxy of the pool in
+// turn; any other error is left to the next endpoint.
+func (f *FlareSolverrFetcher) fetchFrom(ctx context.Context, endpoint *flareSolverrEndpoint, url string) ([]byte, error) {
+	if f.Proxies == nil {
+		return f.fetchVia(ctx, endpoint, url, nil)
+	}
+
+	var errs []error
+	tried := make(map[*Proxy]bool)
+	for range f.Proxies.Len() {
+		proxy := f.proxyFor(endpoint, tried)
+		tried[proxy] = true
+		body, err := f.fetchVia(ctx, endpoint, url, proxy)
+		if ctx.Err() == nil {
+			f.Proxies.Record(proxy, err)
+		}
+		if err == nil {
+			return body, nil
+		}
+		errs = append(errs, fmt.Errorf("via %s: %w", proxy, err))
+		var block *BlockError
+		if ctx.Err() != nil || !errors.As(err, &block) {
+			break
+		}
+		slog.Debug("FlareSolverr fetch blocked, rotating proxy", "solver", endpoint.url, "proxy", proxy, "error", err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// proxyFor returns the proxy of the endpoint's session when this fetch has
+// not tried it yet, and otherwise the next proxy of the pool it has not.
+func (f *FlareSolverrFetcher) proxyFor(endpoint *flareSolverrEndpoint, tried map[*Proxy]bool) *Proxy {
+	f.mu.Lock()
+	current := endpoint.proxy
+	f.mu.Unlock()
+	if current != nil && !tried[current] {
+		return current
+	}
+	for range f.Proxies.Len() {
+		if proxy := f.Proxies.Next(); !tried[proxy] {
+			return proxy
+		}
+	}
+	return f.Proxies.Next()
+}
+
+func (f *FlareSolverrFetcher) fetchVia(ctx context.Context, endpoint *flareSolverrEndpoint, url string, proxy *Proxy) ([]byte, error) {
+	session := f.ensureSession(ctx, endpoint, proxy)
+	record := FetchRecord{URL: url, Fetcher: string(FetchStrategyFlareSolverr), Via: endpoint.url, Started: time.Now()}
+	if proxy != nil {
+		record.Via += " via " + proxy.String()
+	}
+	solution, err := fetchViaFlareSolverr(ctx, f.Transport, endpoint.url, session, url, proxy)
+	if err != nil {
+		recordFetch(ctx, record, nil, err)
+		return nil, err
+	}
+	record.Status = solution.Status
+	if len(solution.Headers) > 0 {
+		record.Header = make(http.Header)
+		for name, value := range solution.Headers {
+			record.Header.Set(name, value)
+		}
+	}
+	body, err := checkFlareSolverrSolution(url, solution)
+	recordFetch(ctx, record, []byte(solution.Response), err)
+	var block *BlockError
+	if f.Clearance != nil && errors.As(err, &block) {
+		// Even the browser is blocked from this egress, so an earlier
+		// clearance of it no longer gets through either.
+		f.Clearance.discard(proxy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Clearance != nil {
+		f.Clearance.set(solution.UserAgent, solution.Cookies, proxy)
+	}
+	return body, nil
+}
+
+// checkFlareSolverrSolution returns the body of a solution, or an error when
+// the upstream answered with a block page or a failed status.
+func checkFlareSolverrSolution(url string, solution flareSolverrSolution) ([]byte, error) {
+	// A block page that still comes back through FlareSolverr fails loudly
+	// rather than being parsed as garbage downstream.
+	if block := classifyBlock(url, solution.Status, nil, []byte(solution.Response)); block != nil {
+		block.ViaFlareSolverr = true
+		return nil, block
+	}
+	if solution.Status < 200 || solution.Status >= 300 {
+		return nil, fmt.Errorf("upstream returned HTTP %d via flaresolverr", solution.Status)
+	}
+	return []byte(solution.Response), nil
+}
+
+// rotation returns the endpoints in the order to try them: round-robin from
+// the next one, with the endpoints that keep failing moved to the end.
+func (f *FlareSolverrFetcher) rotation() []*flareSolverrEndpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.endpoints == nil {
+		for _, url := range f.URLs {
+			f.endpoints = append(f.endpoints, &flareSolverrEndpoint{url: url})
+		}
+	}
+	if len(f.endpoints) == 0 {
+		return nil
+	}
+
+	var healthy, failing []*flareSolverrEndpoint
+	for i := range f.endpoints {
+		endpoint := f.endpoints[(f.next+i)%len(f.endpoints)]
+		if endpoint.failures >= flareSolverrMaxFailures {
+			failing = append(failing, endpoint)
+		} else {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	f.next = (f.next + 1) % len(f.endpoints)
+	return append(healthy, failing...)
+}
+
+func (f *FlareSolverrFetcher) record(endpoint *flareSolverrEndpoint, err error) {
+	// A block says nothing about the endpoint, only about its egress.
+	var block *BlockError
+	if errors.As(err, &block) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		endpoint.failures = 0
+		return
+	}
+	endpoint.failures++
+	if endpoint.failures == flareSolverrMaxFailures {
+		slog.Warn("FlareSolverr endpoint keeps failing, moving it out of rotation", "solver", endpoint.url, "error", err)
+	}
+}
+
+// ensureSession returns the session of an endpoint going out through proxy,
+// creating it on first use or when the endpoint's session goes out through
+// another proxy, which it then replaces. When FlareSolverr cannot create one,
+// fetches go without a session.
+func (f *FlareSolverrFetcher) ensureSession(ctx context.Context, endpoint *flareSolverrEndpoint, proxy *Proxy) string {
+	f.mu.Lock()
+	if endpoint.created && endpoint.proxy == proxy {
+		session := endpoint.session
+		f.mu.Unlock()
+		return session
+	}
+	f.mu.Unlock()
+
+	// The session is created without holding the lock, so an endpoint that
+	// is slow to answer does not hold up fetches through the others.
+	session, err := createFlareSolverrSession(ctx, f.Transport, endpoint.url, proxy)
+	if err != nil {
+		slog.Warn("Failed to create FlareSolverr session, fetching without one", "solver", endpoint.url, "proxy", proxy, "error", err)
+		session = ""
+	} else {
+		slog.Debug("Created FlareSolverr session", "solver", endpoint.url, "proxy", proxy, "session", session)
+	}
+
+	f.mu.Lock()
+	if endpoint.created && endpoint.proxy == proxy && endpoint.session != "" {
+		// Another fetch created one meanwhile; keep that one.
+		kept := endpoint.session
+		f.mu.Unlock()
+		f.destroySession(ctx, endpoint, session)
+		return kept
+	}
+	replaced := endpoint.session
+	endpoint.session, endpoint.proxy, endpoint.created = session, proxy, true
+	f.mu.Unlock()
+	f.destroySession(ctx, endpoint, replaced)
+	return session
+}
+
+// destroySession destroys a session of endpoint that is no longer used.
+func (f *FlareSolverrFetcher) destroySession(ctx context.Context, endpoint *flareSolverrEndpoint, session string) {
+	if session == "" {
+		return
+	}
+	slog.Debug("Destroying FlareSolverr session", "solver", endpoint.url, "session", session)
+	if err := destroyFlareSolverrSession(context.WithoutCancel(ctx), f.Transport, endpoint.url, session); err != nil {
+		slog.Warn("Failed to destroy FlareSolverr session", "solver", endpoint.url, "session", session, "error", err)
+	}
+}
+
+// Close destroys the FlareSolverr sessions. It does not take the run's
+// context, which may already be cancelled when the run ends.
+func (f *FlareSolverrFetcher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+	for _, endpoint := range f.endpoints {
+		session := endpoint.session
+		endpoint.session, endpoint.proxy, endpoint.created = "", nil, false
+		if session == "" {
+			continue
+		}
+		slog.Debug("Destroying FlareSolverr session", "solver", endpoint.url, "session", session)
+		if err := destroyFlareSolverrSession(context.Background(), f.Transport, endpoint.url, session); err != nil {
+			errs = append(errs, fmt.Errorf("destroy flaresolverr session on %s: %w", endpoint.url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flareSolverrHealthURL returns the health endpoint of a FlareSolverr v1
+// endpoint, e.g. http://localhost:8191/health for http://localhost:8191/v1.
+func flareSolverrHealthURL(solverURL string) (string, error) {
+	parsed, err := neturl.Parse(solverURL)
+	if err != nil {
+		return "", fmt.Errorf("parse flaresolverr url: %w", err)
+	}
+	parsed.Path = strings.TrimSuffix(strings.TrimSuffix(parsed.Path, "/"), "/v1") + "/health"
+	return parsed.String(), nil
+}
+
+// flareSolverrReadyGrace is how long the other endpoints are given to come
+// up once one of them is ready.
+const flareSolverrReadyGrace = 10 * time.Second
+
+// WaitForFlareSolverr probes the health of every endpoint until one is ready
+// or timeout has passed, and returns the endpoints that became ready. Once
+// one is, the others get flareSolverrReadyGrace more, so one crashed sidecar
+// does not hold up the run for the whole timeout. It fails only when none
+// became ready. A nil transport is http.DefaultTransport.
+func WaitForFlareSolverr(ctx context.Context, transport http.RoundTripper, solverURLs []string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type probe struct {
+		index int
+		ready bool
+	}
+	probes := make(chan probe, len(solverURLs))
+	for i, solverURL := range solverURLs {
+		go func() {
+			probes <- probe{index: i, ready: waitForFlareSolverrEndpoint(ctx, transport, solverURL)}
+		}()
+	}
+
+	ready := make([]bool, len(solverURLs))
+	var grace <-chan time.Time
+	for pending := len(solverURLs); pending > 0; {
+		select {
+		case p := <-probes:
+			pending--
+			ready[p.index] = p.ready
+			if p.ready && grace == nil && pending > 0 {
+				grace = time.After(flareSolverrReadyGrace)
+			}
+		case <-grace:
+			// The probes still running stop, and report not ready.
+			cancel()
+		}
+	}
+
+	var result []string
+	for i, solverURL := range solverURLs {
+		if ready[i] {
+			result = append(result, solverURL)
+		} else {
+			slog.Warn("FlareSolverr endpoint is not ready, skipping it", "solver", solverURL)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no flaresolverr endpoint became ready within %s", timeout)
+	}
+	return result, nil
+}
+
+func waitForFlareSolverrEndpoint(ctx context.Context, transport http.RoundTripper, solverURL string) bool {
+	healthURL, err := flareSolverrHealthURL(solverURL)
+	if err != nil {
+		slog.Warn("Invalid FlareSolverr endpoint", "solver", solverURL, "error", err)
+		return false
+	}
+
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				slog.Debug("FlareSolverr endpoint is ready", "solver", solverURL)
+				return true
+			}
+		}
+		if sleepContext(ctx, 2*time.Second) != nil {
+			return false
+		}
+	}
+}
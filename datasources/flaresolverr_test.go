@@ -0,0 +1,129 @@
+package datasources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFlareSolverr is a FlareSolverr v1 endpoint that answers every
+// request.get with page, or fails every command when broken, and records the
+// commands it receives.
+type fakeFlareSolverr struct {
+	page   string
+	broken bool
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func (s *fakeFlareSolverr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	}
+	var request flareSolverrRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.commands = append(s.commands, request.Cmd)
+	s.mu.Unlock()
+	if s.broken {
+		http.Error(w, `{"status":"error","message":"Chrome crashed"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := flareSolverrResponse{Status: "ok"}
+	switch request.Cmd {
+	case "sessions.create":
+		response.Session = "session-1"
+	case "request.get":
+		response.Solution = flareSolverrSolution{
+			URL:       request.URL,
+			Status:    http.StatusOK,
+			Response:  s.page,
+			UserAgent: "Mozilla/5.0 (solver)",
+			Cookies:   []flareSolverrCookie{{Name: cfClearanceCookie, Value: "solved", Domain: "ethernodes.org"}},
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *fakeFlareSolverr) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.commands)
+}
+
+func TestFlareSolverrFetcherFailover(t *testing.T) {
+	broken := &fakeFlareSolverr{broken: true}
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+	solver := &fakeFlareSolverr{page: "<html><h4>Execution Layer Clients</h4></html>"}
+	server := httptest.NewServer(solver)
+	defer server.Close()
+
+	clearance := new(Clearance)
+	fetcher := &FlareSolverrFetcher{URLs: []string{brokenServer.URL + "/v1", server.URL + "/v1"}, Clearance: clearance}
+	defer fetcher.Close()
+
+	body, err := fetcher.Fetch(context.Background(), "https://ethernodes.org/")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if string(body) != solver.page {
+		t.Errorf("Fetch() = %q, want the page of the working endpoint", body)
+	}
+	if !slices.Equal(broken.received(), []string{"sessions.create", "request.get"}) {
+		t.Errorf("failing endpoint received %v, want a session and a fetch attempt", broken.received())
+	}
+	if got := solver.received(); !slices.Equal(got, []string{"sessions.create", "request.get"}) {
+		t.Errorf("working endpoint received %v, want a session and the fetch", got)
+	}
+	if _, ok := clearance.UserAgent(nil); !ok {
+		t.Error("the clearance of the solve is not kept")
+	}
+
+	// With both failing, the error names every endpoint.
+	server.Close()
+	_, err = fetcher.Fetch(context.Background(), "https://ethernodes.org/")
+	if err == nil {
+		t.Fatal("Fetch() with every endpoint down succeeded")
+	}
+	for _, url := range fetcher.URLs {
+		if !strings.Contains(err.Error(), url) {
+			t.Errorf("Fetch() error = %v, want it to name %s", err, url)
+		}
+	}
+}
+
+func TestWaitForFlareSolverr(t *testing.T) {
+	ready := httptest.NewServer(new(fakeFlareSolverr))
+	defer ready.Close()
+	starting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	}))
+	defer starting.Close()
+
+	got, err := WaitForFlareSolverr(context.Background(), nil, []string{ready.URL + "/v1"}, time.Second)
+	if err != nil || !slices.Equal(got, []string{ready.URL + "/v1"}) {
+		t.Errorf("WaitForFlareSolverr() = %v, %v, want the ready endpoint", got, err)
+	}
+
+	start := time.Now()
+	got, err = WaitForFlareSolverr(context.Background(), nil, []string{starting.URL + "/v1"}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no flaresolverr endpoint became ready within 100ms") {
+		t.Errorf("WaitForFlareSolverr() = %v, %v, want it to give up", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitForFlareSolverr() gave up after %s, want it to stop at its deadline", elapsed)
+	}
+}
@@ -0,0 +1,172 @@
+package datasources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchStrategyJSON is the fetch path of a JSONFetcher in diagnostics.
+const fetchStrategyJSON = "json"
+
+// JSONFetcher requests JSON documents with net/http, retrying failed requests
+// with exponential backoff. Unlike the page fetchers it does not pass for a
+// browser: the APIs it reads are meant to be called by programs.
+type JSONFetcher struct {
+	// Client defaults to an http.Client with a 30s timeout.
+	Client *http.Client
+	// Header is sent with every request, e.g. an API key.
+	Header            http.Header
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+}
+
+// Fetch GETs the document at url.
+func (f *JSONFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	return f.do(ctx, http.MethodGet, url, nil)
+}
+
+// Post POSTs body, a JSON document, to url.
+func (f *JSONFetcher) Post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	return f.do(ctx, http.MethodPost, url, body)
+}
+
+// do sends the request until it gets a 2xx answer, a 4xx other than 429, or
+// runs out of retries.
+func (f *JSONFetcher) do(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	var err error
+	for retries := 0; ; retries++ {
+		var response []byte
+		var retry bool
+		response, retry, err = f.request(ctx, method, url, body)
+		if err == nil {
+			return response, nil
+		}
+		if !retry || retries >= f.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		delay := time.Duration(int64(f.InitialRetryDelay) * (1 << uint(retries)))
+		slog.Debug("JSON request failed, retrying", "url", redactedURL(url), "error", err, "retries", retries, "delay", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// request sends the request once, and says whether a failure is worth
+// retrying.
+func (f *JSONFetcher) request(ctx context.Context, method, url string, body []byte) ([]byte, bool, error) {
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range f.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	record := FetchRecord{URL: redactedURL(url), Fetcher: fetchStrategyJSON, Started: time.Now()}
+	slog.Debug("Requesting JSON", "method", method, "url", redactedURL(url))
+	resp, err := client.Do(req)
+	if err != nil {
+		recordFetch(ctx, record, nil, err)
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	record.Status = resp.StatusCode
+	record.Header = resp.Header
+
+	response, err := io.ReadAll(resp.Body)
+	if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		err = fmt.Errorf("%s answered %s", redactedURL(url), resp.Status)
+	}
+	recordFetch(ctx, record, response, err)
+	if err != nil {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, err
+	}
+	return response, false, nil
+}
+
+// redactedURL is how a URL is logged: without the password it may carry,
+// e.g. that of a node behind basic auth.
+func redactedURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[invalid url]"
+	}
+	return u.Redacted()
+}
+
+// lookupJSON returns the value at a dotted path of a decoded JSON document,
+// e.g. "data.clients" or "result.0.name"; an empty path is the document.
+func lookupJSON(document any, path string) (any, bool) {
+	value := document
+	if path == "" {
+		return value, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonNumber reads a JSON number, or a string holding one, multiplied by
+// scale and rounded to a count.
+func jsonNumber(value any, scale float64) (int64, error) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return 0, err
+		}
+		number = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", v)
+		}
+		number = parsed
+	default:
+		return 0, fmt.Errorf("not a number: %v", value)
+	}
+	if number < 0 || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid count %v", number)
+	}
+	return int64(math.Round(number * scale)), nil
+}
@@ -0,0 +1,183 @@
+package datasources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"client-nodes-reporter/configs"
+)
+
+// ErrLayoutChanged is wrapped by the errors of pages whose structure no
+// longer matches the one of the last good run.
+var ErrLayoutChanged = errors.New("upstream layout changed")
+
+// PageFingerprint is the structure of a page the extraction rules rely on.
+type PageFingerprint struct {
+	// Rule is the name of the page rule the page was read with.
+	Rule string `json:"rule"`
+	// Headings counts the headings holding each text the sections of the
+	// rule look for.
+	Headings map[string]int `json:"headings"`
+	// Selectors counts the elements matching each row selector of the rule.
+	Selectors map[string]int `json:"selectors"`
+	// Clients are the labels of the rows standing for a known client. They
+	// are data rather than structure: a client leaving a list is only
+	// warned about.
+	Clients []string `json:"clients"`
+}
+
+// changesFrom lists the structure previous had that f lost: headings and
+// selectors, such as the progress groups, that no longer match anything.
+// Counts that merely moved, such as one more version row, are not changes.
+func (f PageFingerprint) changesFrom(previous PageFingerprint) []string {
+	var changes []string
+	for _, heading := range slices.Sorted(maps.Keys(previous.Headings)) {
+		if count, ok := f.Headings[heading]; ok && count == 0 && previous.Headings[heading] > 0 {
+			changes = append(changes, fmt.Sprintf("heading %q: %d → 0", heading, previous.Headings[heading]))
+		}
+	}
+	for _, selector := range slices.Sorted(maps.Keys(previous.Selectors)) {
+		if count, ok := f.Selectors[selector]; ok && count == 0 && previous.Selectors[selector] > 0 {
+			changes = append(changes, fmt.Sprintf("selector %q: %d → 0", selector, previous.Selectors[selector]))
+		}
+	}
+	return changes
+}
+
+// missingClients lists the client labels previous showed that f does not.
+func (f PageFingerprint) missingClients(previous PageFingerprint) []string {
+	var missing []string
+	for _, label := range previous.Clients {
+		if !slices.Contains(f.Clients, label) {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
+
+// LayoutChangedError is the error of a page that lost structure the last
+// good run had.
+type LayoutChangedError struct {
+	URL     string
+	Changes []string
+}
+
+func (e *LayoutChangedError) Error() string {
+	return fmt.Sprintf("%s on %s since the last good run:\n  %s", ErrLayoutChanged, e.URL, strings.Join(e.Changes, "\n  "))
+}
+
+func (e *LayoutChangedError) Unwrap() error {
+	return ErrLayoutChanged
+}
+
+// LayoutFingerprints compares the fingerprint of each page parsed with the
+// one of the same page in the last good run, kept as JSON in Path.
+type LayoutFingerprints struct {
+	Path string
+	// Accept records the fingerprints of the run without comparing them, to
+	// take a layout change once the extraction rules have been checked.
+	Accept bool
+
+	mu   sync.Mutex
+	last map[string]PageFingerprint
+	seen map[string]PageFingerprint
+}
+
+// LoadLayoutFingerprints reads the fingerprints of the last good run from
+// path; a missing file is a first run, which compares nothing.
+func LoadLayoutFingerprints(path string) (*LayoutFingerprints, error) {
+	l := &LayoutFingerprints{Path: path, last: make(map[string]PageFingerprint), seen: make(map[string]PageFingerprint)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout fingerprints: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.last); err != nil {
+		return nil, fmt.Errorf("failed to parse layout fingerprints: %w", err)
+	}
+	return l, nil
+}
+
+func layoutFrom(ctx context.Context) *LayoutFingerprints {
+	layout, _ := ctx.Value(configs.ContextKeyLayout).(*LayoutFingerprints)
+	return layout
+}
+
+// check compares fingerprint with the last good one of key, and keeps it for
+// Save unless the layout changed. Client labels no longer shown are logged
+// as a warning. A page read with another rule than last time is not
+// compared: the rules were changed to follow the site.
+func (l *LayoutFingerprints) check(key, url string, fingerprint PageFingerprint) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if previous, ok := l.last[key]; ok && !l.Accept && previous.Rule == fingerprint.Rule {
+		if changes := fingerprint.changesFrom(previous); len(changes) > 0 {
+			return &LayoutChangedError{URL: url, Changes: changes}
+		}
+		if missing := fingerprint.missingClients(previous); len(missing) > 0 {
+			slog.Warn("Client labels of the last good run are missing", "url", url, "labels", missing)
+		}
+	}
+	l.seen[key] = fingerprint
+	return nil
+}
+
+// Save records the fingerprints of the pages parsed in this run as the last
+// good ones, keeping those of the pages it did not parse.
+func (l *LayoutFingerprints) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fingerprints := maps.Clone(l.last)
+	maps.Copy(fingerprints, l.seen)
+	data, err := json.MarshalIndent(fingerprints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode layout fingerprints: %w", err)
+	}
+	if dir := filepath.Dir(l.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to write layout fingerprints: %w", err)
+		}
+	}
+	// Written aside and renamed, so a crash never leaves a torn file.
+	tmp := l.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write layout fingerprints: %w", err)
+	}
+	if err := os.Rename(tmp, l.Path); err != nil {
+		return fmt.Errorf("failed to write layout fingerprints: %w", err)
+	}
+	slog.Debug("Saved layout fingerprints", "path", l.Path, "pages", len(l.seen))
+	return nil
+}
+
+// checkLayout compares the structure of the page of source at url, a page of
+// kind, with the last good run, when ctx compares layouts.
+func checkLayout(ctx context.Context, rules *ExtractionRules, source DataSourceType, kind PageKind, url string, doc *goquery.Document, layer configs.Layer) error {
+	layout := layoutFrom(ctx)
+	if layout == nil {
+		return nil
+	}
+	fingerprint, err := rules.Fingerprint(source, kind, doc, layer)
+	if err != nil {
+		return err
+	}
+	// Mirrors serve the same pages, so the host is left out.
+	key := fmt.Sprintf("%s %s %s", source, pagePath(url), string(layer))
+	return layout.check(key, url, fingerprint)
+}
@@ -0,0 +1,45 @@
+package datasources
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayoutFingerprintsCheck(t *testing.T) {
+	previous := PageFingerprint{
+		Rule:      "main",
+		Headings:  map[string]int{"Execution Layer Clients": 1},
+		Selectors: map[string]int{".progress-group": 14},
+		Clients:   []string{"geth", "nethermind"},
+	}
+	tests := []struct {
+		name        string
+		fingerprint PageFingerprint
+		wantChanged bool
+	}{
+		{"same", previous, false},
+		{"counts moved", PageFingerprint{Rule: "main", Headings: map[string]int{"Execution Layer Clients": 2}, Selectors: map[string]int{".progress-group": 9}, Clients: previous.Clients}, false},
+		{"client label missing", PageFingerprint{Rule: "main", Headings: previous.Headings, Selectors: previous.Selectors, Clients: []string{"geth"}}, false},
+		{"heading lost", PageFingerprint{Rule: "main", Headings: map[string]int{"Execution Layer Clients": 0}, Selectors: previous.Selectors, Clients: previous.Clients}, true},
+		{"selector lost", PageFingerprint{Rule: "main", Headings: previous.Headings, Selectors: map[string]int{".progress-group": 0}}, true},
+		{"other rule", PageFingerprint{Rule: "main-v2", Selectors: map[string]int{".progress-group": 0}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := LoadLayoutFingerprints(filepath.Join(t.TempDir(), "fingerprints.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			layout.last["ethernodes / execution"] = previous
+
+			err = layout.check("ethernodes / execution", "https://ethernodes.org/", tt.fingerprint)
+			if changed := errors.Is(err, ErrLayoutChanged); changed != tt.wantChanged {
+				t.Errorf("check() error = %v, want layout changed %v", err, tt.wantChanged)
+			}
+			if _, saved := layout.seen["ethernodes / execution"]; saved == tt.wantChanged {
+				t.Errorf("check() kept the fingerprint = %v, want %v", saved, !tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package datasources
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"client-nodes-reporter/configs"
+)
+
+// PeerClient is the client a peer announces, e.g. in the client identifier
+// of an execution node or the agent string of a beacon node.
+type PeerClient struct {
+	// Name is the client as announced, e.g. "Geth"; OtherClientsLabel when
+	// the peer announced nothing.
+	Name string
+	// ClientName is ClientTypeUnknown for long-tail clients.
+	ClientName configs.ClientType
+	// Version is "major.minor.patch", empty when none was announced.
+	Version string
+}
+
+// peerClientAliases are the names some clients announce instead of their
+// own, e.g. older Lodestar releases announce their networking library.
+var peerClientAliases = map[string]configs.ClientType{
+	"js-libp2p": configs.ClientTypeLodestar,
+}
+
+// ParsePeerClient reads the client of a layer and its version out of an
+// identifier such as "Geth/v1.13.5-stable-916d6a44/linux-amd64/go1.21.4",
+// "Nethermind/v1.25.4+20b10b35/linux-x64/dotnet8.0.0" or
+// "Lighthouse/v4.5.0-441fc16/x86_64-linux". The client is the first part;
+// the version is the first release number after it, so node names some
+// operators add, as in "Geth/my-node/v1.13.5-stable", are skipped.
+func ParsePeerClient(id string, layer configs.Layer) PeerClient {
+	parts := strings.Split(strings.TrimSpace(id), "/")
+	name := strings.TrimSpace(parts[0])
+	if name == "" {
+		return PeerClient{Name: OtherClientsLabel, ClientName: configs.ClientTypeUnknown}
+	}
+
+	// The version after an alias is the one of what it names, not of the
+	// client.
+	if client, ok := peerClientAliases[strings.ToLower(name)]; ok && client.Layer() == layer {
+		return PeerClient{Name: name, ClientName: client}
+	}
+
+	peer := PeerClient{Name: name, ClientName: configs.ClientTypeUnknown}
+	for _, client := range configs.ClientTypesOf(layer) {
+		// Some clients add to their name, e.g. "nimbus-eth2".
+		if strings.HasPrefix(strings.ToLower(name), string(client)) {
+			peer.ClientName = client
+			break
+		}
+	}
+	for _, part := range parts[1:] {
+		if version, ok := NormalizeVersion(part); ok {
+			peer.Version = version
+			break
+		}
+	}
+	return peer
+}
+
+// peerClientRows counts peers by client into distribution rows, largest
+// first. Known clients are keyed by type and the others by their lowercased
+// name. Peers announce no sync status, so no row has a synced count.
+func peerClientRows(peers []PeerClient) []ClientCount {
+	var rows []ClientCount
+	indexes := make(map[string]int)
+	versions := make(map[string]map[string]int64)
+	for _, peer := range peers {
+		key := strings.ToLower(peer.Name)
+		if peer.ClientName != configs.ClientTypeUnknown {
+			key = string(peer.ClientName)
+		}
+		i, ok := indexes[key]
+		if !ok {
+			name := peer.Name
+			if peer.ClientName != configs.ClientTypeUnknown {
+				name = peer.ClientName.String()
+			}
+			i = len(rows)
+			indexes[key] = i
+			versions[key] = make(map[string]int64)
+			rows = append(rows, ClientCount{Name: name, ClientName: peer.ClientName, Synced: -1})
+		}
+		rows[i].Total++
+		if peer.Version != "" {
+			versions[key][peer.Version]++
+		}
+	}
+	for key, i := range indexes {
+		rows[i].Versions = mergeVersionCounts(versions[key], nil)
+	}
+	slices.SortStableFunc(rows, func(a, b ClientCount) int { return cmp.Compare(b.Total, a.Total) })
+	return rows
+}
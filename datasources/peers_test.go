@@ -0,0 +1,66 @@
+package datasources
+
+import (
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+func TestParsePeerClient(t *testing.T) {
+	tests := []struct {
+		id    string
+		layer configs.Layer
+		want  PeerClient
+	}{
+		{"Geth/v1.13.5-stable-916d6a44/linux-amd64/go1.21.4", configs.LayerExecution, PeerClient{Name: "Geth", ClientName: configs.ClientTypeGeth, Version: "1.13.5"}},
+		{"Geth/my-node/v1.13.5-stable/linux-amd64/go1.21.4", configs.LayerExecution, PeerClient{Name: "Geth", ClientName: configs.ClientTypeGeth, Version: "1.13.5"}},
+		{"Nethermind/v1.25.4+20b10b35/linux-x64/dotnet8.0.0", configs.LayerExecution, PeerClient{Name: "Nethermind", ClientName: configs.ClientTypeNethermind, Version: "1.25.4"}},
+		{"reth/v1.0.0-rc.2-a1b2c3d/x86_64-unknown-linux-gnu", configs.LayerExecution, PeerClient{Name: "reth", ClientName: configs.ClientTypeReth, Version: "1.0.0-rc.2"}},
+		{"  besu/v24.1.0/linux-x86_64/openjdk-java-21 ", configs.LayerExecution, PeerClient{Name: "besu", ClientName: configs.ClientTypeBesu, Version: "24.1.0"}},
+		{"erigon", configs.LayerExecution, PeerClient{Name: "erigon", ClientName: configs.ClientTypeErigon}},
+		{"ethereumjs/v0.3.0/linux/node20", configs.LayerExecution, PeerClient{Name: "ethereumjs", ClientName: configs.ClientTypeUnknown, Version: "0.3.0"}},
+		{"Lighthouse/v4.5.0-441fc16/x86_64-linux", configs.LayerConsensus, PeerClient{Name: "Lighthouse", ClientName: configs.ClientTypeLighthouse, Version: "4.5.0"}},
+		{"nimbus-eth2/v24.1.2-a1b2c3-stateofus", configs.LayerConsensus, PeerClient{Name: "nimbus-eth2", ClientName: configs.ClientTypeNimbus, Version: "24.1.2"}},
+		{"js-libp2p/0.46.21/UserAgentNotSet", configs.LayerConsensus, PeerClient{Name: "js-libp2p", ClientName: configs.ClientTypeLodestar}},
+		{"js-libp2p/0.46.21", configs.LayerExecution, PeerClient{Name: "js-libp2p", ClientName: configs.ClientTypeUnknown, Version: "0.46.21"}},
+		{"Geth/v1.13.5-stable", configs.LayerConsensus, PeerClient{Name: "Geth", ClientName: configs.ClientTypeUnknown, Version: "1.13.5"}},
+		{"", configs.LayerExecution, PeerClient{Name: OtherClientsLabel, ClientName: configs.ClientTypeUnknown}},
+		{"/v1.0.0", configs.LayerExecution, PeerClient{Name: OtherClientsLabel, ClientName: configs.ClientTypeUnknown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := ParsePeerClient(tt.id, tt.layer); got != tt.want {
+				t.Errorf("ParsePeerClient(%q, %s) = %+v, want %+v", tt.id, tt.layer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerClientRows(t *testing.T) {
+	peers := []PeerClient{
+		{Name: "Nethermind", ClientName: configs.ClientTypeNethermind, Version: "1.25.4"},
+		{Name: "Geth", ClientName: configs.ClientTypeGeth, Version: "1.13.5"},
+		{Name: "geth", ClientName: configs.ClientTypeGeth, Version: "1.14.0"},
+		{Name: "EthereumJS", ClientName: configs.ClientTypeUnknown},
+		{Name: "ethereumjs", ClientName: configs.ClientTypeUnknown},
+		{Name: "Geth", ClientName: configs.ClientTypeGeth},
+	}
+	rows := peerClientRows(peers)
+	want := []struct {
+		name     string
+		total    int64
+		versions int
+	}{
+		{"Geth", 3, 2},
+		{"EthereumJS", 2, 0},
+		{"Nethermind", 1, 1},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("peerClientRows() = %+v, want %d rows", rows, len(want))
+	}
+	for i, w := range want {
+		if rows[i].Name != w.name || rows[i].Total != w.total || len(rows[i].Versions) != w.versions || rows[i].Synced != -1 {
+			t.Errorf("row %d = %+v, want %s with %d peers, %d versions and no synced count", i, rows[i], w.name, w.total, w.versions)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package datasources
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProxyPool(t *testing.T, now *time.Time, proxies ...string) *ProxyPool {
+	t.Helper()
+	pool, err := NewProxyPool(proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.now = func() time.Time { return *now }
+	return pool
+}
+
+// nextHosts returns the hosts of the next n proxies of pool.
+func nextHosts(pool *ProxyPool, n int) []string {
+	hosts := make([]string, 0, n)
+	for range n {
+		hosts = append(hosts, pool.Next().URL.Host)
+	}
+	return hosts
+}
+
+func TestNewProxyPoolErrors(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		want    string
+	}{
+		{nil, "proxy pool is empty"},
+		{[]string{"ftp://a:21"}, `unsupported proxy scheme "ftp"`},
+		{[]string{"http://"}, "has no host"},
+	}
+	for _, tt := range tests {
+		if _, err := NewProxyPool(tt.proxies); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewProxyPool(%v) error = %v, want it to contain %q", tt.proxies, err, tt.want)
+		}
+	}
+}
+
+func TestProxyPoolRotation(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := newTestProxyPool(t, &now, "http://a:1", "socks5://b:2", "http://c:3")
+	block := &BlockError{Kind: BlockKindFirewall, Status: http.StatusForbidden}
+	proxy := func(host string) *Proxy {
+		for _, proxy := range pool.proxies {
+			if proxy.URL.Host == host {
+				return proxy
+			}
+		}
+		t.Fatalf("no proxy %s", host)
+		return nil
+	}
+
+	if got, want := nextHosts(pool, 4), []string{"a:1", "b:2", "c:3", "a:1"}; !slices.Equal(got, want) {
+		t.Errorf("Next() = %v, want round-robin %v", got, want)
+	}
+
+	// A failure or a single block keeps the proxy in rotation.
+	pool.Record(proxy("b:2"), errors.New("connection refused"))
+	pool.Record(proxy("b:2"), block)
+	if got, want := nextHosts(pool, 3), []string{"b:2", "c:3", "a:1"}; !slices.Equal(got, want) {
+		t.Errorf("Next() after one block = %v, want %v", got, want)
+	}
+
+	pool.Record(proxy("b:2"), block)
+	if got, want := nextHosts(pool, 3), []string{"c:3", "a:1", "c:3"}; !slices.Equal(got, want) {
+		t.Errorf("Next() after two blocks = %v, want b skipped: %v", got, want)
+	}
+
+	now = now.Add(proxyBlockCooldown - time.Second)
+	if got := nextHosts(pool, 2); slices.Contains(got, "b:2") {
+		t.Errorf("Next() before the cooldown ends = %v, want b skipped", got)
+	}
+	now = now.Add(time.Second)
+	if got := nextHosts(pool, 3); !slices.Contains(got, "b:2") {
+		t.Errorf("Next() after the cooldown = %v, want b back in rotation", got)
+	}
+
+	// Blocked again right after the cooldown, it is taken out at once; a
+	// success puts it back to needing two blocks in a row.
+	pool.Record(proxy("b:2"), block)
+	if got := nextHosts(pool, 3); slices.Contains(got, "b:2") {
+		t.Errorf("Next() after a block following the cooldown = %v, want b skipped", got)
+	}
+	now = now.Add(proxyBlockCooldown)
+	pool.Record(proxy("b:2"), nil)
+	pool.Record(proxy("b:2"), block)
+	if got := nextHosts(pool, 3); !slices.Contains(got, "b:2") {
+		t.Errorf("Next() after a success and one block = %v, want b in rotation", got)
+	}
+
+	stats := pool.Stats()
+	if stats[1].Successes != 1 || stats[1].Blocks != 4 || stats[1].Failures != 1 || stats[1].Attempts() != 6 {
+		t.Errorf("Stats() of b = %+v, want 1 success, 4 blocks and 1 failure", stats[1])
+	}
+}
+
+func TestProxyPoolAllBlocked(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool := newTestProxyPool(t, &now, "http://a:1", "http://b:2")
+	block := &BlockError{Kind: BlockKindFirewall, Status: http.StatusForbidden}
+	a, b := pool.proxies[0], pool.proxies[1]
+	for range 3 {
+		pool.Record(a, block)
+	}
+	pool.Record(b, nil)
+	pool.Record(b, block)
+	pool.Record(b, block)
+
+	// Both are skipped, so the one with the lowest block rate is used.
+	if got := nextHosts(pool, 2); !slices.Equal(got, []string{"b:2", "b:2"}) {
+		t.Errorf("Next() with every proxy blocked = %v, want b, the lowest block rate", got)
+	}
+}
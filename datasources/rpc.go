@@ -0,0 +1,207 @@
+package datasources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"client-nodes-reporter/configs"
+)
+
+const RPCSourceName = "JSON-RPC peers"
+
+// RPCDataSourceOptions configure a data source reading the peers of our own
+// execution nodes.
+type RPCDataSourceOptions struct {
+	// URLs are the JSON-RPC endpoints of the nodes, which must serve the
+	// admin and net namespaces and run on Network.
+	URLs              []string
+	Network           configs.Network
+	MaxRetries        int
+	InitialRetryDelay time.Duration
+	// Transport of the requests; nil is http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// RPCDataSource counts the clients of the peers of our own execution nodes,
+// from admin_peers, so it depends on no third-party site. It is our nodes'
+// view of the network rather than a crawl of it: a node only sees the peers
+// it is connected to.
+type RPCDataSource struct {
+	config  RPCDataSourceOptions
+	fetcher *JSONFetcher
+}
+
+func NewRPCDataSource(cfg *RPCDataSourceOptions) (*RPCDataSource, error) {
+	if cfg == nil || len(cfg.URLs) == 0 {
+		return nil, fmt.Errorf("at least one node url is required")
+	}
+	config := *cfg
+	if config.Network == "" {
+		config.Network = configs.NetworkMainnet
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 3
+	}
+	if config.InitialRetryDelay < 0 {
+		config.InitialRetryDelay = 1 * time.Second
+	}
+
+	return &RPCDataSource{
+		config: config,
+		fetcher: &JSONFetcher{
+			Client:            &http.Client{Transport: config.Transport, Timeout: 30 * time.Second},
+			MaxRetries:        config.MaxRetries,
+			InitialRetryDelay: config.InitialRetryDelay,
+		},
+	}, nil
+}
+
+func (r RPCDataSource) SourceType() DataSourceType {
+	return DataSourceTypeRPC
+}
+
+func (r RPCDataSource) SourceName() string {
+	return RPCSourceName
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call calls method on the node at url and decodes its result into result.
+func (r RPCDataSource) call(ctx context.Context, url, method string, result any) error {
+	request, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: []any{}})
+	if err != nil {
+		return fmt.Errorf("encode %s request: %w", method, err)
+	}
+	body, err := r.fetcher.Post(ctx, url, request)
+	if err != nil {
+		return fmt.Errorf("%s on %s: %w", method, redactedURL(url), err)
+	}
+
+	var response rpcResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("%s on %s: parse response: %w", method, redactedURL(url), err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s on %s: %s (%d)", method, redactedURL(url), response.Error.Message, response.Error.Code)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s on %s: parse result: %w", method, redactedURL(url), err)
+	}
+	return nil
+}
+
+// rpcPeer is the part of an admin_peers entry the source reads.
+type rpcPeer struct {
+	ID    string `json:"id"`
+	Enode string `json:"enode"`
+	// Name is the client identifier the peer announced.
+	Name string `json:"name"`
+}
+
+// GetDistribution counts the peers of every node by client. A peer of
+// several of our nodes is counted once.
+func (r RPCDataSource) GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error) {
+	if layer != configs.LayerExecution {
+		return Distribution{}, fmt.Errorf("execution nodes do not see %s clients", layer)
+	}
+
+	seen := make(map[string]bool)
+	var peers []PeerClient
+	nodes := make([]string, 0, len(r.config.URLs))
+	for _, url := range r.config.URLs {
+		nodes = append(nodes, redactedURL(url))
+		var peerCount string
+		if err := r.call(ctx, url, "net_peerCount", &peerCount); err != nil {
+			return Distribution{}, err
+		}
+		count, err := strconv.ParseInt(strings.TrimPrefix(peerCount, "0x"), 16, 64)
+		if err != nil {
+			return Distribution{}, fmt.Errorf("net_peerCount on %s: invalid count %q", redactedURL(url), peerCount)
+		}
+
+		var nodePeers []rpcPeer
+		if err := r.call(ctx, url, "admin_peers", &nodePeers); err != nil {
+			return Distribution{}, fmt.Errorf("%w; is the admin namespace enabled?", err)
+		}
+		// Peers come and go between the two calls, so the counts only roughly
+		// agree.
+		slog.Info("Read node peers", "node", redactedURL(url), "peerCount", count, "peers", len(nodePeers))
+
+		for _, peer := range nodePeers {
+			id := peer.ID
+			if id == "" {
+				id = peer.Enode
+			}
+			if id != "" && seen[id] {
+				continue
+			}
+			seen[id] = true
+			peers = append(peers, ParsePeerClient(peer.Name, layer))
+		}
+	}
+
+	rows := peerClientRows(peers)
+	recordMatches(ctx, strings.Join(nodes, " "), "admin_peers", nil, map[string]any{"total": len(peers), "clients": clientRowLabels(rows)})
+	if len(peers) == 0 {
+		return Distribution{}, fmt.Errorf("none of the %d nodes has any peer", len(r.config.URLs))
+	}
+
+	return Distribution{
+		Source:      string(r.SourceType()),
+		Network:     r.config.Network,
+		Layer:       layer,
+		Total:       int64(len(peers)),
+		TotalSynced: -1,
+		Clients:     rows,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (r RPCDataSource) GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error) {
+	distribution, err := r.GetDistribution(ctx, clientName.Layer())
+	if err != nil {
+		return ClientData{}, err
+	}
+
+	// A client none of our nodes is connected to counts as zero peers.
+	client, _ := distribution.Client(clientName)
+
+	slog.Info("Successfully retrieved peer data",
+		"client", clientName,
+		"clientTotal", client.Total,
+		"overallTotal", distribution.Total,
+		"versions", len(client.Versions))
+
+	return ClientData{
+		Source:      distribution.Source,
+		Network:     distribution.Network,
+		Layer:       distribution.Layer,
+		ClientName:  clientName,
+		Total:       distribution.Total,
+		ClientTotal: client.Total,
+		TotalSynced: distribution.TotalSynced,
+		// Peers announce no sync status.
+		ClientSynced: -1,
+		Versions:     client.Versions,
+		CreatedAt:    distribution.CreatedAt,
+	}, nil
+}
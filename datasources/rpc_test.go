@@ -0,0 +1,121 @@
+package datasources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+// newRPCNode serves net_peerCount and admin_peers with peers, as "id name"
+// pairs, or the JSON-RPC error of a node without the admin namespace.
+func newRPCNode(t *testing.T, adminEnabled bool, peers ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request rpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var response map[string]any
+		switch {
+		case request.Method == "net_peerCount":
+			response = map[string]any{"result": fmt.Sprintf("0x%x", len(peers))}
+		case request.Method == "admin_peers" && adminEnabled:
+			result := make([]map[string]string, 0, len(peers))
+			for _, peer := range peers {
+				id, name, _ := strings.Cut(peer, " ")
+				result = append(result, map[string]string{"id": id, "name": name})
+			}
+			response = map[string]any{"result": result}
+		default:
+			response = map[string]any{"error": map[string]any{"code": -32601, "message": "the method " + request.Method + " does not exist/is not available"}}
+		}
+		response["jsonrpc"], response["id"] = "2.0", request.ID
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRPCDataSource(t *testing.T) {
+	first := newRPCNode(t, true,
+		"a Geth/v1.13.5-stable-916d6a44/linux-amd64/go1.21.4",
+		"b Nethermind/v1.25.4+20b10b35/linux-x64/dotnet8.0.0",
+		"c Geth/v1.14.0-stable/linux-amd64/go1.22.0",
+	)
+	second := newRPCNode(t, true,
+		// Also a peer of the first node, so counted once.
+		"a Geth/v1.13.5-stable-916d6a44/linux-amd64/go1.21.4",
+		"d ethereumjs/v0.3.0",
+	)
+	source, err := NewRPCDataSource(&RPCDataSourceOptions{URLs: []string{first.URL, second.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := source.GetClientData(context.Background(), configs.ClientTypeGeth)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	if data.Total != 4 || data.ClientTotal != 2 || data.TotalSynced != -1 || data.ClientSynced != -1 {
+		t.Errorf("GetClientData() = %+v, want 2 of 4 peers and unknown synced counts", data)
+	}
+	if len(data.Versions) != 2 || data.Versions[0].Version != "1.14.0" {
+		t.Errorf("GetClientData() versions = %+v, want 1.14.0 and 1.13.5", data.Versions)
+	}
+
+	// A client none of the nodes sees is no peer, not an error.
+	data, err = source.GetClientData(context.Background(), configs.ClientTypeReth)
+	if err != nil {
+		t.Fatalf("GetClientData() error = %v", err)
+	}
+	if data.ClientTotal != 0 || data.ClientSynced != -1 {
+		t.Errorf("GetClientData() = %+v, want no peer and an unknown synced count", data)
+	}
+
+	distribution, err := source.GetDistribution(context.Background(), configs.LayerExecution)
+	if err != nil {
+		t.Fatalf("GetDistribution() error = %v", err)
+	}
+	for _, data := range distribution.ClientData() {
+		if data.ClientSynced != -1 {
+			t.Errorf("ClientData() row %s synced = %d, want -1", data.ClientName, data.ClientSynced)
+		}
+	}
+
+	if _, err := source.GetDistribution(context.Background(), configs.LayerConsensus); err == nil {
+		t.Error("GetDistribution() of the consensus layer error = nil, want one")
+	}
+}
+
+func TestRPCDataSourceErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		node *httptest.Server
+		want string
+	}{
+		{"admin namespace disabled", newRPCNode(t, false, "a Geth/v1.13.5"), "is the admin namespace enabled?"},
+		{"no peers", newRPCNode(t, true), "has any peer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewRPCDataSource(&RPCDataSourceOptions{URLs: []string{tt.node.URL}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := source.GetDistribution(context.Background(), configs.LayerExecution); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GetDistribution() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewRPCDataSource(&RPCDataSourceOptions{}); err == nil {
+		t.Error("NewRPCDataSource() without urls error = nil, want one")
+	}
+}
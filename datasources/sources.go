@@ -1,6 +1,8 @@
 package datasources
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"client-nodes-reporter/configs"
@@ -11,24 +13,178 @@ type DataSourceType string
 const (
 	DataSourceTypeEthernets DataSourceType = "ethernets"
 	DataSourceTypeEthernodes DataSourceType = "ethernodes"
+	// DataSourceTypeFile parses ethernodes or ethernets pages saved to disk.
+	DataSourceTypeFile DataSourceType = "file"
+	// DataSourceTypeAggregate reconciles the distributions of several sources.
+	DataSourceTypeAggregate DataSourceType = "aggregate"
+	// DataSourceTypeAPI reads a JSON client-diversity API.
+	DataSourceTypeAPI DataSourceType = "api"
+	// DataSourceTypeRPC reads the peers of our execution nodes over JSON-RPC.
+	DataSourceTypeRPC DataSourceType = "rpc"
+	// DataSourceTypeBeacon reads the peers of our beacon nodes.
+	DataSourceTypeBeacon DataSourceType = "beacon"
 )
 
+// OtherClientsLabel names the bucket holding nodes a source counts in its
+// total but does not attribute to any of the client rows it lists.
+const OtherClientsLabel = "Other"
+
 type ClientData struct {
 	Source       string
+	Network      configs.Network
+	Layer        configs.Layer
 	ClientName   configs.ClientType
 	Total        int64
 	ClientTotal  int64
 	TotalSynced  int64
 	ClientSynced int64
-	CreatedAt    time.Time
+	// Versions is the per-release breakdown of the client's nodes, newest
+	// first. Empty when the source does not publish one.
+	Versions  []VersionCount
+	CreatedAt time.Time
 }
 
 func (c ClientData) Compare(other ClientData) int {
 	return c.CreatedAt.Compare(other.CreatedAt)
 }
 
+// ClientCount is one client row of a Distribution. Name is the label as the
+// source publishes it; ClientName is ClientTypeUnknown for long-tail clients
+// that have no configs.ClientType.
+type ClientCount struct {
+	Name       string
+	ClientName configs.ClientType
+	Total      int64
+	// Synced is -1 when the source does not publish a synced count for the row.
+	Synced   int64
+	Versions []VersionCount
+}
+
+// Distribution is the full client breakdown of a source at one point in time.
+type Distribution struct {
+	Source      string
+	Network     configs.Network
+	Layer       configs.Layer
+	Total       int64
+	TotalSynced int64
+	Clients     []ClientCount
+	CreatedAt   time.Time
+}
+
+// Client returns the counts of one known client. Rows that map to the same
+// client type (e.g. "geth" and "go-ethereum") are summed.
+func (d Distribution) Client(clientName configs.ClientType) (ClientCount, bool) {
+	result := ClientCount{Name: clientName.String(), ClientName: clientName}
+	found := false
+	for _, c := range d.Clients {
+		if c.ClientName != clientName {
+			continue
+		}
+		if result.Versions == nil {
+			result.Versions = c.Versions
+		}
+		if !found {
+			found = true
+			result.Synced = c.Synced
+		} else if result.Synced < 0 || c.Synced < 0 {
+			result.Synced = -1
+		} else {
+			result.Synced += c.Synced
+		}
+		result.Total += c.Total
+	}
+	return result, found
+}
+
+// ClientData flattens the distribution into one ClientData per row so every
+// client, including the long tail and the "Other" bucket, can be recorded.
+// Known clients are merged as in Client; unknown rows are keyed by their
+// lowercased label. Rows without a published synced count record -1.
+func (d Distribution) ClientData() []ClientData {
+	result := make([]ClientData, 0, len(d.Clients))
+	seen := make(map[configs.ClientType]bool)
+	for _, c := range d.Clients {
+		clientName := c.ClientName
+		if clientName == configs.ClientTypeUnknown {
+			clientName = configs.ClientType(strings.ToLower(c.Name))
+		} else if seen[clientName] {
+			continue
+		} else {
+			c, _ = d.Client(clientName)
+		}
+		seen[clientName] = true
+
+		result = append(result, ClientData{
+			Source:       d.Source,
+			Network:      d.Network,
+			Layer:        d.Layer,
+			ClientName:   clientName,
+			Total:        d.Total,
+			ClientTotal:  c.Total,
+			TotalSynced:  d.TotalSynced,
+			ClientSynced: c.Synced,
+			Versions:     c.Versions,
+			CreatedAt:    d.CreatedAt,
+		})
+	}
+	return result
+}
+
+// addOtherBucket folds whatever part of total the listed rows do not account
+// for into the "Other" row, creating it if the source did not list one.
+func addOtherBucket(clients []ClientCount, total, totalSynced int64) []ClientCount {
+	var listed, listedSynced int64
+	syncedKnown := totalSynced >= 0
+	otherIndex := -1
+	for i, c := range clients {
+		if strings.EqualFold(c.Name, OtherClientsLabel) {
+			otherIndex = i
+		}
+		listed += c.Total
+		if c.Synced < 0 {
+			syncedKnown = false
+		} else {
+			listedSynced += c.Synced
+		}
+	}
+
+	remainder := total - listed
+	if remainder <= 0 {
+		return clients
+	}
+	remainderSynced := int64(-1)
+	if syncedKnown && totalSynced-listedSynced >= 0 {
+		remainderSynced = totalSynced - listedSynced
+	}
+
+	if otherIndex < 0 {
+		return append(clients, ClientCount{
+			Name:       OtherClientsLabel,
+			ClientName: configs.ClientTypeUnknown,
+			Total:      remainder,
+			Synced:     remainderSynced,
+		})
+	}
+	clients[otherIndex].Total += remainder
+	if clients[otherIndex].Synced >= 0 && remainderSynced >= 0 {
+		clients[otherIndex].Synced += remainderSynced
+	} else {
+		clients[otherIndex].Synced = -1
+	}
+	return clients
+}
+
+// VersionSource is implemented by data sources that publish per-version node
+// counts for each client.
+type VersionSource interface {
+	GetVersionDistribution(ctx context.Context, layer configs.Layer, clients []configs.ClientType) (Distribution, error)
+}
+
 type DataSource interface {
 	SourceName() string
 	SourceType() DataSourceType
-	GetClientData(clientName configs.ClientType) (ClientData, error)
+	GetClientData(ctx context.Context, clientName configs.ClientType) (ClientData, error)
+	// GetDistribution returns every client row the source lists for a layer
+	// in one pass.
+	GetDistribution(ctx context.Context, layer configs.Layer) (Distribution, error)
 }
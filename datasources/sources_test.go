@@ -0,0 +1,150 @@
+package datasources
+
+import (
+	"reflect"
+	"testing"
+
+	"client-nodes-reporter/configs"
+)
+
+func TestAddOtherBucket(t *testing.T) {
+	geth := ClientCount{Name: "Geth", ClientName: configs.ClientTypeGeth, Total: 60, Synced: 50}
+	nethermind := ClientCount{Name: "Nethermind", ClientName: configs.ClientTypeNethermind, Total: 20, Synced: 15}
+	other := func(total, synced int64) ClientCount {
+		return ClientCount{Name: OtherClientsLabel, ClientName: configs.ClientTypeUnknown, Total: total, Synced: synced}
+	}
+	tests := []struct {
+		name        string
+		clients     []ClientCount
+		total       int64
+		totalSynced int64
+		want        []ClientCount
+	}{
+		{
+			name:        "remainder added as other",
+			clients:     []ClientCount{geth, nethermind},
+			total:       100,
+			totalSynced: 80,
+			want:        []ClientCount{geth, nethermind, other(20, 15)},
+		},
+		{
+			name:        "listed other takes the remainder",
+			clients:     []ClientCount{geth, {Name: "other", ClientName: configs.ClientTypeUnknown, Total: 5, Synced: 4}},
+			total:       100,
+			totalSynced: 80,
+			want:        []ClientCount{geth, {Name: "other", ClientName: configs.ClientTypeUnknown, Total: 40, Synced: 30}},
+		},
+		{
+			name:        "rows reach the total",
+			clients:     []ClientCount{geth, nethermind},
+			total:       80,
+			totalSynced: 65,
+			want:        []ClientCount{geth, nethermind},
+		},
+		{
+			name:        "unknown synced count of a row",
+			clients:     []ClientCount{geth, {Name: "reth", ClientName: configs.ClientTypeReth, Total: 20, Synced: -1}},
+			total:       100,
+			totalSynced: 80,
+			want:        []ClientCount{geth, {Name: "reth", ClientName: configs.ClientTypeReth, Total: 20, Synced: -1}, other(20, -1)},
+		},
+		{
+			name:        "unknown total synced",
+			clients:     []ClientCount{geth},
+			total:       100,
+			totalSynced: -1,
+			want:        []ClientCount{geth, other(40, -1)},
+		},
+		{
+			name:        "total synced below the listed synced counts",
+			clients:     []ClientCount{geth, nethermind},
+			total:       100,
+			totalSynced: 60,
+			want:        []ClientCount{geth, nethermind, other(20, -1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := append([]ClientCount(nil), tt.clients...)
+			if got := addOtherBucket(clients, tt.total, tt.totalSynced); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addOtherBucket() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributionClient(t *testing.T) {
+	versions := []VersionCount{{Version: "1.14.0", Total: 30, Synced: 20}}
+	tests := []struct {
+		name    string
+		clients []ClientCount
+		want    ClientCount
+		wantOK  bool
+	}{
+		{
+			name: "duplicate rows summed",
+			clients: []ClientCount{
+				{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 60, Synced: 50, Versions: versions},
+				{Name: "go-ethereum", ClientName: configs.ClientTypeGeth, Total: 15, Synced: 5},
+			},
+			want:   ClientCount{Name: "Geth", ClientName: configs.ClientTypeGeth, Total: 75, Synced: 55, Versions: versions},
+			wantOK: true,
+		},
+		{
+			name: "unknown synced count of a duplicate row",
+			clients: []ClientCount{
+				{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 60, Synced: 50},
+				{Name: "go-ethereum", ClientName: configs.ClientTypeGeth, Total: 15, Synced: -1},
+			},
+			want:   ClientCount{Name: "Geth", ClientName: configs.ClientTypeGeth, Total: 75, Synced: -1},
+			wantOK: true,
+		},
+		{
+			name:    "not listed",
+			clients: []ClientCount{{Name: "nethermind", ClientName: configs.ClientTypeNethermind, Total: 20, Synced: 15}},
+			want:    ClientCount{Name: "Geth", ClientName: configs.ClientTypeGeth},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Distribution{Clients: tt.clients}.Client(configs.ClientTypeGeth)
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("Client() = %+v, %t; want %+v, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDistributionClientData(t *testing.T) {
+	distribution := Distribution{
+		Source:      "ethernodes",
+		Network:     configs.NetworkMainnet,
+		Layer:       configs.LayerExecution,
+		Total:       100,
+		TotalSynced: 80,
+		Clients: addOtherBucket([]ClientCount{
+			{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 50, Synced: 45},
+			{Name: "EthereumJS", ClientName: configs.ClientTypeUnknown, Total: 5, Synced: -1},
+			{Name: "go-ethereum", ClientName: configs.ClientTypeGeth, Total: 10, Synced: 5},
+		}, 100, 80),
+	}
+	type row struct {
+		client        configs.ClientType
+		total, synced int64
+	}
+	var got []row
+	for _, data := range distribution.ClientData() {
+		if data.Total != 100 || data.TotalSynced != 80 || data.Layer != configs.LayerExecution {
+			t.Errorf("ClientData() row %s = %+v, want the totals of the distribution", data.ClientName, data)
+		}
+		got = append(got, row{data.ClientName, data.ClientTotal, data.ClientSynced})
+	}
+	want := []row{
+		{configs.ClientTypeGeth, 60, 50},
+		{"ethereumjs", 5, -1},
+		{"other", 35, -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ClientData() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package datasources
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// changeWindow is how recent the rows a change is judged from must be: after
+// a longer gap, any change may be real.
+const changeWindow = 7 * 24 * time.Hour
+
+// ValidationOptions tune ValidateClientData.
+type ValidationOptions struct {
+	// MaxDailyChange is the largest relative change of a count from its
+	// median over the week before still taken as real, e.g. 0.5 for 50%; 0
+	// skips the comparison with history.
+	MaxDailyChange float64
+	// MinChangeBase is the smallest median count a change is judged from,
+	// so counts that swing by nature, such as long-tail clients or small
+	// testnets, are not flagged.
+	MinChangeBase int64
+}
+
+// ValidationError is the error of a row that failed validation.
+type ValidationError struct {
+	ClientData ClientData
+	Problems   []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("implausible %s data for %s: %s", e.ClientData.Source, string(e.ClientData.ClientName), strings.Join(e.Problems, "; "))
+}
+
+// ValidateClientData checks the invariants of a scraped row (client ≤ total,
+// synced ≤ total, synced ≤ client) and, against history, the client's latest
+// stored rows, that no count moved implausibly from its median over the
+// week before. A median rather than the last row keeps one bad day from
+// flagging the next. Counts left at -1 were not fetched and are not
+// checked. It returns nil for a sane row.
+func ValidateClientData(data ClientData, history []ClientData, options ValidationOptions) *ValidationError {
+	var problems []string
+	if data.Total <= 0 {
+		problems = append(problems, fmt.Sprintf("total is %d", data.Total))
+	}
+	if data.ClientTotal < 0 {
+		problems = append(problems, fmt.Sprintf("client total is %d", data.ClientTotal))
+	}
+	if data.ClientTotal > data.Total {
+		problems = append(problems, fmt.Sprintf("client total %d exceeds total %d", data.ClientTotal, data.Total))
+	}
+	if data.TotalSynced > data.Total {
+		problems = append(problems, fmt.Sprintf("synced total %d exceeds total %d", data.TotalSynced, data.Total))
+	}
+	if data.ClientSynced > data.ClientTotal {
+		problems = append(problems, fmt.Sprintf("client synced %d exceeds client total %d", data.ClientSynced, data.ClientTotal))
+	}
+	if data.TotalSynced >= 0 && data.ClientSynced > data.TotalSynced {
+		problems = append(problems, fmt.Sprintf("client synced %d exceeds synced total %d", data.ClientSynced, data.TotalSynced))
+	}
+
+	var window []ClientData
+	for _, row := range history {
+		if age := data.CreatedAt.Sub(row.CreatedAt); age >= 0 && age <= changeWindow {
+			window = append(window, row)
+		}
+	}
+	if len(window) > 0 && options.MaxDailyChange > 0 {
+		counts := []struct {
+			name    string
+			current int64
+			count   func(ClientData) int64
+		}{
+			{"total", data.Total, func(row ClientData) int64 { return row.Total }},
+			{"client total", data.ClientTotal, func(row ClientData) int64 { return row.ClientTotal }},
+			{"synced total", data.TotalSynced, func(row ClientData) int64 { return row.TotalSynced }},
+			{"client synced", data.ClientSynced, func(row ClientData) int64 { return row.ClientSynced }},
+		}
+		for _, count := range counts {
+			if count.current < 0 {
+				continue
+			}
+			before, ok := medianCount(window, count.count)
+			if !ok || before < options.MinChangeBase || before <= 0 {
+				continue
+			}
+			change := float64(count.current-before) / float64(before)
+			if math.Abs(change) > options.MaxDailyChange {
+				problems = append(problems, fmt.Sprintf("%s moved %+.0f%% from its 7-day median (%d → %d)", count.name, change*100, before, count.current))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{ClientData: data, Problems: problems}
+}
+
+// medianCount returns the median of count over rows, leaving out the rows
+// where it is -1; ok is false when none is left.
+func medianCount(rows []ClientData, count func(ClientData) int64) (median int64, ok bool) {
+	var values []int64
+	for _, row := range rows {
+		if value := count(row); value >= 0 {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	slices.Sort(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2, true
+	}
+	return values[middle], true
+}
+
+// quarantinedRow is one line of a quarantine file.
+type quarantinedRow struct {
+	QuarantinedAt time.Time  `json:"quarantinedAt"`
+	Problems      []string   `json:"problems"`
+	ClientData    ClientData `json:"clientData"`
+}
+
+// Quarantine appends the row of a validation error to the JSON lines file at
+// path, to be reviewed and written by hand if it turns out to be real.
+func Quarantine(path string, invalid *ValidationError) error {
+	line, err := json.Marshal(quarantinedRow{QuarantinedAt: time.Now().UTC(), Problems: invalid.Problems, ClientData: invalid.ClientData})
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantined data: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open quarantine: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write quarantine: %w", err)
+	}
+	return nil
+}
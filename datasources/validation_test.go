@@ -0,0 +1,126 @@
+package datasources
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateClientData(t *testing.T) {
+	now := time.Date(2026, 10, 16, 6, 0, 0, 0, time.UTC)
+	row := func(daysAgo int, total, clientTotal, totalSynced, clientSynced int64) ClientData {
+		return ClientData{
+			ClientName:   "nethermind",
+			CreatedAt:    now.AddDate(0, 0, -daysAgo),
+			Total:        total,
+			ClientTotal:  clientTotal,
+			TotalSynced:  totalSynced,
+			ClientSynced: clientSynced,
+		}
+	}
+	options := ValidationOptions{MaxDailyChange: 0.5, MinChangeBase: 100}
+	// A week of steady counts with one bad day, two days ago.
+	week := []ClientData{
+		row(1, 7000, 2000, 5000, 1500),
+		row(2, 7000, 200, 5000, 150),
+		row(3, 7100, 2050, 5100, 1550),
+		row(4, 6900, 1950, 4900, 1450),
+	}
+
+	tests := []struct {
+		name     string
+		data     ClientData
+		history  []ClientData
+		options  ValidationOptions
+		problems []string
+	}{
+		{
+			name: "sane",
+			data: row(0, 7000, 2000, 5000, 1500), history: week, options: options,
+		},
+		{
+			name: "unknown synced counts",
+			data: row(0, 7000, 2000, -1, -1), history: week, options: options,
+		},
+		{
+			name: "no total",
+			data: row(0, 0, 0, -1, -1), options: options,
+			problems: []string{"total is 0"},
+		},
+		{
+			name: "invariants",
+			data: row(0, 7000, 8000, 7500, 9000), options: options,
+			problems: []string{
+				"client total 8000 exceeds total 7000",
+				"synced total 7500 exceeds total 7000",
+				"client synced 9000 exceeds client total 8000",
+				"client synced 9000 exceeds synced total 7500",
+			},
+		},
+		{
+			name: "change from the median",
+			data: row(0, 7000, 300, 5000, -1), history: week, options: options,
+			problems: []string{"client total moved -85% from its 7-day median (1975 → 300)"},
+		},
+		{
+			name: "change within bounds of the median despite a bad day",
+			data: row(0, 7000, 1900, 5000, 1400), history: week, options: options,
+		},
+		{
+			name: "check off",
+			data: row(0, 7000, 300, 5000, -1), history: week, options: ValidationOptions{MinChangeBase: 100},
+		},
+		{
+			name: "history older than a week",
+			data: row(0, 7000, 300, 5000, -1), history: []ClientData{row(8, 7000, 2000, 5000, 1500)}, options: options,
+		},
+		{
+			name: "median under the base",
+			data: row(0, 7000, 300, 5000, 10), history: []ClientData{row(1, 7000, 90, 5000, 80)}, options: options,
+		},
+		{
+			name: "unknown synced counts in history",
+			data: row(0, 7000, 2000, 5000, 1500), history: []ClientData{row(1, 7000, 2000, -1, -1)}, options: options,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateClientData(tt.data, tt.history, tt.options)
+			var problems []string
+			if err != nil {
+				problems = err.Problems
+			}
+			if !slices.Equal(problems, tt.problems) {
+				t.Errorf("ValidateClientData() problems = %q, want %q", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestMedianCount(t *testing.T) {
+	total := func(row ClientData) int64 { return row.Total }
+	tests := []struct {
+		name   string
+		totals []int64
+		want   int64
+		wantOK bool
+	}{
+		{"none", nil, 0, false},
+		{"only unknown", []int64{-1, -1}, 0, false},
+		{"odd", []int64{30, 10, 20}, 20, true},
+		{"even", []int64{10, 40, 20, 30}, 25, true},
+		{"unknown left out", []int64{10, -1, 30}, 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make([]ClientData, len(tt.totals))
+			for i, value := range tt.totals {
+				rows[i].Total = value
+			}
+			got, ok := medianCount(rows, total)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("medianCount() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package datasources
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VersionCount is the number of nodes of one client running one release.
+type VersionCount struct {
+	Version string `json:"version"`
+	Total   int64  `json:"total"`
+	Synced  int64  `json:"synced"`
+}
+
+var versionPattern = regexp.MustCompile(`(\d+\.\d+\.\d+)(?:-([0-9A-Za-z.]+))?`)
+
+// prereleaseTags start the suffixes marking a version as a prerelease, e.g.
+// "-rc1", "-beta.2" or Geth's "-unstable". Other suffixes, such as
+// "-stable" or a commit hash, are dropped.
+var prereleaseTags = []string{"alpha", "beta", "rc", "unstable", "dev", "pre", "nightly", "snapshot"}
+
+// NormalizeVersion extracts the "major.minor.patch" part of a version label
+// such as "v1.25.4", "1.25.4-stable" or "Nethermind/v1.25.4+a1b2c3". A
+// prerelease keeps its tag, e.g. "1.26.0-rc1" from "v1.26.0-rc1-a1b2c3".
+func NormalizeVersion(label string) (string, bool) {
+	match := versionPattern.FindStringSubmatch(label)
+	if match == nil {
+		return "", false
+	}
+	version, tag := match[1], strings.ToLower(match[2])
+	for _, prerelease := range prereleaseTags {
+		if strings.HasPrefix(tag, prerelease) {
+			return version + "-" + tag, true
+		}
+	}
+	return version, true
+}
+
+// IsPrerelease reports whether a normalised version is a prerelease.
+func IsPrerelease(version string) bool {
+	return strings.Contains(version, "-")
+}
+
+// CompareVersions compares two normalised versions, returning -1, 0 or 1.
+// Their numbers are compared numerically, and a prerelease comes before the
+// release of the same number.
+func CompareVersions(a, b string) int {
+	a, aTag, _ := strings.Cut(a, "-")
+	b, bTag, _ := strings.Cut(b, "-")
+	if c := compareVersionParts(a, b); c != 0 {
+		return c
+	}
+	switch {
+	case aTag == bTag:
+		return 0
+	case aTag == "":
+		return 1
+	case bTag == "":
+		return -1
+	}
+	return compareVersionParts(aTag, bTag)
+}
+
+// compareVersionParts compares two dot-separated versions part by part:
+// numerically when both parts are numbers, as text otherwise.
+func compareVersionParts(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var ap, bp string
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		an, aErr := strconv.ParseInt(ap, 10, 64)
+		bn, bErr := strconv.ParseInt(bp, 10, 64)
+		if ap == "" {
+			an, aErr = 0, nil
+		}
+		if bp == "" {
+			bn, bErr = 0, nil
+		}
+		var c int
+		if aErr == nil && bErr == nil {
+			c = cmp.Compare(an, bn)
+		} else {
+			c = strings.Compare(ap, bp)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// LatestVersion returns the highest release in versions. Prereleases are
+// left out: nodes running one are not on the latest release.
+func LatestVersion(versions []VersionCount) (VersionCount, bool) {
+	var latest VersionCount
+	var found bool
+	for _, v := range versions {
+		if IsPrerelease(v.Version) {
+			continue
+		}
+		if !found || CompareVersions(v.Version, latest.Version) > 0 {
+			latest = v
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// mergeVersionCounts combines the per-version counts of a client's full and
+// synced pages, newest release first.
+func mergeVersionCounts(totals, synced map[string]int64) []VersionCount {
+	versions := make([]VersionCount, 0, len(totals))
+	for version, total := range totals {
+		versions = append(versions, VersionCount{
+			Version: version,
+			Total:   total,
+			Synced:  min(synced[version], total),
+		})
+	}
+	slices.SortFunc(versions, func(a, b VersionCount) int {
+		return CompareVersions(b.Version, a.Version)
+	})
+	return versions
+}
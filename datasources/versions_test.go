@@ -0,0 +1,98 @@
+package datasources
+
+import "testing"
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		label  string
+		want   string
+		wantOK bool
+	}{
+		{"v1.25.4", "1.25.4", true},
+		{"1.25.4-stable", "1.25.4", true},
+		{"v1.13.5-stable-916d6a44", "1.13.5", true},
+		{"Nethermind/v1.25.4+a1b2c3", "1.25.4", true},
+		{"v1.26.0-rc1-a1b2c3", "1.26.0-rc1", true},
+		{"1.0.0-rc.2-a1b2c3d", "1.0.0-rc.2", true},
+		{"v1.14.0-unstable", "1.14.0-unstable", true},
+		{"v4.6.0-Beta.1", "4.6.0-beta.1", true},
+		{"v24.1.2-a1b2c3", "24.1.2", true},
+		{"v1.25", "", false},
+		{"unknown", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeVersion(tt.label)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeVersion(%q) = %q, %t; want %q, %t", tt.label, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	for version, want := range map[string]bool{"1.26.0-rc1": true, "1.14.0-unstable": true, "1.26.0": false} {
+		if got := IsPrerelease(version); got != want {
+			t.Errorf("IsPrerelease(%q) = %t, want %t", version, got, want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.25.4", "1.25.4", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.9.9", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.26.0-rc1", "1.26.0", -1},
+		{"1.26.0", "1.26.0-rc1", 1},
+		{"1.26.0-rc1", "1.25.9", 1},
+		{"1.26.0-rc.2", "1.26.0-rc.10", -1},
+		{"1.26.0-beta.1", "1.26.0-rc.1", -1},
+		{"1.26.0-rc1", "1.26.0-rc1", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []VersionCount
+		want     string
+		wantOK   bool
+	}{
+		{"numeric order", []VersionCount{{Version: "1.9.0"}, {Version: "1.10.0"}, {Version: "1.2.3"}}, "1.10.0", true},
+		{"prerelease left out", []VersionCount{{Version: "1.25.4"}, {Version: "1.26.0-rc1"}}, "1.25.4", true},
+		{"only prereleases", []VersionCount{{Version: "1.26.0-rc1"}}, "", false},
+		{"none", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := LatestVersion(tt.versions)
+			if got.Version != tt.want || ok != tt.wantOK {
+				t.Errorf("LatestVersion() = %q, %t; want %q, %t", got.Version, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMergeVersionCounts(t *testing.T) {
+	versions := mergeVersionCounts(
+		map[string]int64{"1.9.0": 10, "1.10.0": 20, "1.10.0-rc1": 5},
+		map[string]int64{"1.9.0": 8, "1.10.0": 25},
+	)
+	want := []VersionCount{{"1.10.0", 20, 20}, {"1.10.0-rc1", 5, 0}, {"1.9.0", 10, 8}}
+	if len(versions) != len(want) {
+		t.Fatalf("mergeVersionCounts() = %+v, want %+v", versions, want)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Errorf("mergeVersionCounts()[%d] = %+v, want %+v", i, versions[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package forks
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/datasources"
+)
+
+// Config describes an upcoming hard fork and the first release of each client
+// that supports it. It is read from a YAML file such as:
+//
+//	name: Pectra
+//	date: 2025-05-07T10:05:11Z
+//	clients:
+//	  nethermind: 1.31.9
+//	  geth: 1.15.6
+//	  lighthouse: 7.0.0
+type Config struct {
+	Name            string                        `yaml:"name"`
+	Date            time.Time                     `yaml:"date"`
+	MinimumVersions map[configs.ClientType]string `yaml:"clients"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read fork config: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(raw, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse fork config: %w", err)
+	}
+
+	if config.Name == "" {
+		return Config{}, fmt.Errorf("fork config has no name")
+	}
+	if len(config.MinimumVersions) == 0 {
+		return Config{}, fmt.Errorf("fork config has no client versions")
+	}
+	minimumVersions := make(map[configs.ClientType]string, len(config.MinimumVersions))
+	for name, version := range config.MinimumVersions {
+		clientName := configs.ClientTypeFromString(string(name))
+		if clientName == configs.ClientTypeUnknown {
+			return Config{}, fmt.Errorf("fork config has unknown client: %s", string(name))
+		}
+		normalized, ok := datasources.NormalizeVersion(version)
+		if !ok {
+			return Config{}, fmt.Errorf("fork config has invalid %s version: %s", string(name), version)
+		}
+		minimumVersions[clientName] = normalized
+	}
+	config.MinimumVersions = minimumVersions
+
+	return config, nil
+}
+
+// Clients returns the clients of one layer that have a minimum version, in
+// the order of configs.ClientTypes.
+func (c Config) Clients(layer configs.Layer) []configs.ClientType {
+	var result []configs.ClientType
+	for _, clientName := range configs.ClientTypesOf(layer) {
+		if _, ok := c.MinimumVersions[clientName]; ok {
+			result = append(result, clientName)
+		}
+	}
+	return result
+}
+
+// Layers returns the layers that have at least one client in the config.
+func (c Config) Layers() []configs.Layer {
+	var result []configs.Layer
+	for _, layer := range []configs.Layer{configs.LayerExecution, configs.LayerConsensus} {
+		if len(c.Clients(layer)) > 0 {
+			result = append(result, layer)
+		}
+	}
+	return result
+}
+
+type ClientReadiness struct {
+	ClientName     configs.ClientType
+	MinimumVersion string
+	// Total is every node of the client; nodes whose version the source does
+	// not list count as not ready.
+	Total int64
+	Ready int64
+}
+
+func (c ClientReadiness) Percentage() float64 {
+	return percentage(c.Ready, c.Total)
+}
+
+// LayerReadiness is the readiness of one layer. Total is the whole network of
+// the layer, so clients without a minimum version count as not ready.
+type LayerReadiness struct {
+	Layer   configs.Layer
+	Total   int64
+	Ready   int64
+	Clients []ClientReadiness
+}
+
+func (l LayerReadiness) Percentage() float64 {
+	return percentage(l.Ready, l.Total)
+}
+
+type Readiness struct {
+	Fork      string
+	Date      time.Time
+	Source    string
+	Network   configs.Network
+	Layers    []LayerReadiness
+	CreatedAt time.Time
+}
+
+// Compute works out how many nodes of each client run at least the fork's
+// minimum version, from per-layer distributions with per-version totals. A
+// prerelease of the minimum version is not ready, nor is a version that
+// cannot be parsed.
+func Compute(config Config, distributions []datasources.Distribution) Readiness {
+	readiness := Readiness{
+		Fork: config.Name,
+		Date: config.Date,
+	}
+
+	for _, distribution := range distributions {
+		readiness.Source = distribution.Source
+		readiness.Network = distribution.Network
+		readiness.CreatedAt = distribution.CreatedAt
+
+		layer := LayerReadiness{
+			Layer: distribution.Layer,
+			Total: distribution.Total,
+		}
+		for _, clientName := range config.Clients(distribution.Layer) {
+			minimum := config.MinimumVersions[clientName]
+			client := ClientReadiness{
+				ClientName:     clientName,
+				MinimumVersion: minimum,
+			}
+			if counts, ok := distribution.Client(clientName); ok {
+				client.Total = counts.Total
+				for _, version := range counts.Versions {
+					// A version that cannot be parsed is not known to be ready.
+					normalized, ok := datasources.NormalizeVersion(version.Version)
+					if ok && datasources.CompareVersions(normalized, minimum) >= 0 {
+						client.Ready += version.Total
+					}
+				}
+				client.Ready = min(client.Ready, client.Total)
+			}
+			layer.Ready += client.Ready
+			layer.Clients = append(layer.Clients, client)
+		}
+		slices.SortFunc(layer.Clients, func(a, b ClientReadiness) int {
+			return cmp.Compare(b.Total, a.Total)
+		})
+		readiness.Layers = append(readiness.Layers, layer)
+	}
+
+	return readiness
+}
+
+func percentage(part, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
@@ -0,0 +1,150 @@
+package forks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"client-nodes-reporter/configs"
+	"client-nodes-reporter/datasources"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    map[configs.ClientType]string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: "name: Pectra\ndate: 2025-05-07T10:05:11Z\nclients:\n  Nethermind: v1.31.9\n  geth: 1.15.6-stable\n  lighthouse: 7.0.0-beta.5\n",
+			want: map[configs.ClientType]string{
+				configs.ClientTypeNethermind: "1.31.9",
+				configs.ClientTypeGeth:       "1.15.6",
+				configs.ClientTypeLighthouse: "7.0.0-beta.5",
+			},
+		},
+		{name: "no name", yaml: "clients:\n  geth: 1.15.6\n", wantErr: "fork config has no name"},
+		{name: "no clients", yaml: "name: Pectra\n", wantErr: "fork config has no client versions"},
+		{name: "unknown client", yaml: "name: Pectra\nclients:\n  geht: 1.15.6\n", wantErr: "fork config has unknown client: geht"},
+		{name: "unparsable version", yaml: "name: Pectra\nclients:\n  geth: latest\n", wantErr: "fork config has invalid geth version: latest"},
+		{name: "invalid yaml", yaml: "name: [Pectra\n", wantErr: "failed to parse fork config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fork.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(config.MinimumVersions) != len(tt.want) {
+				t.Errorf("MinimumVersions = %v, want %v", config.MinimumVersions, tt.want)
+			}
+			for clientName, version := range tt.want {
+				if config.MinimumVersions[clientName] != version {
+					t.Errorf("MinimumVersions[%s] = %q, want %q", clientName, config.MinimumVersions[clientName], version)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read fork config") {
+		t.Errorf("LoadConfig() of a missing file error = %v", err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	config := Config{
+		Name: "Pectra",
+		MinimumVersions: map[configs.ClientType]string{
+			configs.ClientTypeNethermind: "1.30.0",
+			configs.ClientTypeGeth:       "1.15.6",
+			configs.ClientTypeLighthouse: "7.0.0",
+		},
+	}
+	distributions := []datasources.Distribution{
+		{
+			Source:  "ethernodes",
+			Network: configs.NetworkMainnet,
+			Layer:   configs.LayerExecution,
+			Total:   200,
+			Clients: []datasources.ClientCount{
+				{Name: "nethermind", ClientName: configs.ClientTypeNethermind, Total: 50, Versions: []datasources.VersionCount{
+					{Version: "1.30.1", Total: 10},
+					{Version: "1.30.0", Total: 20},
+					{Version: "1.30.0-rc1", Total: 5},
+					{Version: "1.29.1", Total: 10},
+					{Version: "unknown", Total: 5},
+				}},
+				{Name: "geth", ClientName: configs.ClientTypeGeth, Total: 100, Versions: []datasources.VersionCount{
+					{Version: "1.15.10", Total: 60},
+					{Version: "1.15.6", Total: 20},
+					{Version: "1.15.5", Total: 20},
+				}},
+				// A client without a minimum version counts in the layer only.
+				{Name: "besu", ClientName: configs.ClientTypeBesu, Total: 50},
+			},
+		},
+		{
+			Source:  "ethernodes",
+			Network: configs.NetworkMainnet,
+			Layer:   configs.LayerConsensus,
+			Total:   80,
+			Clients: []datasources.ClientCount{
+				{Name: "prysm", ClientName: configs.ClientTypePrysm, Total: 80},
+			},
+		},
+	}
+
+	readiness := Compute(config, distributions)
+	if readiness.Fork != "Pectra" || readiness.Source != "ethernodes" || readiness.Network != configs.NetworkMainnet {
+		t.Errorf("Compute() = %+v, want the fork, source and network of the distributions", readiness)
+	}
+	if len(readiness.Layers) != 2 {
+		t.Fatalf("Compute() has %d layers, want 2", len(readiness.Layers))
+	}
+
+	execution := readiness.Layers[0]
+	if execution.Layer != configs.LayerExecution || execution.Ready != 110 || execution.Total != 200 || execution.Percentage() != 55 {
+		t.Errorf("execution readiness = %d/%d (%.2f%%), want 110/200 (55%%)", execution.Ready, execution.Total, execution.Percentage())
+	}
+	want := []ClientReadiness{
+		{ClientName: configs.ClientTypeGeth, MinimumVersion: "1.15.6", Total: 100, Ready: 80},
+		// Neither the release candidate nor the unparsable version is ready.
+		{ClientName: configs.ClientTypeNethermind, MinimumVersion: "1.30.0", Total: 50, Ready: 30},
+	}
+	if len(execution.Clients) != len(want) {
+		t.Fatalf("execution clients = %+v, want %+v", execution.Clients, want)
+	}
+	for i, client := range execution.Clients {
+		if client != want[i] {
+			t.Errorf("execution client %d = %+v, want %+v", i, client, want[i])
+		}
+	}
+	if got := execution.Clients[1].Percentage(); got != 60 {
+		t.Errorf("nethermind percentage = %.2f, want 60", got)
+	}
+
+	// A client of the config missing from the distribution has no nodes.
+	consensus := readiness.Layers[1]
+	if consensus.Ready != 0 || consensus.Total != 80 || consensus.Percentage() != 0 {
+		t.Errorf("consensus readiness = %d/%d, want 0/80", consensus.Ready, consensus.Total)
+	}
+	if len(consensus.Clients) != 1 || consensus.Clients[0] != (ClientReadiness{ClientName: configs.ClientTypeLighthouse, MinimumVersion: "7.0.0"}) {
+		t.Errorf("consensus clients = %+v, want lighthouse without nodes", consensus.Clients)
+	}
+	if got := consensus.Clients[0].Percentage(); got != 0 {
+		t.Errorf("lighthouse percentage = %.2f, want 0 without nodes", got)
+	}
+}
@@ -1,10 +1,16 @@
 package notifier
 
 import (
+	"client-nodes-reporter/configs"
 	"client-nodes-reporter/datasources"
+	"client-nodes-reporter/forks"
+	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/slack-go/slack"
 )
@@ -12,11 +18,21 @@ import (
 type NotifierReport struct {
 	SourceName string
 	ClientData []datasources.ClientData
+	// Breakdowns of the latest update, e.g. by country and hosting provider
+	Breakdowns []datasources.Breakdown
+	// Reconciliation of the latest update when the source is an aggregate
+	Reconciliation *datasources.Reconciliation
 }
 
+// concentrationRiskThreshold is the share of a client's nodes on one country
+// or provider above which the report flags a concentration risk.
+const concentrationRiskThreshold = 33.0
+
 type SlackNotifierOptions struct {
 	Token   string
 	Channel string
+	// HTTPClient of the Slack API requests; nil keeps the client's default.
+	HTTPClient *http.Client
 }
 
 type SlackNotifier struct {
@@ -25,7 +41,11 @@ type SlackNotifier struct {
 }
 
 func NewSlackNotifier(options SlackNotifierOptions) (*SlackNotifier, error) {
-	client := slack.New(options.Token)
+	var slackOptions []slack.Option
+	if options.HTTPClient != nil {
+		slackOptions = append(slackOptions, slack.OptionHTTPClient(options.HTTPClient))
+	}
+	client := slack.New(options.Token, slackOptions...)
 
 	return &SlackNotifier{
 		options.Channel,
@@ -43,41 +63,107 @@ func (n *SlackNotifier) buildChangeMsg(change int64) string {
 	}
 }
 
-func (n *SlackNotifier) SendReport(report NotifierReport) error {
+func (n *SlackNotifier) buildConcentrationMsg(breakdown datasources.Breakdown) (string, bool) {
+	top, ok := breakdown.Top()
+	if !ok {
+		return "", false
+	}
+	share := breakdown.Share(top)
+	msg := fmt.Sprintf("Top %s is *%s* with *%d* | *%.2f%%* of them", breakdown.Dimension, top.Label, top.Count, share)
+	if share >= concentrationRiskThreshold {
+		msg += " :warning: concentration risk"
+	}
+	return msg, true
+}
+
+func (n *SlackNotifier) buildReconciliationMsg(reconciliation datasources.Reconciliation) string {
+	shares := make([]string, 0, len(reconciliation.Sources))
+	for _, source := range reconciliation.Sources {
+		shares = append(shares, fmt.Sprintf("%s *%.2f%%*", source.Source, source.Share))
+	}
+	msg := fmt.Sprintf("Per source: %s (spread *%.2f* points)", strings.Join(shares, ", "), reconciliation.Spread)
+	if reconciliation.Divergent {
+		msg += " :warning: the sources diverge"
+	}
+	return msg
+}
+
+func (n *SlackNotifier) SendReport(ctx context.Context, report NotifierReport) error {
 	slog.Debug("Starting to send Slack report", "sourceName", report.SourceName, "dataCount", len(report.ClientData))
-	
+
 	if len(report.ClientData) == 0 {
 		return fmt.Errorf("no client data to report")
 	}
-	
+
 	slices.SortFunc(report.ClientData, datasources.ClientData.Compare)
 	lastUpdate := report.ClientData[len(report.ClientData)-1]
 	client := lastUpdate.ClientName.String()
-	
+	if lastUpdate.Network != "" && lastUpdate.Network != configs.NetworkMainnet {
+		client = fmt.Sprintf("%s %s", lastUpdate.Network, client)
+	}
+
 	slog.Debug("Prepared report data", "client", client, "lastUpdate", lastUpdate)
 
-	reportMsg := fmt.Sprintf(
-		"Today there are *%d* | *%.2f%%* %s nodes from which *%d* | *%.2f%%* are synced(*%.2f%%*)!",
-		lastUpdate.ClientTotal,
-		(float64(lastUpdate.ClientTotal)*100)/float64(lastUpdate.Total),
-		client,
-		lastUpdate.ClientSynced,
-		(float64(lastUpdate.ClientSynced)*100)/float64(lastUpdate.TotalSynced),
-		(float64(lastUpdate.ClientSynced)*100)/float64(lastUpdate.ClientTotal),
-	)
+	var reportMsg string
+	// Sources such as the peers of our nodes do not know which are synced.
+	if lastUpdate.TotalSynced < 0 || lastUpdate.ClientSynced < 0 {
+		reportMsg = fmt.Sprintf(
+			"Today there are *%d* | *%.2f%%* %s nodes!",
+			lastUpdate.ClientTotal,
+			(float64(lastUpdate.ClientTotal)*100)/float64(lastUpdate.Total),
+			client,
+		)
+	} else {
+		reportMsg = fmt.Sprintf(
+			"Today there are *%d* | *%.2f%%* %s nodes from which *%d* | *%.2f%%* are synced(*%.2f%%*)!",
+			lastUpdate.ClientTotal,
+			(float64(lastUpdate.ClientTotal)*100)/float64(lastUpdate.Total),
+			client,
+			lastUpdate.ClientSynced,
+			(float64(lastUpdate.ClientSynced)*100)/float64(lastUpdate.TotalSynced),
+			(float64(lastUpdate.ClientSynced)*100)/float64(lastUpdate.ClientTotal),
+		)
+	}
+
+	if latest, ok := datasources.LatestVersion(lastUpdate.Versions); ok {
+		reportMsg += "\n"
+		reportMsg += fmt.Sprintf(
+			"*%d* | *%.2f%%* of them run the latest release *%s*",
+			latest.Total,
+			(float64(latest.Total)*100)/float64(lastUpdate.ClientTotal),
+			latest.Version,
+		)
+		if lastUpdate.ClientSynced >= 0 {
+			reportMsg += fmt.Sprintf(" (*%d* synced)", latest.Synced)
+		}
+	}
+
+	if report.Reconciliation != nil {
+		reportMsg += "\n" + n.buildReconciliationMsg(*report.Reconciliation)
+	}
+
+	for _, breakdown := range report.Breakdowns {
+		if msg, ok := n.buildConcentrationMsg(breakdown); ok {
+			reportMsg += "\n" + msg
+		}
+	}
 
 	if len(report.ClientData) > 1 {
 		previousUpdate := report.ClientData[len(report.ClientData)-2]
 
 		totalChange := lastUpdate.ClientTotal - previousUpdate.ClientTotal
-		SyncedChange := lastUpdate.ClientSynced - previousUpdate.ClientSynced
 
 		reportMsg += "\n"
-		reportMsg += fmt.Sprintf(
-			"The number of all nodes is %s and synced nodes are %s",
-			n.buildChangeMsg(totalChange),
-			n.buildChangeMsg(SyncedChange),
-		)
+		if lastUpdate.ClientSynced < 0 || previousUpdate.ClientSynced < 0 {
+			reportMsg += fmt.Sprintf("The number of all nodes is %s", n.buildChangeMsg(totalChange))
+		} else {
+			SyncedChange := lastUpdate.ClientSynced - previousUpdate.ClientSynced
+			reportMsg += fmt.Sprintf(
+				"The number of all nodes is %s and synced nodes are %s",
+				n.buildChangeMsg(totalChange),
+				n.buildChangeMsg(SyncedChange),
+			)
+		}
 	}
 
 	slog.Debug("Building quick chart")
@@ -87,7 +173,8 @@ func (n *SlackNotifier) SendReport(report NotifierReport) error {
 	}
 	slog.Debug("Quick chart built successfully", "chartUrl", quickChart)
 
-	result, _, err := n.api.PostMessage(
+	result, _, err := n.api.PostMessageContext(
+		ctx,
 		n.channel,
 		slack.MsgOptionBlocks(
 			slack.NewSectionBlock(
@@ -120,3 +207,182 @@ func (n *SlackNotifier) SendReport(report NotifierReport) error {
 
 	return nil
 }
+
+// buildCountdownMsg describes how far away the fork is, e.g. "in *3d 4h*".
+func (n *SlackNotifier) buildCountdownMsg(date time.Time, now time.Time) string {
+	if date.IsZero() {
+		return "with no date set"
+	}
+	remaining := date.Sub(now)
+	if remaining <= 0 {
+		return fmt.Sprintf("*activated* %s ago", formatDuration(-remaining))
+	}
+	return fmt.Sprintf("in *%s* (%s)", formatDuration(remaining), date.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+func formatDuration(d time.Duration) string {
+	days := int64(d / (24 * time.Hour))
+	hours := int64((d % (24 * time.Hour)) / time.Hour)
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, hours)
+	}
+	return fmt.Sprintf("%dh %dm", hours, int64((d%time.Hour)/time.Minute))
+}
+
+func (n *SlackNotifier) SendForkReadinessReport(ctx context.Context, sourceName string, readiness forks.Readiness) error {
+	slog.Debug("Starting to send fork readiness report", "fork", readiness.Fork, "layers", len(readiness.Layers))
+
+	if len(readiness.Layers) == 0 {
+		return fmt.Errorf("no readiness data to report")
+	}
+
+	var reportMsg strings.Builder
+	fmt.Fprintf(&reportMsg, ":hourglass_flowing_sand: *%s* activates %s", readiness.Fork, n.buildCountdownMsg(readiness.Date, time.Now()))
+	if readiness.Network != "" && readiness.Network != configs.NetworkMainnet {
+		fmt.Fprintf(&reportMsg, " on *%s*", readiness.Network)
+	}
+	for _, layer := range readiness.Layers {
+		fmt.Fprintf(
+			&reportMsg,
+			"\n\n*%s*: *%.2f%%* of the network is upgraded (*%d* of *%d* nodes)",
+			layer.Layer,
+			layer.Percentage(),
+			layer.Ready,
+			layer.Total,
+		)
+		for _, client := range layer.Clients {
+			fmt.Fprintf(
+				&reportMsg,
+				"\n• %s: *%.2f%%* (*%d* of *%d*) on %s or later",
+				client.ClientName,
+				client.Percentage(),
+				client.Ready,
+				client.Total,
+				client.MinimumVersion,
+			)
+		}
+	}
+
+	slog.Debug("Building readiness chart")
+	chart, err := BuildReadinessChart(sourceName, readiness)
+	if err != nil {
+		return fmt.Errorf("failed to build readiness chart: %w", err)
+	}
+
+	title := fmt.Sprintf("%s readiness", readiness.Fork)
+	result, _, err := n.api.PostMessageContext(
+		ctx,
+		n.channel,
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject(
+					slack.MarkdownType,
+					reportMsg.String(),
+					false,
+					false,
+				),
+				nil,
+				nil,
+			),
+			slack.NewImageBlock(
+				chart,
+				title,
+				"quickchart-image",
+				slack.NewTextBlockObject(
+					slack.PlainTextType,
+					title,
+					false,
+					false,
+				),
+			),
+		),
+	)
+	slog.Debug("Slack message sent", "result", result)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return nil
+}
+
+// SendBlockAlert tells the channel that a run was stopped by an anti-bot
+// block that will not pass on its own, with the Ray ID to look it up by.
+func (n *SlackNotifier) SendBlockAlert(ctx context.Context, sourceName string, block *datasources.BlockError) error {
+	slog.Debug("Sending block alert", "source", sourceName, "kind", block.Kind)
+
+	var alertMsg strings.Builder
+	fmt.Fprintf(&alertMsg, ":no_entry: *%s* fetch was blocked: *%s* (HTTP %d", sourceName, block.Kind, block.Status)
+	if block.Code != 0 {
+		fmt.Fprintf(&alertMsg, ", error %d", block.Code)
+	}
+	alertMsg.WriteString(")")
+	if block.ViaFlareSolverr {
+		alertMsg.WriteString(" even through FlareSolverr")
+	}
+	fmt.Fprintf(&alertMsg, "\nURL: %s", block.URL)
+	if block.RayID != "" {
+		fmt.Fprintf(&alertMsg, "\nRay ID: `%s`", block.RayID)
+	}
+
+	result, _, err := n.api.PostMessageContext(
+		ctx,
+		n.channel,
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject(
+					slack.MarkdownType,
+					alertMsg.String(),
+					false,
+					false,
+				),
+				nil,
+				nil,
+			),
+		),
+	)
+	slog.Debug("Slack message sent", "result", result)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return nil
+}
+
+// SendValidationAlert tells the channel that a scraped row failed validation
+// and was quarantined, or not recorded at all.
+func (n *SlackNotifier) SendValidationAlert(ctx context.Context, sourceName string, invalid *datasources.ValidationError, quarantined bool) error {
+	slog.Debug("Sending validation alert", "source", sourceName, "client", invalid.ClientData.ClientName)
+
+	outcome := "was not recorded"
+	if quarantined {
+		outcome = "was quarantined instead of recorded"
+	}
+	var alertMsg strings.Builder
+	fmt.Fprintf(&alertMsg, ":warning: *%s* data for *%s* looks wrong and %s:", sourceName, string(invalid.ClientData.ClientName), outcome)
+	for _, problem := range invalid.Problems {
+		fmt.Fprintf(&alertMsg, "\n• %s", problem)
+	}
+
+	result, _, err := n.api.PostMessageContext(
+		ctx,
+		n.channel,
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(
+				slack.NewTextBlockObject(
+					slack.MarkdownType,
+					alertMsg.String(),
+					false,
+					false,
+				),
+				nil,
+				nil,
+			),
+		),
+	)
+	slog.Debug("Slack message sent", "result", result)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return nil
+}
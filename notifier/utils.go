@@ -2,6 +2,7 @@ package notifier
 
 import (
 	"client-nodes-reporter/datasources"
+	"client-nodes-reporter/forks"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -42,31 +43,87 @@ func BuildQuickChart(
 	syncedNodes := make([]string, len(data))
 	dates := make([]string, len(data))
 
+	syncedKnown := false
 	for i, d := range data {
 		allNodes[i] = strconv.FormatInt(d.ClientTotal, 10)
-		syncedNodes[i] = strconv.FormatInt(d.ClientSynced, 10)
+		// An unknown synced count (-1) leaves a gap in the line.
+		syncedNodes[i] = "NaN"
+		if d.ClientSynced >= 0 {
+			syncedNodes[i] = strconv.FormatInt(d.ClientSynced, 10)
+			syncedKnown = true
+		}
 		dates[i] = d.CreatedAt.Format("2006-01-02")
 	}
 
+	datasets := []QuickChartDataset{
+		{
+			Label: fmt.Sprintf("All Nodes (%s)", source),
+			Data:  allNodes,
+		},
+	}
+	if syncedKnown {
+		datasets = append(datasets, QuickChartDataset{
+			Label: fmt.Sprintf("Synced Nodes (%s)", source),
+			Data:  syncedNodes,
+		})
+	}
+
 	quickChart := QuickChart{
 		Type: "line",
 		Data: QuickChartData{
-			Labels: dates,
+			Labels:   dates,
+			Datasets: datasets,
+		},
+		Options: QuickChartOptions{
+			Legend: QuickChartLegend{
+				Display:  true,
+				Position: "right",
+				Align:    "start",
+			},
+		},
+	}
+
+	json, err := json.Marshal(quickChart)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.QueryEscape(string(json))
+
+	return fmt.Sprintf("https://quickchart.io/chart?c=%s", query), nil
+}
+
+// BuildReadinessChart draws the upgraded percentage of every client and of
+// each layer's whole network as a bar chart.
+func BuildReadinessChart(
+	source string,
+	readiness forks.Readiness,
+) (string, error) {
+	var labels, percentages []string
+	for _, layer := range readiness.Layers {
+		for _, client := range layer.Clients {
+			labels = append(labels, client.ClientName.String())
+			percentages = append(percentages, strconv.FormatFloat(client.Percentage(), 'f', 2, 64))
+		}
+		labels = append(labels, fmt.Sprintf("%s network", layer.Layer))
+		percentages = append(percentages, strconv.FormatFloat(layer.Percentage(), 'f', 2, 64))
+	}
+
+	quickChart := QuickChart{
+		Type: "bar",
+		Data: QuickChartData{
+			Labels: labels,
 			Datasets: []QuickChartDataset{
 				{
-					Label: fmt.Sprintf("All Nodes (%s)", source),
-					Data:  allNodes,
-				},
-				{
-					Label: fmt.Sprintf("Synced Nodes (%s)", source),
-					Data:  syncedNodes,
+					Label: fmt.Sprintf("%% upgraded for %s (%s)", readiness.Fork, source),
+					Data:  percentages,
 				},
 			},
 		},
 		Options: QuickChartOptions{
 			Legend: QuickChartLegend{
 				Display:  true,
-				Position: "right",
+				Position: "top",
 				Align:    "start",
 			},
 		},
@@ -0,0 +1,395 @@
+// Package recording records the HTTP exchanges of a run to a directory and
+// replays them, so a production run can be rerun offline, without network
+// access or credentials.
+//
+// A recording holds exchanges.jsonl, one Exchange per line in the order the
+// requests were sent, and the response bodies under bodies/.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exchangesFile lists the exchanges of a recording.
+const exchangesFile = "exchanges.jsonl"
+
+// redacted replaces credentials in a recording.
+const redacted = "[redacted]"
+
+// Exchange is one recorded request with its response, or the error it failed
+// with.
+type Exchange struct {
+	Seq           int         `json:"seq"`
+	Time          time.Time   `json:"time"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestHeader http.Header `json:"requestHeader,omitempty"`
+	RequestBody   string      `json:"requestBody,omitempty"`
+	Status        int         `json:"status,omitempty"`
+	Header        http.Header `json:"header,omitempty"`
+	// Body is the file of the response body, relative to the recording.
+	Body  string `json:"body,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Session records or replays the HTTP exchanges of a run.
+type Session interface {
+	// Wrap returns a transport that records or replays the requests that
+	// would otherwise go through base.
+	Wrap(base http.RoundTripper) http.RoundTripper
+}
+
+// Recorder writes every exchange sent through its transports to Dir.
+type Recorder struct {
+	Dir string
+
+	mu  sync.Mutex
+	seq int
+	// headers are the names of further headers to redact, canonicalized.
+	headers []string
+}
+
+// NewRecorder starts a recording in dir, which must not hold one already.
+func NewRecorder(dir string) (*Recorder, error) {
+	if _, err := os.Stat(filepath.Join(dir, exchangesFile)); err == nil {
+		return nil, fmt.Errorf("%s already holds a recording", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "bodies"), 0o755); err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+	return &Recorder{Dir: dir}, nil
+}
+
+func (r *Recorder) Wrap(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recordingTransport{recorder: r, base: base}
+}
+
+// RedactHeaders has the recording redact the headers with these names too,
+// such as the ones an API mapping sends its credentials in.
+func (r *Recorder) RedactHeaders(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.headers = append(r.headers, http.CanonicalHeaderKey(name))
+	}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	base     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := Exchange{
+		Time:          time.Now().UTC(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: t.recorder.redactHeader(req.Header),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		exchange.RequestBody = redactBody(req.Header.Get("Content-Type"), body)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		t.recorder.write(exchange, nil)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		exchange.Error = err.Error()
+		t.recorder.write(exchange, nil)
+		return nil, err
+	}
+	exchange.Status = resp.StatusCode
+	exchange.Header = t.recorder.redactHeader(resp.Header)
+	t.recorder.write(exchange, redactResponseBody(resp.Header.Get("Content-Type"), body))
+	return resp, nil
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// write appends an exchange to the recording right away, so a run that
+// crashes can still be replayed up to the crash. A recording that cannot be
+// written is logged rather than failing the run.
+func (r *Recorder) write(exchange Exchange, body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	exchange.Seq = r.seq
+	if body != nil {
+		host := "request"
+		if parsed, err := url.Parse(exchange.URL); err == nil && parsed.Host != "" {
+			host = unsafePathChars.ReplaceAllString(parsed.Host, "_")
+		}
+		exchange.Body = fmt.Sprintf("bodies/%04d-%s.body", exchange.Seq, host)
+		if err := os.WriteFile(filepath.Join(r.Dir, filepath.FromSlash(exchange.Body)), body, 0o644); err != nil {
+			slog.Warn("Failed to record response body", "url", exchange.URL, "error", err)
+			exchange.Body = ""
+		}
+	}
+
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		slog.Warn("Failed to record exchange", "url", exchange.URL, "error", err)
+		return
+	}
+	file, err := os.OpenFile(filepath.Join(r.Dir, exchangesFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		slog.Warn("Failed to record exchange", "url", exchange.URL, "error", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Warn("Failed to record exchange", "url", exchange.URL, "error", err)
+	}
+}
+
+// redactedHeaders carry Cloudflare clearances; sensitiveHeaderPattern
+// matches the headers carrying the other credentials.
+var redactedHeaders = []string{"Cookie", "Set-Cookie"}
+
+// sensitiveHeaderPattern matches the names of headers likely to carry
+// credentials, such as Authorization, Proxy-Authorization or X-Api-Key.
+var sensitiveHeaderPattern = regexp.MustCompile(`(?i)key|token|auth`)
+
+func (r *Recorder) sensitiveHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	if slices.Contains(redactedHeaders, name) || sensitiveHeaderPattern.MatchString(name) {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Contains(r.headers, name)
+}
+
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for name := range header {
+		if r.sensitiveHeader(name) {
+			header[name] = []string{redacted}
+		}
+	}
+	return header
+}
+
+// jsonPasswordPattern matches passwords in JSON bodies, such as the proxy of
+// a FlareSolverr request.
+var jsonPasswordPattern = regexp.MustCompile(`("password"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// redactBody removes the Slack token of form bodies and the passwords of
+// JSON bodies.
+func redactBody(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Has("token") {
+			form.Set("token", redacted)
+			return form.Encode()
+		}
+	}
+	return jsonPasswordPattern.ReplaceAllString(string(body), `$1"`+redacted+`"`)
+}
+
+// redactResponseBody removes the Cloudflare clearance of a FlareSolverr
+// response: the values of its cookies, its user agent, which the clearance
+// is bound to, and the cookies of its headers. Other bodies are kept as
+// they are.
+func redactResponseBody(contentType string, body []byte) []byte {
+	if !strings.Contains(contentType, "json") {
+		return body
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var response map[string]any
+	if err := decoder.Decode(&response); err != nil {
+		return body
+	}
+	solution, ok := response["solution"].(map[string]any)
+	if !ok {
+		return body
+	}
+
+	if cookies, ok := solution["cookies"].([]any); ok {
+		for _, cookie := range cookies {
+			if cookie, ok := cookie.(map[string]any); ok {
+				if _, ok := cookie["value"]; ok {
+					cookie["value"] = redacted
+				}
+			}
+		}
+	}
+	if _, ok := solution["userAgent"]; ok {
+		solution["userAgent"] = redacted
+	}
+	if headers, ok := solution["headers"].(map[string]any); ok {
+		for name := range headers {
+			if slices.Contains(redactedHeaders, http.CanonicalHeaderKey(name)) {
+				headers[name] = redacted
+			}
+		}
+	}
+
+	var redactedBody bytes.Buffer
+	encoder := json.NewEncoder(&redactedBody)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(response); err != nil {
+		return body
+	}
+	return redactedBody.Bytes()
+}
+
+// Replayer answers requests with the exchanges of a recording instead of
+// sending them.
+type Replayer struct {
+	Dir string
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+// NewReplayer loads the recording in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	file, err := os.Open(filepath.Join(dir, exchangesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s holds no recording", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	defer file.Close()
+
+	r := &Replayer{Dir: dir}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("decode recorded exchange: %w", err)
+		}
+		r.exchanges = append(r.exchanges, exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	r.used = make([]bool, len(r.exchanges))
+	return r, nil
+}
+
+// Wrap ignores base: nothing is sent.
+func (r *Replayer) Wrap(base http.RoundTripper) http.RoundTripper {
+	return replayTransport{replayer: r}
+}
+
+type replayTransport struct {
+	replayer *Replayer
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body string
+	if req.Body != nil && req.Body != http.NoBody {
+		raw, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		body = redactBody(req.Header.Get("Content-Type"), raw)
+	}
+
+	exchange, ok := t.replayer.take(req.Method, req.URL, body)
+	if !ok {
+		return nil, fmt.Errorf("no recorded exchange left for %s %s", req.Method, req.URL)
+	}
+	slog.Debug("Replaying recorded exchange", "seq", exchange.Seq, "method", exchange.Method, "url", exchange.URL)
+	if exchange.Error != "" {
+		return nil, fmt.Errorf("recorded: %s", exchange.Error)
+	}
+
+	var respBody []byte
+	if exchange.Body != "" {
+		var err error
+		respBody, err = os.ReadFile(filepath.Join(t.replayer.Dir, filepath.FromSlash(exchange.Body)))
+		if err != nil {
+			return nil, fmt.Errorf("read recorded body: %w", err)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        exchange.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// anyRequestHosts are the hosts of the Notion and Slack APIs, whose requests
+// replay on their host alone: a replay without credentials asks for
+// placeholder database ids and channels, and their request bodies carry
+// times.
+var anyRequestHosts = []string{"api.notion.com", "slack.com"}
+
+// take returns the first unused exchange with the same method, URL and body.
+// Failing that, it takes the first with the same method and URL, then, on
+// anyRequestHosts, the first with the same method and host.
+func (r *Replayer) take(method string, target *url.URL, body string) (Exchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matchers := []func(Exchange, *url.URL) bool{
+		func(e Exchange, u *url.URL) bool { return u.String() == target.String() && e.RequestBody == body },
+		func(e Exchange, u *url.URL) bool { return u.String() == target.String() },
+		func(e Exchange, u *url.URL) bool {
+			return u.Host == target.Host && slices.Contains(anyRequestHosts, target.Hostname())
+		},
+	}
+	for _, matches := range matchers {
+		for i, exchange := range r.exchanges {
+			if r.used[i] || exchange.Method != method {
+				continue
+			}
+			recorded, err := url.Parse(exchange.URL)
+			if err != nil || !matches(exchange, recorded) {
+				continue
+			}
+			r.used[i] = true
+			return exchange, true
+		}
+	}
+	return Exchange{}, false
+}
@@ -0,0 +1,141 @@
+package recording
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestReplayerTake(t *testing.T) {
+	exchanges := []Exchange{
+		{Seq: 1, Method: http.MethodGet, URL: "https://ethernodes.org/client/nethermind"},
+		{Seq: 2, Method: http.MethodPost, URL: "https://api.notion.com/v1/databases/recorded/query", RequestBody: `{"after":"2026-10-15"}`},
+		{Seq: 3, Method: http.MethodPost, URL: "https://slack.com/api/chat.postMessage", RequestBody: "channel=C1"},
+		{Seq: 4, Method: http.MethodPost, URL: "http://localhost:8191/v1", RequestBody: `{"cmd":"request.get","url":"https://ethernodes.org"}`},
+		{Seq: 5, Method: http.MethodPost, URL: "http://localhost:8191/v1", RequestBody: `{"cmd":"sessions.create"}`},
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		wantSeq int
+		wantOK  bool
+	}{
+		{"same url", http.MethodGet, "https://ethernodes.org/client/nethermind", "", 1, true},
+		{"same url and body first", http.MethodPost, "http://localhost:8191/v1", `{"cmd":"sessions.create"}`, 5, true},
+		{"same url, other body", http.MethodPost, "http://localhost:8191/v1", `{"cmd":"sessions.destroy"}`, 4, true},
+		{"notion on its host", http.MethodPost, "https://api.notion.com/v1/databases/placeholder/query", `{"after":"2026-10-16"}`, 2, true},
+		{"slack on its host", http.MethodPost, "https://slack.com/api/conversations.history", "channel=C2", 3, true},
+		{"other method", http.MethodDelete, "https://ethernodes.org/client/nethermind", "", 0, false},
+		{"other host", http.MethodGet, "https://ethernodes.org/client/geth", "", 0, false},
+		{"other flaresolverr host", http.MethodPost, "http://flaresolverr:8191/v1", `{"cmd":"sessions.create"}`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Replayer{exchanges: exchanges, used: make([]bool, len(exchanges))}
+			target, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := r.take(tt.method, target, tt.body)
+			if ok != tt.wantOK || got.Seq != tt.wantSeq {
+				t.Errorf("take(%s %s) = seq %d, %v; want seq %d, %v", tt.method, tt.url, got.Seq, ok, tt.wantSeq, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReplayerTakeUsesEachExchangeOnce(t *testing.T) {
+	exchanges := []Exchange{
+		{Seq: 1, Method: http.MethodGet, URL: "https://ethernodes.org/"},
+		{Seq: 2, Method: http.MethodGet, URL: "https://ethernodes.org/"},
+	}
+	r := &Replayer{exchanges: exchanges, used: make([]bool, len(exchanges))}
+	target, _ := url.Parse("https://ethernodes.org/")
+	for _, want := range []int{1, 2} {
+		got, ok := r.take(http.MethodGet, target, "")
+		if !ok || got.Seq != want {
+			t.Fatalf("take() = seq %d, %v; want seq %d", got.Seq, ok, want)
+		}
+	}
+	if _, ok := r.take(http.MethodGet, target, ""); ok {
+		t.Error("take() returned an exchange already used")
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	r := &Recorder{}
+	r.RedactHeaders("x-mapping-secret")
+	header := http.Header{
+		"Authorization":       {"Bearer secret"},
+		"Proxy-Authorization": {"Basic secret"},
+		"Cookie":              {"cf_clearance=secret"},
+		"X-Api-Key":           {"secret"},
+		"X-Access-Token":      {"secret"},
+		"X-Mapping-Secret":    {"secret"},
+		"User-Agent":          {"Mozilla/5.0"},
+		"Content-Type":        {"application/json"},
+	}
+
+	got := r.redactHeader(header)
+	for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Access-Token", "X-Mapping-Secret"} {
+		if got.Get(name) != redacted {
+			t.Errorf("%s = %q, want it redacted", name, got.Get(name))
+		}
+	}
+	for _, name := range []string{"User-Agent", "Content-Type"} {
+		if got.Get(name) != header.Get(name) {
+			t.Errorf("%s = %q, want %q", name, got.Get(name), header.Get(name))
+		}
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Error("redactHeader changed the header it was given")
+	}
+}
+
+func TestRedactResponseBody(t *testing.T) {
+	body := `{"status":"ok","solution":{"url":"https://ethernodes.org/","status":200,"response":"<html>1 & 2</html>",` +
+		`"cookies":[{"name":"cf_clearance","value":"secret","domain":".ethernodes.org"}],` +
+		`"userAgent":"Mozilla/5.0 secret","headers":{"set-cookie":"cf_clearance=secret","content-type":"text/html"}}}`
+
+	var got struct {
+		Solution struct {
+			Response string `json:"response"`
+			Cookies  []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"cookies"`
+			UserAgent string            `json:"userAgent"`
+			Headers   map[string]string `json:"headers"`
+		} `json:"solution"`
+	}
+	if err := json.Unmarshal(redactResponseBody("application/json", []byte(body)), &got); err != nil {
+		t.Fatal(err)
+	}
+	solution := got.Solution
+	if len(solution.Cookies) != 1 || solution.Cookies[0].Name != "cf_clearance" || solution.Cookies[0].Value != redacted {
+		t.Errorf("cookies = %+v, want the value of cf_clearance redacted", solution.Cookies)
+	}
+	if solution.UserAgent != redacted {
+		t.Errorf("userAgent = %q, want it redacted", solution.UserAgent)
+	}
+	if solution.Headers["set-cookie"] != redacted || solution.Headers["content-type"] != "text/html" {
+		t.Errorf("headers = %v, want only set-cookie redacted", solution.Headers)
+	}
+	if solution.Response != "<html>1 & 2</html>" {
+		t.Errorf("response = %q, want it kept", solution.Response)
+	}
+
+	for _, tt := range []struct{ contentType, body string }{
+		{"text/html", body},
+		{"application/json", `{"results":[]}`},
+		{"application/json", `not json`},
+	} {
+		if got := string(redactResponseBody(tt.contentType, []byte(tt.body))); got != tt.body {
+			t.Errorf("redactResponseBody(%q, %q) = %q, want it unchanged", tt.contentType, tt.body, got)
+		}
+	}
+}